@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/roasbeef/lseed/seed"
+)
+
+const (
+	// nodesAPIPath is the path of the HTTP read API, followed by the name
+	// or ticker of a chain.
+	nodesAPIPath = "/api/v1/nodes/"
+
+	// maxAPINodes is the largest number of nodes returned by the HTTP
+	// read API at once.
+	maxAPINodes = 100
+)
+
+// apiNode is a node returned by the HTTP read API.
+type apiNode struct {
+	ID             string   `json:"id"`
+	Addresses      []string `json:"addresses"`
+	OnionAddresses []string `json:"onion_addresses,omitempty"`
+	Hostnames      []string `json:"hostnames,omitempty"`
+	// LastUpdate is the time of the latest announcement of the node in
+	// the graph, as timestamped by the node itself, and LastSeen the time
+	// of our latest poll the node was seen in, both in Unix seconds.
+	LastUpdate int64 `json:"last_update,omitempty"`
+	LastSeen   int64 `json:"last_seen,omitempty"`
+
+	// ChannelStats are the stats of the channels of the node, only set
+	// if asked for and known.
+	ChannelStats *seed.ChannelStats `json:"channel_stats,omitempty"`
+}
+
+// nodesQuery is a parsed query of the HTTP read API.
+type nodesQuery struct {
+	nodeType seed.NodeType
+	count    int
+	features []lnwire.FeatureBit
+
+	// port, if set, restricts the nodes, and their addresses, to those
+	// on the port.
+	port int
+
+	// stats is set if the stats of the channels of the nodes are asked
+	// for.
+	stats bool
+}
+
+// parseNodesQuery parses the query parameters of the HTTP read API: type, a
+// comma separated list of the node types any of which the nodes must have,
+// count, the number of nodes, features, a comma separated list of the feature
+// bits the nodes must support, and port, the port the nodes must have an IPv4
+// or IPv6 address of the given types on. If stats is set, the stats of the
+// channels of each node are included.
+func parseNodesQuery(params url.Values) (*nodesQuery, error) {
+	q := &nodesQuery{
+		nodeType: 255,
+		count:    *numResults,
+	}
+
+	if types := params.Get("type"); types != "" {
+		var err error
+		q.nodeType, err = seed.ParseFamilies(strings.ToLower(types))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if count := params.Get("count"); count != "" {
+		var err error
+		q.count, err = strconv.Atoi(count)
+		if err != nil || q.count < 1 || q.count > maxAPINodes {
+			return nil, fmt.Errorf("count must be between 1 and %d",
+				maxAPINodes)
+		}
+	}
+
+	if port := params.Get("port"); port != "" {
+		var err error
+		q.port, err = strconv.Atoi(port)
+		if err != nil || q.port < 1 || q.port > 65535 {
+			return nil, fmt.Errorf("port must be between 1 and 65535")
+		}
+	}
+
+	q.stats = params.Get("stats") != ""
+
+	if features := params.Get("features"); features != "" {
+		for _, s := range strings.Split(features, ",") {
+			bit, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid feature bit %q",
+					s)
+			}
+			q.features = append(q.features, lnwire.FeatureBit(bit))
+		}
+	}
+
+	return q, nil
+}
+
+// nodesAPIHandler returns an http handler serving the HTTP read API, e.g.
+// GET /api/v1/nodes/bitcoin?type=ipv4&count=25, which returns a JSON array of
+// nodes of a chain, sampled just like the DNS answers.
+func nodesAPIHandler(chainViews map[string]*seed.ChainView) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed",
+				http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(r.URL.Path, nodesAPIPath))
+
+		var chainView *seed.ChainView
+		for _, chain := range chains {
+			if name == strings.ToLower(chain.ticker) ||
+				name == chain.name {
+
+				chainView = chainViews[chain.prefix]
+				break
+			}
+		}
+		if chainView == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		q, err := parseNodesQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var filter func(seed.Node) bool
+		if len(q.features) > 0 {
+			filter = chainView.NetView.FeatureFilter(nil, q.features...)
+		}
+		if q.port != 0 {
+			filter = seed.PortFilter(filter, q.port, q.nodeType)
+		}
+
+		nodes := []apiNode{}
+		sample := chainView.NetView.RandomSampleFunc(
+			q.nodeType, q.count, filter,
+		)
+		for _, n := range sample {
+			node := apiNode{
+				ID:             n.Id,
+				Addresses:      []string{},
+				OnionAddresses: n.OnionAddresses,
+				Hostnames:      n.Hostnames,
+			}
+			if !n.LastUpdate.IsZero() {
+				node.LastUpdate = n.LastUpdate.Unix()
+			}
+			if !n.LastSeen.IsZero() {
+				node.LastSeen = n.LastSeen.Unix()
+			}
+			if q.stats {
+				stats, ok := chainView.NetView.ChannelStats(n.Id)
+				if ok {
+					node.ChannelStats = &stats
+				}
+			}
+			addrs := n.Addresses
+			if q.port != 0 {
+				addrs = seed.AddressesOnPort(n, q.port, q.nodeType)
+			}
+			for _, addr := range addrs {
+				node.Addresses = append(
+					node.Addresses, addr.String(),
+				)
+			}
+
+			nodes = append(nodes, node)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(nodes); err != nil {
+			log.Errorf("Unable to write nodes: %v", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/roasbeef/lseed/seed"
+)
+
+const (
+	// digestPath is the path of the view digests.
+	digestPath = "/digest"
+
+	// peerDigestTimeout bounds the fetch of the digests of a peer seed.
+	peerDigestTimeout = 10 * time.Second
+
+	// driftWarnOverlap is the overlap with a peer's view below which we
+	// warn that the views drifted apart.
+	driftWarnOverlap = 0.9
+)
+
+// viewDigests returns the digests of the chain views, by chain name.
+func viewDigests(chainViews map[string]*seed.ChainView,
+	withIDs bool) map[string]seed.ViewDigest {
+
+	digests := make(map[string]seed.ViewDigest, len(chainViews))
+	for _, chainView := range chainViews {
+		digests[chainView.NetView.Chain()] = chainView.NetView.Digest(
+			withIDs,
+		)
+	}
+
+	return digests
+}
+
+// digestHandler returns an http handler reporting the digest of each chain
+// view, so the views of several seeds can be compared. The IDs of the nodes
+// are included if the ids query parameter is set, e.g. /digest?ids=1.
+func digestHandler(chainViews map[string]*seed.ChainView) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		withIDs := r.URL.Query().Get("ids") != ""
+
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(viewDigests(chainViews, withIDs))
+		if err != nil {
+			log.Errorf("Unable to write digests: %v", err)
+		}
+	}
+}
+
+// fetchPeerDigests fetches the digests of the views of the peer seed whose
+// digest endpoint is at peerURL, along with the IDs of their nodes.
+func fetchPeerDigests(client *http.Client,
+	peerURL string) (map[string]seed.ViewDigest, error) {
+
+	u, err := url.Parse(peerURL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("ids", "1")
+	u.RawQuery = query.Encode()
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	var digests map[string]seed.ViewDigest
+	if err := json.NewDecoder(resp.Body).Decode(&digests); err != nil {
+		return nil, err
+	}
+
+	return digests, nil
+}
+
+// comparePeerViews periodically compares the chain views with those of the
+// peer seed whose digest endpoint is at peerURL, logging how much they
+// overlap, and warning if they drifted apart.
+func comparePeerViews(chainViews map[string]*seed.ChainView, peerURL string,
+	interval time.Duration) {
+
+	client := &http.Client{Timeout: peerDigestTimeout}
+
+	compare := func() {
+		peer, err := fetchPeerDigests(client, peerURL)
+		if err != nil {
+			log.Errorf("Unable to fetch the digests of %v: %v",
+				peerURL, err)
+			return
+		}
+
+		for chain, ours := range viewDigests(chainViews, true) {
+			theirs, ok := peer[chain]
+			if !ok {
+				log.Warnf("Peer %v doesn't serve %v", peerURL,
+					chain)
+				continue
+			}
+
+			if ours.Hash == theirs.Hash {
+				log.Debugf("The %v view is in sync with %v",
+					chain, peerURL)
+				continue
+			}
+
+			overlap := seed.Overlap(ours.IDs, theirs.IDs)
+			logf := log.Infof
+			if overlap < driftWarnOverlap {
+				logf = log.Warnf
+			}
+			logf("The %v view overlaps %.1f%% with the one of %v, "+
+				"%d nodes here and %d there", chain, overlap*100,
+				peerURL, ours.Nodes, theirs.Nodes)
+		}
+	}
+
+	compare()
+
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		compare()
+	}
+}
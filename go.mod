@@ -5,16 +5,18 @@ require (
 	github.com/btcsuite/btcd v0.20.1-beta
 	github.com/btcsuite/btcutil v0.0.0-20190425235716-9e5f4b9a998d
 	github.com/davecgh/go-spew v1.1.1
+	github.com/golang/protobuf v1.3.2
 	github.com/lightningnetwork/lnd v0.8.1-beta
 	github.com/miekg/dns v1.0.7
 	github.com/onsi/ginkgo v1.8.0 // indirect
 	github.com/onsi/gomega v1.5.0 // indirect
-	github.com/sirupsen/logrus v1.4.0 // indirect
-	github.com/stretchr/testify v1.3.0 // indirect
+	github.com/prometheus/client_golang v1.5.1
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	google.golang.org/grpc v1.18.0
 	gopkg.in/airbrake/gobrake.v2 v2.0.9 // indirect
 	gopkg.in/gemnasium/logrus-airbrake-hook.v2 v2.1.2 // indirect
 	gopkg.in/macaroon.v2 v2.0.0
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 )
 
 go 1.13
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// mib is the number of bytes in a MiB, the unit of the receive cap
+	// flags.
+	mib = 1024 * 1024
+
+	// graphSizeWarnRatio is the ratio of the receive cap past which we
+	// warn that the graph is about to outgrow it.
+	graphSizeWarnRatio = 0.8
+)
+
+// recvSizeErrRe matches the error of a gRPC call whose response exceeded the
+// receive cap, capturing the size of the response.
+var recvSizeErrRe = regexp.MustCompile(
+	`received message larger than max \((\d+) vs\. \d+\)`,
+)
+
+// graphSizeError returns the size of the response lnd tried to send us if err
+// is due to it exceeding our receive cap.
+func graphSizeError(err error) (int, bool) {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.ResourceExhausted {
+		return 0, false
+	}
+
+	match := recvSizeErrRe.FindStringSubmatch(s.Message())
+	if match == nil {
+		return 0, false
+	}
+
+	size, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return size, true
+}
+
+// graphFetcher fetches the graph of a chain's backing lnd node, raising the
+// receive cap as the graph grows, up to -max-recv-mb-limit.
+type graphFetcher struct {
+	lnd   lnrpc.LightningClient
+	chain string
+
+	// recvSize is the current receive cap, in bytes.
+	recvSize int
+}
+
+// newGraphFetcher creates a graphFetcher starting with the -max-recv-mb
+// receive cap.
+func newGraphFetcher(lnd lnrpc.LightningClient, chain string) *graphFetcher {
+	return &graphFetcher{
+		lnd:      lnd,
+		chain:    chain,
+		recvSize: *maxRecvMB * mib,
+	}
+}
+
+// maxGraphFetches bounds the number of attempts at fetching a graph which
+// keeps outgrowing the receive cap.
+const maxGraphFetches = 3
+
+// describeGraph fetches the graph. If it's too large for the receive cap,
+// the cap is raised to fit it with some headroom and the graph fetched again,
+// unless that would exceed -max-recv-mb-limit.
+func (g *graphFetcher) describeGraph() (*lnrpc.ChannelGraph, error) {
+	var (
+		graph *lnrpc.ChannelGraph
+		err   error
+	)
+	for i := 0; i < maxGraphFetches; i++ {
+		graph, err = g.lnd.DescribeGraph(
+			context.Background(), &lnrpc.ChannelGraphRequest{},
+			grpc.MaxCallRecvMsgSize(g.recvSize),
+		)
+
+		size, tooLarge := graphSizeError(err)
+		if !tooLarge {
+			break
+		}
+
+		limit := *maxRecvMBLimit * mib
+		if size > limit {
+			return nil, fmt.Errorf("the %v graph is %d bytes, more "+
+				"than the %d bytes of -max-recv-mb-limit: %v",
+				g.chain, size, limit, err)
+		}
+
+		recvSize := size + size/4
+		if recvSize > limit {
+			recvSize = limit
+		}
+		log.Warnf("The %v graph is %d bytes, raising the receive cap "+
+			"from %d to %d bytes", g.chain, size, g.recvSize,
+			recvSize)
+		g.recvSize = recvSize
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size := proto.Size(graph)
+	log.Debugf("Got a %v graph of %d bytes", g.chain, size)
+	if float64(size) > graphSizeWarnRatio*float64(g.recvSize) {
+		log.Warnf("The %v graph is %d bytes, close to the receive cap "+
+			"of %d bytes", g.chain, size, g.recvSize)
+	}
+
+	return graph, nil
+}
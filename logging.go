@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// configureLogOutput directs the log output to stdout, syslog or a rotated
+// file, as selected by -log-output. The target is checked to be writable, so
+// we don't lose the logs silently.
+func configureLogOutput() error {
+	switch *logOutput {
+	case "stdout":
+		log.SetOutput(os.Stdout)
+
+	case "file":
+		if *logFile == "" {
+			return fmt.Errorf("-log-file is required to log to a file")
+		}
+		path := cleanAndExpandPath(*logFile)
+
+		// The file is only opened on the first write, so we'll make
+		// sure we can write to it now.
+		f, err := os.OpenFile(
+			path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640,
+		)
+		if err != nil {
+			return fmt.Errorf("log file isn't writable: %v", err)
+		}
+		f.Close()
+
+		log.SetOutput(&lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    *logMaxSize,
+			MaxBackups: *logMaxBackups,
+		})
+
+	case "syslog":
+		hook, err := newSyslogHook(*syslogAddr)
+		if err != nil {
+			return fmt.Errorf("unable to connect to syslog: %v", err)
+		}
+		log.AddHook(hook)
+		log.SetOutput(ioutil.Discard)
+
+	default:
+		return fmt.Errorf("unknown log output %v", *logOutput)
+	}
+
+	return nil
+}
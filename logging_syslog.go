@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"log/syslog"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// syslogHook is a logrus hook forwarding the log entries to syslog.
+type syslogHook struct {
+	w *syslog.Writer
+}
+
+// newSyslogHook connects to the syslog daemon at addr over UDP, or to the
+// local one if addr is empty.
+func newSyslogHook(addr string) (log.Hook, error) {
+	var network string
+	if addr != "" {
+		network = "udp"
+	}
+
+	w, err := syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON,
+		"lseed")
+	if err != nil {
+		return nil, err
+	}
+
+	return &syslogHook{w: w}, nil
+}
+
+// Levels returns the levels the hook fires for, i.e. all of them.
+func (h *syslogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire writes the entry to syslog with the matching severity.
+func (h *syslogHook) Fire(entry *log.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+
+	switch entry.Level {
+	case log.PanicLevel, log.FatalLevel:
+		return h.w.Crit(line)
+	case log.ErrorLevel:
+		return h.w.Err(line)
+	case log.WarnLevel:
+		return h.w.Warning(line)
+	case log.InfoLevel:
+		return h.w.Info(line)
+	default:
+		return h.w.Debug(line)
+	}
+}
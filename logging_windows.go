@@ -0,0 +1,12 @@
+package main
+
+import (
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// newSyslogHook fails, as there's no syslog on Windows.
+func newSyslogHook(addr string) (log.Hook, error) {
+	return nil, errors.New("syslog isn't supported on Windows")
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -9,8 +13,11 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
@@ -19,8 +26,10 @@ import (
 	macaroon "gopkg.in/macaroon.v2"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/btcsuite/btcd/btcec"
 	"github.com/btcsuite/btcutil"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
 	"github.com/lightningnetwork/lnd/macaroons"
 	"github.com/roasbeef/lseed/seed"
 )
@@ -33,31 +42,392 @@ var (
 	litecoinNodeHost = flag.String("ltc-lnd-node", "", "The host:port of the backing ltc lnd node")
 	testNodeHost     = flag.String("test-lnd-node", "", "The host:port of the backing btc testlnd node")
 
+	bitcoinRESTHost  = flag.String("btc-rest-host", "", "The host:port of the REST interface of the backing btc lnd node, polled instead of its gRPC interface whenever the latter fails or is unavailable")
+	litecoinRESTHost = flag.String("ltc-rest-host", "", "The host:port of the REST interface of the backing ltc lnd node, polled instead of its gRPC interface whenever the latter fails or is unavailable")
+	testRESTHost     = flag.String("test-rest-host", "", "The host:port of the REST interface of the backing test lnd node, polled instead of its gRPC interface whenever the latter fails or is unavailable")
+
 	bitcoinTLSPath  = flag.String("btc-tls-path", "", "The path to the TLS cert for the btc lnd node")
 	litecoinTLSPath = flag.String("ltc-tls-path", "", "The path to the TLS cert for the ltc lnd node")
 	testTLSPath     = flag.String("test-tls-path", "", "The path to the TLS cert for the test lnd node")
 
+	bitcoinTLSCABundle  = flag.String("btc-tls-ca-bundle", "", "The path to a PEM bundle of CA certs verifying the btc lnd node's cert chain, instead of -btc-tls-path, e.g. for an lnd node behind a reverse proxy")
+	litecoinTLSCABundle = flag.String("ltc-tls-ca-bundle", "", "The path to a PEM bundle of CA certs verifying the ltc lnd node's cert chain, instead of -ltc-tls-path, e.g. for an lnd node behind a reverse proxy")
+	testTLSCABundle     = flag.String("test-tls-ca-bundle", "", "The path to a PEM bundle of CA certs verifying the test lnd node's cert chain, instead of -test-tls-path, e.g. for an lnd node behind a reverse proxy")
+
 	bitcoinMacPath  = flag.String("btc-mac-path", "", "The path to the macaroon for the btc lnd node")
 	litecoinMacPath = flag.String("ltc-mac-path", "", "The path to the macaroon for the ltc lnd node")
 	testMacPath     = flag.String("test-mac-path", "", "The path to the macaroon for the test lnd node")
 
+	bitcoinStaticNodes  = flag.String("btc-static-nodes", "", "The path to a JSON file of btc nodes to serve, in the format of lnd's describegraph output")
+	litecoinStaticNodes = flag.String("ltc-static-nodes", "", "The path to a JSON file of ltc nodes to serve, in the format of lnd's describegraph output")
+	testStaticNodes     = flag.String("test-static-nodes", "", "The path to a JSON file of test nodes to serve, in the format of lnd's describegraph output")
+
+	bitcoinDefaultAddressType  = flag.String("btc-default-address-type", "both", "The address types of the btc SRV queries without an a condition: ipv4, ipv6 or both")
+	litecoinDefaultAddressType = flag.String("ltc-default-address-type", "both", "The address types of the ltc SRV queries without an a condition: ipv4, ipv6 or both")
+	testDefaultAddressType     = flag.String("test-default-address-type", "both", "The address types of the test SRV queries without an a condition: ipv4, ipv6 or both")
+
+	bitcoinFamilies  = flag.String("btc-families", "all", "Comma separated address families of the btc nodes served, out of ipv4, ipv6, tor and hostname, or all")
+	litecoinFamilies = flag.String("ltc-families", "all", "Comma separated address families of the ltc nodes served, out of ipv4, ipv6, tor and hostname, or all")
+	testFamilies     = flag.String("test-families", "all", "Comma separated address families of the test nodes served, out of ipv4, ipv6, tor and hostname, or all")
+
+	bitcoinFallbackSeeds  = flag.String("btc-fallback-seeds", "", "Comma separated domains of other btc seeds, to which queries are referred while fewer than -fallback-min-nodes btc nodes are reachable")
+	litecoinFallbackSeeds = flag.String("ltc-fallback-seeds", "", "Comma separated domains of other ltc seeds, to which queries are referred while fewer than -fallback-min-nodes ltc nodes are reachable")
+	testFallbackSeeds     = flag.String("test-fallback-seeds", "", "Comma separated domains of other test seeds, to which queries are referred while fewer than -fallback-min-nodes test nodes are reachable")
+	fallbackMinNodes      = flag.Int("fallback-min-nodes", 10, "Number of reachable nodes of a chain below which its queries are referred to its fallback seeds")
+
+	bitcoinBootstrapNodes  = flag.String("btc-bootstrap-nodes", "", "The path to a file of curated btc node public keys, one per line, served under -bootstrap-name as far as they're reachable")
+	litecoinBootstrapNodes = flag.String("ltc-bootstrap-nodes", "", "The path to a file of curated ltc node public keys, one per line, served under -bootstrap-name as far as they're reachable")
+	testBootstrapNodes     = flag.String("test-bootstrap-nodes", "", "The path to a file of curated test node public keys, one per line, served under -bootstrap-name as far as they're reachable")
+	bootstrapName          = flag.String("bootstrap-name", "", "The label under which the curated nodes of each chain are served instead of a random sample, e.g. bootstrap for bootstrap.nodes.lightning.directory. Disabled if empty")
+
 	rootDomain = flag.String("root-domain", "nodes.lightning.directory", "Root DNS seed domain.")
 
+	bitcoinRootIP  = flag.String("btc-root-ip", "", "The IP address of the authoritative name server of btc, served as its dummy record instead of -root-ip, e.g. soa.btc.nodes.lightning.directory")
+	litecoinRootIP = flag.String("ltc-root-ip", "", "The IP address of the authoritative name server of ltc, served as its dummy record instead of -root-ip, e.g. soa.ltc.nodes.lightning.directory")
+	testRootIP     = flag.String("test-root-ip", "", "The IP address of the authoritative name server of test, served as its dummy record instead of -root-ip, e.g. soa.test.nodes.lightning.directory")
+
+	bitcoinNodeIDHRP  = flag.String("btc-node-id-hrp", "", "The human readable part of the bech32 encoded btc node IDs in the node names, up to 3 lowercase letters, instead of ln")
+	litecoinNodeIDHRP = flag.String("ltc-node-id-hrp", "", "The human readable part of the bech32 encoded ltc node IDs in the node names, up to 3 lowercase letters, instead of ln")
+	testNodeIDHRP     = flag.String("test-node-id-hrp", "", "The human readable part of the bech32 encoded test node IDs in the node names, up to 3 lowercase letters, instead of ln, e.g. tln")
+
+	bitcoinSelector  = flag.String("btc-selector", "", "How the returned btc nodes are picked, instead of -selector: uniform or capacity")
+	litecoinSelector = flag.String("ltc-selector", "", "How the returned ltc nodes are picked, instead of -selector: uniform or capacity")
+	testSelector     = flag.String("test-selector", "", "How the returned test nodes are picked, instead of -selector: uniform or capacity")
+
+	bitcoinRealm  = flag.Int("btc-realm", 0, "The BOLT #10 realm byte of btc, reported with -chain-txt, the queries for another realm get no btc nodes, -1 if unknown")
+	litecoinRealm = flag.Int("ltc-realm", -1, "The BOLT #10 realm byte of ltc, reported with -chain-txt, the queries for another realm get no ltc nodes, -1 if unknown")
+	testRealm     = flag.Int("test-realm", -1, "The BOLT #10 realm byte of test, reported with -chain-txt, the queries for another realm get no test nodes, -1 if unknown")
+
 	authoritativeIP = flag.String("root-ip", "127.0.0.1", "The IP address of the authoritative name server. This is used to create a dummy record which allows clients to access the seed directly over TCP")
+	rootIPFile      = flag.String("root-ip-file", "", "A file holding the IP address of the authoritative name server, overriding -root-ip. It's read again on SIGHUP, so the address can be changed without a restart, e.g. on failover")
+	rootIPName      = flag.String("root-ip-name", "soa", "The label under which the dummy record pointing at the authoritative name server is served, e.g. soa.nodes.lightning.directory")
+	pingName        = flag.String("ping-name", "ping", "The label under which DNS-only monitors can check the health of the seed, e.g. ping.nodes.lightning.directory")
 
-	pollInterval = flag.Int("poll-interval", 600, "Time between polls to lightningd for updates")
+	maxRecvMB      = flag.Int("max-recv-mb", 50, "Initial cap in MiB on the size of the responses received from lnd, which bounds the size of the graph")
+	maxRecvMBLimit = flag.Int("max-recv-mb-limit", 500, "Cap in MiB up to which -max-recv-mb is raised when the graph outgrows it")
+	pollInterval   = flag.Int("poll-interval", 600, "Time between polls to lightningd for updates")
+	maxPolls       = flag.Int("max-concurrent-polls", 0, "Maximum number of chains polled at the same time, the others waiting for their turn, 0 for unlimited")
+
+	// maxGraphSize and maxGraphSizeLimit are the former names of
+	// -max-recv-mb and -max-recv-mb-limit, still accepted for now.
+	maxGraphSize      = flag.Int("max-graph-size", 0, "Deprecated, use -max-recv-mb")
+	maxGraphSizeLimit = flag.Int("max-graph-size-limit", 0, "Deprecated, use -max-recv-mb-limit")
+
+	parseQuery     = flag.String("parse-query", "", "Parse the given BOLT #10 query name as the seed would, print the decoded conditions and exit")
+	parseQueryType = flag.String("parse-query-type", "SRV", "The type of the query parsed with -parse-query: A, AAAA, SRV or TXT")
 
 	debug = flag.Bool("debug", false, "Be very verbose")
 
+	logOutput     = flag.String("log-output", "stdout", "Where to write the logs: stdout, syslog or file")
+	logFile       = flag.String("log-file", "", "The file to write the logs to with -log-output=file")
+	logMaxSize    = flag.Int("log-max-size", 100, "Size in megabytes after which the log file is rotated")
+	logMaxBackups = flag.Int("log-max-backups", 5, "Number of rotated log files to keep")
+	syslogAddr    = flag.String("syslog-addr", "", "Address of a remote syslog daemon to log to over UDP with -log-output=syslog, the local one is used if empty")
+
+	graphStallPolls = flag.Int("graph-stall-polls", 6, "Number of polls after which we warn if the newest node update of a chain didn't advance, hinting at a backend no longer syncing the graph, 0 to disable")
+
+	allowEmptyPolls = flag.Bool("allow-empty-polls", false, "Apply the polls of a backend returning an empty graph, rather than keeping the known nodes until it returns some again")
+
+	logEmptyNodes = flag.Bool("log-empty-nodes", false, "Log each polled node that is skipped for having no addresses, rather than just their count")
+
 	numResults = flag.Int("results", 25, "How many results shall we return to a query?")
+
+	backendStartupTimeout = flag.Int("backend-startup-timeout", 0, "Seconds to keep trying to connect to a chain's lnd node at startup, serving the other chains meanwhile, 0 requires the node to be up right away")
+
+	breakerThreshold = flag.Int("breaker-threshold", 5, "Number of consecutive failed polls after which we stop polling a backend for a while, 0 disables the circuit breaker")
+	breakerCoolDown  = flag.Int("breaker-cooldown", 1800, "Seconds to wait before polling a backend again once its circuit breaker opened")
+
+	minTTL      = flag.Uint("min-ttl", 30, "The lowest TTL in seconds we'll ever serve, regardless of other TTL settings")
+	negativeTTL = flag.Uint("negative-ttl", 60, "How long in seconds resolvers may cache our NXDOMAIN answers, served as the minimum of the SOA record, from 1 to 86400")
+
+	adaptiveTTL    = flag.Bool("adaptive-ttl", false, "Experimental: derive the TTL of each node's records from how often the node updates its announcement")
+	adaptiveTTLMin = flag.Uint("adaptive-ttl-min", 30, "Lower bound in seconds of the TTLs derived by -adaptive-ttl")
+	adaptiveTTLMax = flag.Uint("adaptive-ttl-max", 600, "Upper bound in seconds of the TTLs derived by -adaptive-ttl")
+
+	selectorName = flag.String("selector", "uniform", "How the returned nodes are picked: uniform, or capacity to favour nodes with more channel capacity")
+
+	quarantine = flag.Int("quarantine", 0, "Number of further polls a newly seen node must appear in before it's returned, 0 disables the quarantine")
+
+	modernOnly = flag.Bool("modern-only", false, "Only return nodes supporting the data loss protection and gossip queries features, for the nodes whose features are known")
+
+	excludeClient = flag.Bool("exclude-client", false, "Exclude the nodes within the client's subnet from the answers, so nodes bootstrapping from the seed don't get themselves back")
+
+	addressAnswer = flag.String("address-answer", "a", "How wildcard A and AAAA queries are answered: a, with the address records only, or srv, adding the SRV records of the nodes and their glue to the additional section")
+
+	maxQueryLabels  = flag.Int("max-query-labels", 16, "Maximum number of labels of a query name, longer names are answered with FORMERR")
+	maxQueryNameLen = flag.Int("max-query-name-length", 192, "Maximum length of a query name, longer names are answered with FORMERR")
+
+	maxAddressesPerNode = flag.Int("max-addresses-per-node", 0, "Maximum number of addresses of a node in a response, preferring one per address family, 0 for unlimited")
+	minimalUDPSize      = flag.Uint("minimal-udp-size", 0, "Answer the UDP queries advertising an EDNS0 buffer of at most this many bytes, or none if at least 512, with a minimal response, 0 to disable")
+	chainTXT            = flag.Bool("chain-txt", false, "Add a TXT record naming the chain, and realm if known, of the returned nodes to the additional section of the answers, e.g. \"chain=bitcoin\" \"realm=0\"")
+
+	shuffleAnswers  = flag.Bool("shuffle-answers", false, "Shuffle the returned nodes, so the ranking of the selector doesn't bias the order of the records")
+	answerStability = flag.Int("answer-stability", 0, "Seconds during which the same query is answered with the same nodes, for the benefit of caches in front of the seed, 0 to pick the nodes anew for every query")
+
+	requireChanUpdates = flag.Bool("require-channel-updates", false, "Only return nodes which sent at least one channel update, excluding the ones without any channel")
+	minCapacity        = flag.Int64("min-capacity", 0, "Only return nodes whose channels total at least this many satoshis, 0 to return nodes of any capacity")
+
+	addressGrace = flag.Int("address-grace", 0, "Seconds to keep returning the old addresses of a node which changed its addresses, along with the new ones, 0 replaces them right away")
+
+	asnDBPath = flag.String("asn-db", "", "The path to an ip2asn TSV database (https://iptoasn.com), enables spreading the returned nodes across autonomous systems")
+	maxPerASN = flag.Int("max-per-asn", 2, "Maximum number of returned nodes sharing an autonomous system, requires -asn-db")
+	logGeo    = flag.Bool("log-geo", false, "Log the country of the client and of the returned nodes of each query, using the country codes of -asn-db")
+
+	queryStatsFile      = flag.String("query-stats-file", "", "The path to a JSON file in which to keep hourly query counts by chain and type")
+	queryStatsRetention = flag.Int("query-stats-retention", 168, "Number of hours of query counts to keep in -query-stats-file")
+
+	nat64Prefix = flag.String("nat64-prefix", "", "A NAT64 /96 prefix, e.g. 64:ff9b::/96, used to synthesize AAAA records for IPv4-only nodes")
+
+	canaryNode = flag.String("canary-node", "", "The pubkey of a known-good node to serve under -canary-name for monitoring")
+	canaryName = flag.String("canary-name", "canary", "The label under which the canary node is served, e.g. canary.nodes.lightning.directory")
+
+	defaultChain  = flag.String("default-chain", "", "The chain serving queries which don't specify one, i.e. bitcoin, litecoin or testnet, by default bitcoin, or the first chain configured if bitcoin isn't")
+	chainRotation = flag.String("chain-rotation", "", "Comma separated chains, each optionally followed by a weight, e.g. bitcoin:3,testnet:1, across which the queries which don't specify a chain are spread in a weighted round-robin instead of serving them from -default-chain. Disabled if empty")
+
+	runAsUser  = flag.String("user", "", "The user to switch to once the listeners are bound (Linux only)")
+	runAsGroup = flag.String("group", "", "The group to switch to once the listeners are bound, defaults to the primary group of -user (Linux only)")
+
+	staleAfter = flag.Int("stale-after", 0, "Seconds without a successful poll of a chain after which its queries are answered with SERVFAIL, e.g. 3 poll intervals, 0 to keep serving the last known nodes")
+	serveStale = flag.Bool("serve-stale", false, "Keep serving the last known nodes, with short TTLs, when a chain wasn't polled successfully for -stale-after, instead of failing queries")
+	agingTTL   = flag.Bool("aging-ttl", false, "Reduce the TTLs of a chain's records as its last successful poll ages, reaching those of the stale responses as it goes stale, requires -stale-after")
+
+	responseCacheTTL = flag.Int("response-cache-ttl", 0, "Seconds to cache the responses to wildcard queries for, 0 disables the cache")
+	warmCache        = flag.Bool("warm-cache", false, "Render the responses to the default queries of each chain into the cache after every poll, requires -response-cache-ttl")
+	answerDeadline   = flag.Int("answer-deadline", 0, "Milliseconds within which the nodes of an answer must be selected, past which it's cut down to the best node, 0 disables the deadline")
+
+	familyMinNodes      = flag.Int("family-min-nodes", 1, "Minimum number of reachable nodes of each address family for the family to be reported healthy in /status")
+	familyCheckMinNodes = flag.Int("family-check-min-nodes", 20, "Only report address families unhealthy once a chain has at least this many reachable nodes")
+
+	peerDigestURL      = flag.String("peer-digest-url", "", "The digest endpoint of another seed, e.g. http://seed2:9091/digest, whose views are periodically compared with ours to detect drift, disabled if empty")
+	peerDigestInterval = flag.Int("peer-digest-interval", 300, "Seconds between the comparisons of our views with those of -peer-digest-url")
+
+	grpcListen = flag.String("grpc-listen", "", "Listen address of the read-only gRPC API, e.g. localhost:9092, disabled if empty")
+
+	maxTCPConns    = flag.Int("tcp-max-conns", 256, "Maximum number of concurrently handled TCP connections, 0 for unlimited")
+	tcpReadTimeout = flag.Int("tcp-read-timeout", 2, "Seconds a TCP connection is kept open waiting for its first query")
+	tcpIdleTimeout = flag.Int("tcp-idle-timeout", 8, "Seconds a TCP connection is kept open waiting for a further query once a query was answered")
+	tcpProxyProto  = flag.Bool("tcp-proxy-protocol", false, "Expect a PROXY protocol v1 or v2 header holding the client address on each TCP connection, only set if they all come from a trusted load balancer")
+
+	udpWorkers    = flag.Int("udp-workers", 64, "Maximum number of concurrently processed UDP queries, 0 for unlimited")
+	udpQueueDepth = flag.Int("udp-queue-depth", 1024, "Number of UDP queries per socket waiting for a worker, beyond which queries are dropped, requires -udp-workers")
+
+	answerHMACSecretFile = flag.String("answer-hmac-secret-file", "", "The path to a file holding a shared secret with which to sign responses with TSIG (HMAC-SHA256), under the key named after -root-domain, for private seeds whose trusted clients check them")
+
+	serveVersion = flag.Bool("serve-version", false, "Serve the version of lseed as a TXT record under version.<root-domain>")
 )
 
+// version and commit identify the build, and are set at link time, e.g. with
+// -ldflags "-X main.version=v0.1.0 -X main.commit=$(git rev-parse HEAD)".
 var (
-	lndHomeDir = btcutil.AppDataDir("lnd", false)
+	version = "dev"
+	commit  = ""
+)
+
+// buildVersion returns the version of the build, including the commit if
+// known.
+func buildVersion() string {
+	if commit == "" {
+		return version
+	}
+
+	return version + "-" + commit
+}
+
+// readRootIP reads the address of the authoritative name server from path.
+func readRootIP(path string) (net.IP, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return seed.ParseAuthoritativeIP(strings.TrimSpace(string(b)))
+}
+
+// reloadRootIP reads the address of the authoritative name server from path
+// again on every SIGHUP, and applies it to the DNS server. An invalid address
+// is logged and the previous one kept. It never returns.
+func reloadRootIP(dnsServer *seed.DnsServer, path string) {
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+
+	for range hupChan {
+		rootIP, err := readRootIP(path)
+		if err != nil {
+			log.Errorf("Unable to reload the root IP, keeping %v: %v",
+				dnsServer.AuthoritativeIP(), err)
+			continue
+		}
+
+		log.Infof("Reloaded the root IP: %v", rootIP)
+		dnsServer.SetAuthoritativeIP(rootIP)
+	}
+}
+
+// minHMACSecretLen is the minimum length of the secret with which responses
+// are signed.
+const minHMACSecretLen = 16
+
+// readHMACSecret reads the secret with which to sign responses from path,
+// ignoring surrounding whitespace.
+func readHMACSecret(path string) ([]byte, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := bytes.TrimSpace(b)
+	if len(secret) < minHMACSecretLen {
+		return nil, fmt.Errorf("the secret must be at least %d bytes",
+			minHMACSecretLen)
+	}
+
+	return secret, nil
+}
+
+// servedVersion returns the version to serve over DNS, empty if disabled.
+func servedVersion() string {
+	if !*serveVersion {
+		return ""
+	}
+
+	return buildVersion()
+}
+
+// chainConfig describes the command line configuration of a single chain.
+type chainConfig struct {
+	// name is the name of the chain, e.g. bitcoin.
+	name string
+
+	// ticker is the short name of the chain used in log messages.
+	ticker string
+
+	// prefix is the sub-domain under which the chain is served.
+	prefix string
+
+	nodeHost    *string
+	tlsPath     *string
+	macPath     *string
+	staticNodes *string
+
+	// tlsCABundle, if set, is used to verify the certificate chain of
+	// the lnd node instead of pinning its self-signed cert at tlsPath.
+	tlsCABundle *string
+
+	// restHost, if set, is the REST interface of the lnd node, which is
+	// polled while its gRPC interface keeps failing.
+	restHost *string
+
+	// defaultAddressType are the address types of the queries which
+	// don't specify any.
+	defaultAddressType *string
+
+	// families are the address families of the nodes served.
+	families *string
+
+	// fallbackSeeds are the other seeds of the chain to which queries are
+	// referred while we know too few nodes.
+	fallbackSeeds *string
+
+	// bootstrapNodes is the file of the curated nodes served under the
+	// bootstrap name.
+	bootstrapNodes *string
 
-	maxMsgRecvSize = grpc.MaxCallRecvMsgSize(1 * 1024 * 1024 * 50)
+	// rootIP is the address of the authoritative name server of the
+	// chain, if it differs from the global one.
+	rootIP *string
+
+	// nodeIDHRP is the human readable part of the node IDs of the chain,
+	// if it differs from the default one.
+	nodeIDHRP *string
+
+	// selector is the name of the selector picking the nodes of the
+	// chain, if it differs from the global one.
+	selector *string
+
+	// realm is the BOLT #10 realm byte of the chain, or -1 if unknown.
+	realm *int
+}
+
+// chains are all the chains we know how to serve.
+var chains = []*chainConfig{
+	{
+		name:        "bitcoin",
+		ticker:      "BTC",
+		prefix:      "",
+		nodeHost:    bitcoinNodeHost,
+		restHost:    bitcoinRESTHost,
+		tlsPath:     bitcoinTLSPath,
+		macPath:     bitcoinMacPath,
+		staticNodes: bitcoinStaticNodes,
+		tlsCABundle: bitcoinTLSCABundle,
+
+		defaultAddressType: bitcoinDefaultAddressType,
+		families:           bitcoinFamilies,
+		fallbackSeeds:      bitcoinFallbackSeeds,
+		bootstrapNodes:     bitcoinBootstrapNodes,
+		rootIP:             bitcoinRootIP,
+		nodeIDHRP:          bitcoinNodeIDHRP,
+		selector:           bitcoinSelector,
+		realm:              bitcoinRealm,
+	},
+	{
+		name:        "litecoin",
+		ticker:      "LTC",
+		prefix:      "ltc.",
+		nodeHost:    litecoinNodeHost,
+		restHost:    litecoinRESTHost,
+		tlsPath:     litecoinTLSPath,
+		macPath:     litecoinMacPath,
+		staticNodes: litecoinStaticNodes,
+		tlsCABundle: litecoinTLSCABundle,
+
+		defaultAddressType: litecoinDefaultAddressType,
+		families:           litecoinFamilies,
+		fallbackSeeds:      litecoinFallbackSeeds,
+		bootstrapNodes:     litecoinBootstrapNodes,
+		rootIP:             litecoinRootIP,
+		nodeIDHRP:          litecoinNodeIDHRP,
+		selector:           litecoinSelector,
+		realm:              litecoinRealm,
+	},
+	{
+		name:        "testnet",
+		ticker:      "TBTC",
+		prefix:      "test.",
+		nodeHost:    testNodeHost,
+		restHost:    testRESTHost,
+		tlsPath:     testTLSPath,
+		macPath:     testMacPath,
+		staticNodes: testStaticNodes,
+		tlsCABundle: testTLSCABundle,
+
+		defaultAddressType: testDefaultAddressType,
+		families:           testFamilies,
+		fallbackSeeds:      testFallbackSeeds,
+		bootstrapNodes:     testBootstrapNodes,
+		rootIP:             testRootIP,
+		nodeIDHRP:          testNodeIDHRP,
+		selector:           testSelector,
+		realm:              testRealm,
+	},
+}
+
+var (
+	lndHomeDir = btcutil.AppDataDir("lnd", false)
 )
 
+// backendRetryInterval is how long we wait between attempts to connect to a
+// backend during its startup grace period.
+const backendRetryInterval = 5 * time.Second
+
+// maxPollHold is how long a poll may hold its slot of -max-concurrent-polls,
+// after which the other chains are let through even if it's still running.
+const maxPollHold = 5 * time.Minute
+
+// pollLimiter caps the number of chains polled at the same time, nil if
+// they aren't capped.
+var pollLimiter *seed.PollLimiter
+
 // cleanAndExpandPath expands environment variables and leading ~ in the passed
 // path, cleans the result, and returns it.
 // This function is taken from https://github.com/btcsuite/btcd
@@ -73,15 +443,63 @@ func cleanAndExpandPath(path string) string {
 	return filepath.Clean(os.ExpandEnv(path))
 }
 
-// initLightningClient attempts to initialize, and connect out to the backing
-// lnd node as specified by the lndNode ccommand line flag.
-func initLightningClient(nodeHost, tlsCertPath, macPath string) (lnrpc.LightningClient, error) {
+// tlsConfig returns the TLS config verifying the lnd node of a chain. By
+// default, the node's self-signed cert is pinned, but if a CA bundle is
+// configured, the full certificate chain the node presents is verified
+// against it instead, as is the host name.
+func tlsConfig(chain *chainConfig) (*tls.Config, error) {
+	if *chain.tlsCABundle == "" {
+		tlsCertPath := cleanAndExpandPath(*chain.tlsPath)
+		cert, err := ioutil.ReadFile(tlsCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read cert file: %v", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("unable to read cert file: no "+
+				"certificate found in %v", tlsCertPath)
+		}
+
+		return &tls.Config{RootCAs: pool}, nil
+	}
+
+	bundle, err := ioutil.ReadFile(cleanAndExpandPath(*chain.tlsCABundle))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA bundle: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificate found in CA bundle %v",
+			*chain.tlsCABundle)
+	}
+
+	return &tls.Config{RootCAs: pool}, nil
+}
+
+// tlsCredentials returns the TLS credentials verifying the lnd node of a
+// chain, see tlsConfig.
+func tlsCredentials(chain *chainConfig) (credentials.TransportCredentials,
+	error) {
+
+	cfg, err := tlsConfig(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(cfg), nil
+}
+
+// initLightningClient attempts to initialize, and connect out to the lnd node
+// backing the chain.
+func initLightningClient(chain *chainConfig) (lnrpc.LightningClient, error) {
+	nodeHost, macPath := *chain.nodeHost, *chain.macPath
 
 	// First attempt to establish a connection to lnd's RPC sever.
-	tlsCertPath = cleanAndExpandPath(tlsCertPath)
-	creds, err := credentials.NewClientTLSFromFile(tlsCertPath, "")
+	creds, err := tlsCredentials(chain)
 	if err != nil {
-		return nil, fmt.Errorf("unable to read cert file: %v", err)
+		return nil, err
 	}
 	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
 
@@ -101,11 +519,13 @@ func initLightningClient(nodeHost, tlsCertPath, macPath string) (lnrpc.Lightning
 		opts,
 		grpc.WithPerRPCCredentials(macaroons.NewMacaroonCredential(mac)),
 	)
-	opts = append(opts, grpc.WithDefaultCallOptions(maxMsgRecvSize))
+	opts = append(opts, grpc.WithDefaultCallOptions(
+		grpc.MaxCallRecvMsgSize(*maxRecvMB*mib),
+	))
 
 	conn, err := grpc.Dial(nodeHost, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("unable to dial to lnd's gRPC server: ",
+		return nil, fmt.Errorf("unable to dial to lnd's gRPC server: %v",
 			err)
 	}
 
@@ -114,40 +534,158 @@ func initLightningClient(nodeHost, tlsCertPath, macPath string) (lnrpc.Lightning
 	lnd := lnrpc.NewLightningClient(conn)
 
 	// Before we proceed, make sure that we can query the target node.
+	// Otherwise, the connection is of no use, and would leak as we retry.
 	_, err = lnd.GetInfo(
 		context.Background(), &lnrpc.GetInfoRequest{},
 	)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
 	return lnd, nil
 }
 
+// newCircuitBreaker creates a circuit breaker for a chain backend as
+// configured by the command line flags.
+func newCircuitBreaker() *seed.CircuitBreaker {
+	return seed.NewCircuitBreaker(
+		*breakerThreshold, time.Second*time.Duration(*breakerCoolDown),
+	)
+}
+
 // poller regularly polls the backing lnd node and updates the local network
-// view.
-func poller(lnd lnrpc.LightningClient, nview *seed.NetworkView) {
+// view. If given, the REST interface of the node is polled instead whenever
+// the gRPC one fails, while its circuit breaker is open, or if we couldn't
+// connect to it at all. Otherwise those polls are skipped.
+func poller(chainView *seed.ChainView, rest *restGraphFetcher) {
+	var (
+		nview   = chainView.NetView
+		breaker = chainView.Breaker
+
+		// fetcher is nil if only the REST interface is available.
+		fetcher *graphFetcher
+
+		// transport is the interface of the node the last successful
+		// poll went through.
+		transport = "gRPC"
+	)
+	if chainView.Node != nil {
+		fetcher = newGraphFetcher(chainView.Node, nview.Chain())
+	} else {
+		transport = "REST"
+	}
+
+	// useTransport notes that a poll succeeded through transport, logging
+	// when we switch from one to the other.
+	useTransport := func(t string) {
+		if t != transport {
+			log.Infof("Polling the %v backend over %v", nview.Chain(),
+				t)
+			transport = t
+		}
+	}
+
 	scrapeGraph := func() {
-		graphReq := &lnrpc.ChannelGraphRequest{}
-		graph, err := lnd.DescribeGraph(
-			context.Background(), graphReq,
+		release := pollLimiter.Acquire(nview.Chain())
+		defer release()
+
+		var (
+			graph *lnrpc.ChannelGraph
+			err   error
 		)
-		if err != nil {
+
+		switch {
+		case fetcher != nil && breaker.Allow():
+			start := time.Now()
+			graph, err = fetcher.describeGraph()
+			chainView.PollLatency.Observe(time.Since(start))
+			if err != nil {
+				breaker.Failure()
+				log.Errorf("Unable to poll %v backend (breaker=%v): %v",
+					nview.Chain(), breaker.State(), err)
+
+				// If gRPC failed, we'll fall back to REST
+				// right away.
+				if rest == nil {
+					return
+				}
+				break
+			}
+			breaker.Success()
+			useTransport("gRPC")
+
+		case rest == nil:
+			log.Debugf("Circuit breaker for %v is open, skipping poll",
+				nview.Chain())
 			return
 		}
 
+		if graph == nil {
+			start := time.Now()
+			graph, err = rest.describeGraph()
+			chainView.PollLatency.Observe(time.Since(start))
+			if err != nil {
+				log.Errorf("Unable to poll %v backend over REST: %v",
+					nview.Chain(), err)
+				return
+			}
+			useTransport("REST")
+		}
+
 		log.Debugf("Got %d nodes from lnd", len(graph.Nodes))
+
+		// Many nodes in the graph legitimately have no addresses, so
+		// we'll only count those unless asked to log each of them.
+		var numEmpty int
+		nodes := make([]*lnrpc.LightningNode, 0, len(graph.Nodes))
 		for _, node := range graph.Nodes {
 			if len(node.Addresses) == 0 {
+				numEmpty++
+				if *logEmptyNodes {
+					log.Debugf("Skipping node %v without "+
+						"addresses", node.PubKey)
+				}
 				continue
 			}
 
-			if _, err := nview.AddNode(node); err != nil {
-				log.Debugf("Unable to add node: %v", err)
-			} else {
-				log.Debugf("Adding node: %v", node.Addresses)
+			nodes = append(nodes, node)
+		}
+
+		// The capacity of a node is the total capacity of its
+		// channels. The policies of an edge are set once the
+		// respective node sent a channel update.
+		capacities := make(map[string]int64)
+		channelUpdates := make(map[string]struct{})
+		for _, edge := range graph.Edges {
+			capacities[edge.Node1Pub] += edge.Capacity
+			capacities[edge.Node2Pub] += edge.Capacity
+
+			if edge.Node1Policy != nil {
+				channelUpdates[edge.Node1Pub] = struct{}{}
+			}
+			if edge.Node2Policy != nil {
+				channelUpdates[edge.Node2Pub] = struct{}{}
 			}
 		}
+
+		// The whole poll is applied at once, so the queries neither
+		// contend with it for the view nor see it half applied.
+		added, numFailed := nview.ApplyPoll(&seed.PollResult{
+			Nodes:          nodes,
+			Capacities:     capacities,
+			ChannelUpdates: channelUpdates,
+			ChannelStats:   seed.NodeChannelStats(graph.Edges),
+		})
+		for _, n := range added {
+			log.Debugf("Adding node: %v", n.Addresses)
+		}
+		nview.CheckClockSkew()
+		nview.CheckGraphProgress(*graphStallPolls)
+
+		log.Debugf("Polled %d %v nodes: %d without addresses, %d "+
+			"failed to add", len(graph.Nodes), nview.Chain(),
+			numEmpty, numFailed)
 	}
 
 	scrapeGraph()
@@ -158,9 +696,220 @@ func poller(lnd lnrpc.LightningClient, nview *seed.NetworkView) {
 	}
 }
 
+// chainPrefix returns the sub-domain prefix of the chain with the given
+// name.
+func chainPrefix(name string) (string, error) {
+	for _, chain := range chains {
+		if chain.name == name {
+			return chain.prefix, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown chain %v", name)
+}
+
+// firstChainPrefix returns the prefix of the first of the chains, in the order
+// we know them, which is configured in chainViews, so bitcoin unless it isn't
+// served.
+func firstChainPrefix(chainViews map[string]*seed.ChainView) string {
+	for _, chain := range chains {
+		if _, ok := chainViews[chain.prefix]; ok {
+			return chain.prefix
+		}
+	}
+
+	return ""
+}
+
+// parseChainRotation parses the -chain-rotation flag, a comma separated list
+// of chain names, each optionally followed by a colon and its weight, 1 by
+// default. The chains must be among the configured chainViews.
+func parseChainRotation(s string,
+	chainViews map[string]*seed.ChainView) (*seed.ChainRotation, error) {
+
+	var (
+		prefixes []string
+		weights  []int
+	)
+	for _, entry := range strings.Split(s, ",") {
+		name, weight := entry, 1
+		if i := strings.IndexByte(entry, ':'); i != -1 {
+			var err error
+			name = entry[:i]
+			weight, err = strconv.Atoi(entry[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight of %v: %v",
+					name, err)
+			}
+		}
+
+		prefix, err := chainPrefix(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := chainViews[prefix]; !ok {
+			return nil, fmt.Errorf("%v isn't configured", name)
+		}
+		prefixes = append(prefixes, prefix)
+		weights = append(weights, weight)
+	}
+
+	return seed.NewChainRotation(prefixes, weights)
+}
+
+// initChainView creates the chain view of a chain as configured on the
+// command line. A chain can either be backed by an lnd node, by a static
+// file of nodes, or both in which case the static nodes are fed into the
+// view in addition to the polled ones. If the chain isn't configured nil is
+// returned.
+func initChainView(chain *chainConfig) (*seed.ChainView, error) {
+	haveNode := *chain.nodeHost != "" && *chain.macPath != "" &&
+		(*chain.tlsPath != "" || *chain.tlsCABundle != "")
+
+	var (
+		staticNodes    []*lnrpc.LightningNode
+		staticFeatures map[string]*lnwire.RawFeatureVector
+	)
+	if *chain.staticNodes != "" {
+		path := cleanAndExpandPath(*chain.staticNodes)
+
+		var err error
+		staticNodes, err = seed.ReadNodesFile(path)
+		if err != nil {
+			return nil, err
+		}
+		staticFeatures, err = seed.ReadNodeFeatures(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	// Without a backing node, we'll serve the static nodes as is. The
+	// chain is served even if the file holds no node, since it was
+	// configured nonetheless.
+	case !haveNode && *chain.staticNodes != "":
+		log.Infof("Creating static %v chain view with %d nodes",
+			chain.ticker, len(staticNodes))
+
+		nView := seed.NewStaticNetworkView(chain.name, staticNodes)
+		for id, features := range staticFeatures {
+			nView.SetNodeFeatures(id, features)
+		}
+		return &seed.ChainView{
+			NetView: nView,
+		}, nil
+
+	case !haveNode:
+		return nil, nil
+	}
+
+	log.Infof("Creating %v chain view", chain.ticker)
+
+	nView := seed.NewNetworkView(chain.name)
+	for _, node := range staticNodes {
+		if _, err := nView.AddNode(node); err != nil {
+			log.Debugf("Unable to add static node: %v", err)
+		}
+	}
+	for id, features := range staticFeatures {
+		nView.SetNodeFeatures(id, features)
+	}
+
+	chainView := &seed.ChainView{
+		NetView:     nView,
+		Breaker:     newCircuitBreaker(),
+		PollLatency: seed.NewLatencyTracker(),
+	}
+
+	var rest *restGraphFetcher
+	if *chain.restHost != "" {
+		var err error
+		rest, err = newRESTGraphFetcher(chain)
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the REST "+
+				"fallback: %v", err)
+		}
+	}
+
+	// Without a grace period, the backend must be up right away, unless
+	// it can be polled over REST alone.
+	if *backendStartupTimeout == 0 {
+		lndNode, err := initLightningClient(chain)
+		switch {
+		case err != nil && rest == nil:
+			return nil, fmt.Errorf("unable to connect to lnd: %v", err)
+
+		case err != nil:
+			log.Warnf("Unable to connect to the %v lnd node over "+
+				"gRPC, polling it over REST only: %v",
+				chain.ticker, err)
+		}
+
+		chainView.Node = lndNode
+		go poller(chainView, rest)
+
+		log.Infof("%v chain view active", chain.ticker)
+
+		return chainView, nil
+	}
+
+	// Otherwise, we'll wait for it in the background, so the other chains
+	// can be served meanwhile.
+	go func() {
+		lndNode, err := waitForLightningClient(chain)
+		switch {
+		case err != nil && rest == nil:
+			log.Errorf("Giving up on the %v chain: %v", chain.ticker,
+				err)
+			return
+
+		case err != nil:
+			log.Warnf("Unable to connect to the %v lnd node over "+
+				"gRPC, polling it over REST only: %v",
+				chain.ticker, err)
+		}
+
+		chainView.Node = lndNode
+		go poller(chainView, rest)
+
+		log.Infof("%v chain view active", chain.ticker)
+	}()
+
+	return chainView, nil
+}
+
+// waitForLightningClient repeatedly tries to connect to the lnd node backing
+// the chain, until it succeeds or -backend-startup-timeout elapsed. This
+// allows lnd to start, and be unlocked, along with the seed.
+func waitForLightningClient(chain *chainConfig) (lnrpc.LightningClient, error) {
+	deadline := time.Now().Add(
+		time.Second * time.Duration(*backendStartupTimeout),
+	)
+
+	for {
+		lndNode, err := initLightningClient(chain)
+		if err == nil {
+			return lndNode, nil
+		}
+
+		if time.Now().Add(backendRetryInterval).After(deadline) {
+			return nil, fmt.Errorf("unable to connect to lnd: %v",
+				err)
+		}
+
+		log.Infof("Unable to connect to the %v lnd node, retrying in "+
+			"%v: %v", chain.ticker, backendRetryInterval, err)
+		time.Sleep(backendRetryInterval)
+	}
+}
+
 // Parse flags and configure subsystems according to flags
 func configure() {
 	flag.Parse()
+	if err := configureLogOutput(); err != nil {
+		panic(fmt.Sprintf("invalid log output: %v", err))
+	}
 	if *debug {
 		log.SetLevel(log.DebugLevel)
 		log.Infof("Logging on level Debug")
@@ -176,82 +925,398 @@ func main() {
 
 	configure()
 
-	go func() {
-		log.Println(http.ListenAndServe(":9091", nil))
-	}()
+	if *parseQuery != "" {
+		os.Exit(runParseQuery())
+	}
+
+	log.Infof("Starting lseed %v", buildVersion())
+
+	if *maxGraphSize != 0 {
+		log.Warnf("-max-graph-size is deprecated, use -max-recv-mb")
+		*maxRecvMB = *maxGraphSize
+	}
+	if *maxGraphSizeLimit != 0 {
+		log.Warnf("-max-graph-size-limit is deprecated, use " +
+			"-max-recv-mb-limit")
+		*maxRecvMBLimit = *maxGraphSizeLimit
+	}
+	if *maxRecvMB <= 0 || *maxRecvMBLimit < *maxRecvMB {
+		panic("max-recv-mb must be positive, and at most " +
+			"max-recv-mb-limit")
+	}
+
+	if *graphStallPolls < 0 {
+		panic("graph-stall-polls must not be negative")
+	}
+
+	if *tcpReadTimeout <= 0 || *tcpIdleTimeout <= 0 {
+		panic("tcp-read-timeout and tcp-idle-timeout must be positive")
+	}
+
+	if *maxAddressesPerNode < 0 {
+		panic("max-addresses-per-node must not be negative")
+	}
+
+	if *staleAfter < 0 {
+		panic("stale-after must not be negative")
+	}
+	if *agingTTL && *staleAfter == 0 {
+		panic("aging-ttl requires stale-after")
+	}
+
+	if *minimalUDPSize > 65535 {
+		panic("minimal-udp-size must be at most 65535")
+	}
+
+	if *peerDigestInterval <= 0 {
+		panic("peer-digest-interval must be positive")
+	}
+
+	if *negativeTTL == 0 || *negativeTTL > seed.MaxNegativeTTL {
+		panic(fmt.Sprintf("negative-ttl must be between 1 and %d "+
+			"seconds", seed.MaxNegativeTTL))
+	}
+
+	if *addressAnswer != "a" && *addressAnswer != "srv" {
+		panic(fmt.Sprintf("invalid address-answer: %v", *addressAnswer))
+	}
+
+	if *maxQueryLabels <= 0 || *maxQueryNameLen <= 0 {
+		panic("max-query-labels and max-query-name-length must be " +
+			"positive")
+	}
+
+	if *maxPolls < 0 {
+		panic("max-concurrent-polls must not be negative")
+	}
+	if *maxPolls > 0 {
+		pollLimiter = seed.NewPollLimiter(*maxPolls, maxPollHold)
+	}
+
+	selector, err := seed.SelectorByName(*selectorName)
+	if err != nil {
+		panic(fmt.Sprintf("invalid selector: %v", err))
+	}
 
 	netViewMap := make(map[string]*seed.ChainView)
+	nodeIDHRPs := make(map[string]string)
+	for _, chain := range chains {
+		chainView, err := initChainView(chain)
+		if err != nil {
+			panic(fmt.Sprintf("unable to create %v chain view: %v",
+				chain.ticker, err))
+		}
+		if chainView == nil {
+			continue
+		}
 
-	if *bitcoinNodeHost != "" && *bitcoinTLSPath != "" && *bitcoinMacPath != "" {
-		log.Infof("Creating BTC chain view")
+		atypes, err := seed.ParseAddressTypes(*chain.defaultAddressType)
+		if err != nil {
+			panic(fmt.Sprintf("invalid %v default address type: %v",
+				chain.ticker, err))
+		}
+		chainView.NetView.SetDefaultAddressTypes(atypes)
 
-		lndNode, err := initLightningClient(
-			*bitcoinNodeHost, *bitcoinTLSPath, *bitcoinMacPath,
+		families, err := seed.ParseFamilies(*chain.families)
+		if err != nil {
+			panic(fmt.Sprintf("invalid %v families: %v",
+				chain.ticker, err))
+		}
+		chainView.NetView.SetAllowedFamilies(families)
+
+		chainView.FallbackSeeds, err = seed.ParseSeedList(
+			*chain.fallbackSeeds,
 		)
 		if err != nil {
-			panic(fmt.Sprintf("unable to connect to btc lnd: %v", err))
+			panic(fmt.Sprintf("invalid %v fallback seeds: %v",
+				chain.ticker, err))
+		}
+
+		if *chain.bootstrapNodes != "" {
+			path := cleanAndExpandPath(*chain.bootstrapNodes)
+			chainView.BootstrapNodes, err = seed.ReadNodeIDs(path)
+			if err != nil {
+				panic(fmt.Sprintf("unable to read %v bootstrap "+
+					"nodes: %v", chain.ticker, err))
+			}
+			if *bootstrapName == "" {
+				log.Warnf("The %v bootstrap nodes won't be "+
+					"served without -bootstrap-name",
+					chain.ticker)
+			}
 		}
 
-		nView := seed.NewNetworkView("bitcoin")
-		go poller(lndNode, nView)
+		if *chain.rootIP != "" {
+			chainView.AuthoritativeIP, err = seed.ParseAuthoritativeIP(
+				*chain.rootIP,
+			)
+			if err != nil {
+				panic(fmt.Sprintf("invalid %v root-ip: %v",
+					chain.ticker, err))
+			}
+		}
 
-		log.Infof("BTC chain view active")
+		if hrp := *chain.nodeIDHRP; hrp != "" {
+			if err := seed.ValidateNodeIDHRP(hrp); err != nil {
+				panic(fmt.Sprintf("invalid %v node-id-hrp: %v",
+					chain.ticker, err))
+			}
+			if other, ok := nodeIDHRPs[hrp]; ok {
+				panic(fmt.Sprintf("%v and %v can't share the "+
+					"node-id-hrp %v", other, chain.ticker, hrp))
+			}
+			nodeIDHRPs[hrp] = chain.ticker
 
-		netViewMap[""] = &seed.ChainView{
-			NetView: nView,
-			Node:    lndNode,
+			chainView.NodeIDHRP = hrp
+		}
+
+		chainSelector := selector
+		if *chain.selector != "" {
+			chainSelector, err = seed.SelectorByName(*chain.selector)
+			if err != nil {
+				panic(fmt.Sprintf("invalid %v selector: %v",
+					chain.ticker, err))
+			}
+		}
+		chainView.NetView.SetSelector(chainSelector)
+
+		if *chain.realm < -1 || *chain.realm > 255 {
+			panic(fmt.Sprintf("%v realm must be between -1 and 255",
+				chain.ticker))
+		}
+		if *chain.realm >= 0 {
+			chainView.Realm = uint8(*chain.realm)
+			chainView.HasRealm = true
 		}
 
+		netViewMap[chain.prefix] = chainView
 	}
 
-	if *litecoinNodeHost != "" && *litecoinTLSPath != "" && *litecoinMacPath != "" {
-		log.Infof("Creating LTC chain view")
+	if len(netViewMap) == 0 {
+		panic(fmt.Sprintf("must specify at least one node type, " +
+			"either a backing lnd node or a static node file"))
+	}
 
-		lndNode, err := initLightningClient(
-			*litecoinNodeHost, *litecoinTLSPath, *litecoinMacPath,
-		)
+	defaultPrefix := firstChainPrefix(netViewMap)
+	if *defaultChain != "" {
+		defaultPrefix, err = chainPrefix(*defaultChain)
 		if err != nil {
-			panic(fmt.Sprintf("unable to connect to ltc lnd: %v", err))
+			panic(fmt.Sprintf("invalid default-chain: %v", err))
+		}
+		if _, ok := netViewMap[defaultPrefix]; !ok {
+			panic(fmt.Sprintf("default-chain %v isn't configured",
+				*defaultChain))
 		}
+	}
 
-		nView := seed.NewNetworkView("litecoin")
-		go poller(lndNode, nView)
+	var rotation *seed.ChainRotation
+	if *chainRotation != "" {
+		rotation, err = parseChainRotation(*chainRotation, netViewMap)
+		if err != nil {
+			panic(fmt.Sprintf("invalid chain-rotation: %v", err))
+		}
+	}
 
-		netViewMap["ltc."] = &seed.ChainView{
-			NetView: nView,
-			Node:    lndNode,
+	var asnDB *seed.ASNDB
+	if *asnDBPath != "" {
+		var err error
+		asnDB, err = seed.LoadASNDB(cleanAndExpandPath(*asnDBPath))
+		if err != nil {
+			panic(fmt.Sprintf("unable to load ASN database: %v", err))
+		}
+		for _, chainView := range netViewMap {
+			chainView.NetView.SetASNDiversity(asnDB, *maxPerASN)
 		}
+	}
 
+	// Geolocation relies on the country codes of the ASN database, so
+	// without one there's nothing to log.
+	var geoDB *seed.ASNDB
+	if *logGeo {
+		if asnDB == nil {
+			log.Warnf("-log-geo requires -asn-db, not logging the " +
+				"countries of the queries")
+		}
+		geoDB = asnDB
 	}
-	if *testNodeHost != "" && *testTLSPath != "" && *testMacPath != "" {
-		log.Infof("Creating BTC testnet chain view")
 
-		lndNode, err := initLightningClient(
-			*testNodeHost, *testTLSPath, *testMacPath,
+	if *answerDeadline < 0 {
+		panic("answer-deadline must not be negative")
+	}
+	if *minCapacity < 0 {
+		panic("min-capacity must not be negative")
+	}
+	if *addressGrace < 0 {
+		panic("address-grace must not be negative")
+	}
+	if *answerStability < 0 {
+		panic("answer-stability must not be negative")
+	}
+
+	for _, chainView := range netViewMap {
+		chainView.NetView.SetQuarantine(*quarantine)
+		chainView.NetView.RequireChannelUpdates(*requireChanUpdates)
+		chainView.NetView.SetMinCapacity(btcutil.Amount(*minCapacity))
+		chainView.NetView.SetAllowEmptyPolls(*allowEmptyPolls)
+		chainView.NetView.SetAddressGrace(
+			time.Duration(*addressGrace) * time.Second,
+		)
+		chainView.NetView.SetAnswerStability(
+			time.Duration(*answerStability) * time.Second,
+		)
+		if *modernOnly {
+			chainView.NetView.SetRequiredFeatures(
+				seed.ModernFeatures...,
+			)
+		}
+	}
+	if *modernOnly {
+		log.Warnf("The features of the nodes are only known from " +
+			"static node files, -modern-only doesn't filter the " +
+			"nodes polled from lnd")
+	}
+
+	var queryStats *seed.QueryStats
+	if *queryStatsFile != "" {
+		if *queryStatsRetention <= 0 {
+			panic("query-stats-retention must be positive")
+		}
+
+		var err error
+		queryStats, err = seed.NewQueryStats(
+			cleanAndExpandPath(*queryStatsFile), *queryStatsRetention,
 		)
 		if err != nil {
-			panic(fmt.Sprintf("unable to connect to test lnd: %v", err))
+			panic(fmt.Sprintf("unable to open query stats: %v", err))
 		}
+		go queryStats.Run()
+	}
 
-		nView := seed.NewNetworkView("testnet")
-		go poller(lndNode, nView)
+	var nat64Net *net.IPNet
+	if *nat64Prefix != "" {
+		var err error
+		nat64Net, err = seed.ParseNAT64Prefix(*nat64Prefix)
+		if err != nil {
+			panic(fmt.Sprintf("invalid nat64-prefix: %v", err))
+		}
+	}
 
-		log.Infof("TBCT chain view active")
+	if *canaryNode != "" {
+		pubKey, err := hex.DecodeString(*canaryNode)
+		if err == nil {
+			_, err = btcec.ParsePubKey(pubKey, btcec.S256())
+		}
+		if err != nil {
+			panic(fmt.Sprintf("invalid canary-node: %v", err))
+		}
+	}
 
-		netViewMap["test."] = &seed.ChainView{
-			NetView: nView,
-			Node:    lndNode,
+	rootIP, err := seed.ParseAuthoritativeIP(*authoritativeIP)
+	if err != nil {
+		panic(fmt.Sprintf("invalid root-ip: %v", err))
+	}
+	if *rootIPFile != "" {
+		rootIP, err = readRootIP(*rootIPFile)
+		if err != nil {
+			panic(fmt.Sprintf("invalid root-ip-file: %v", err))
 		}
 	}
 
-	if len(netViewMap) == 0 {
-		panic(fmt.Sprintf("must specify at least one node type"))
+	var answerHMACKey []byte
+	if *answerHMACSecretFile != "" {
+		answerHMACKey, err = readHMACSecret(*answerHMACSecretFile)
+		if err != nil {
+			panic(fmt.Sprintf("invalid answer-hmac-secret-file: %v", err))
+		}
+		log.Infof("Signing responses with the TSIG key %v",
+			*rootDomain)
 	}
 
-	rootIP := net.ParseIP(*authoritativeIP)
 	dnsServer := seed.NewDnsServer(
 		netViewMap, *listenAddrUDP, *listenAddrTCP, *rootDomain, rootIP,
+		&seed.DnsServerConfig{
+			MaxTCPConns:     *maxTCPConns,
+			TCPReadTimeout:  time.Duration(*tcpReadTimeout) * time.Second,
+			TCPIdleTimeout:  time.Duration(*tcpIdleTimeout) * time.Second,
+			ProxyProtocol:   *tcpProxyProto,
+			UDPWorkers:      *udpWorkers,
+			UDPQueueDepth:   *udpQueueDepth,
+			DummyRecordName: *rootIPName,
+			PingName:        *pingName,
+			AdaptiveTTL:     *adaptiveTTL,
+			MinAdaptiveTTL:  uint32(*adaptiveTTLMin),
+			MaxAdaptiveTTL:  uint32(*adaptiveTTLMax),
+			QueryStats:      queryStats,
+			NAT64Prefix:     nat64Net,
+			MinTTL:          uint32(*minTTL),
+			NegativeTTL:     uint32(*negativeTTL),
+			CanaryNodeID:    strings.ToLower(*canaryNode),
+			CanaryName:      *canaryName,
+			DefaultChain:    defaultPrefix,
+			ChainRotation:   rotation,
+			User:            *runAsUser,
+			Group:           *runAsGroup,
+
+			ResponseCacheTTL: time.Duration(*responseCacheTTL) * time.Second,
+			WarmCache:        *warmCache,
+			AnswerDeadline:   time.Duration(*answerDeadline) * time.Millisecond,
+
+			StaleAfter: time.Duration(*staleAfter) * time.Second,
+			ServeStale: *serveStale,
+			AgingTTL:   *agingTTL,
+
+			ShuffleAnswers:      *shuffleAnswers,
+			MaxAddressesPerNode: *maxAddressesPerNode,
+			MinimalUDPSize:      uint16(*minimalUDPSize),
+			ChainTXT:            *chainTXT,
+			AddressAnswerSRV:    *addressAnswer == "srv",
+			ExcludeClientSubnet: *excludeClient,
+
+			GeoDB: geoDB,
+
+			FallbackMinNodes: *fallbackMinNodes,
+			BootstrapName:    strings.ToLower(*bootstrapName),
+
+			MaxQueryLabels:  *maxQueryLabels,
+			MaxQueryNameLen: *maxQueryNameLen,
+
+			AnswerHMACKey: answerHMACKey,
+
+			Version: servedVersion(),
+		},
 	)
 
+	if *grpcListen != "" {
+		err := startRPCServer(*grpcListen, netViewMap, defaultPrefix)
+		if err != nil {
+			panic(fmt.Sprintf("unable to start the gRPC server: %v", err))
+		}
+	}
+
+	http.HandleFunc("/status", statusHandler(dnsServer, netViewMap))
+	http.HandleFunc("/status/", chainStatusHandler(netViewMap))
+	http.HandleFunc("/livez", livezHandler(dnsServer))
+	http.HandleFunc("/readyz", readyzHandler(netViewMap))
+	http.Handle("/metrics", metricsHandler(dnsServer, netViewMap))
+	http.HandleFunc(nodesAPIPath, nodesAPIHandler(netViewMap))
+	http.HandleFunc(digestPath, digestHandler(netViewMap))
+
+	// The endpoints are only served once they're all registered, so the
+	// probes never see a 404 while we start up.
+	go func() {
+		log.Println(http.ListenAndServe(":9091", nil))
+	}()
+
+	if *peerDigestURL != "" {
+		go comparePeerViews(
+			netViewMap, *peerDigestURL,
+			time.Duration(*peerDigestInterval)*time.Second,
+		)
+	}
+
+	if *rootIPFile != "" {
+		go reloadRootIP(dnsServer, *rootIPFile)
+	}
+
 	dnsServer.Serve()
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/roasbeef/lseed/seed"
+)
+
+// latencyQuantiles are the quantiles of the poll latency we export.
+var latencyQuantiles = []float64{0.5, 0.9, 0.99}
+
+var (
+	reachableDesc = prometheus.NewDesc(
+		"lseed_reachable_nodes",
+		"Number of nodes currently known to be reachable.",
+		[]string{"chain"}, nil,
+	)
+	latencyDesc = prometheus.NewDesc(
+		"lseed_poll_latency_seconds",
+		"Latency of the recent polls of the backing node.",
+		[]string{"chain"}, nil,
+	)
+	newestUpdateDesc = prometheus.NewDesc(
+		"lseed_newest_node_update_timestamp_seconds",
+		"Time of the newest node announcement of the graph, which "+
+			"stops advancing if the backend stops syncing.",
+		[]string{"chain"}, nil,
+	)
+	skewedDesc = prometheus.NewDesc(
+		"lseed_skewed_nodes_total",
+		"Number of node announcements whose timestamp was too far in "+
+			"the future, and was clamped.",
+		[]string{"chain"}, nil,
+	)
+	oversizedDesc = prometheus.NewDesc(
+		"lseed_oversized_nodes_total",
+		"Number of nodes exceeding the per-node sanity limits, whose "+
+			"addresses were truncated or which were rejected.",
+		[]string{"chain"}, nil,
+	)
+	emptyPollsDesc = prometheus.NewDesc(
+		"lseed_empty_polls_total",
+		"Number of polls ignored since the backend returned an empty "+
+			"graph.",
+		[]string{"chain"}, nil,
+	)
+	addressChangesDesc = prometheus.NewDesc(
+		"lseed_node_address_changes_total",
+		"Number of times a node advertised other IP addresses than in "+
+			"the previous poll.",
+		[]string{"chain"}, nil,
+	)
+	staleDesc = prometheus.NewDesc(
+		"lseed_stale_responses_total",
+		"Number of responses served from a stale view.",
+		nil, nil,
+	)
+	shedDesc = prometheus.NewDesc(
+		"lseed_shed_queries_total",
+		"Number of UDP queries dropped because all the workers were "+
+			"busy and the queue was full.",
+		nil, nil,
+	)
+	deadlineDesc = prometheus.NewDesc(
+		"lseed_answer_deadline_exceeded_total",
+		"Number of queries whose answer couldn't be assembled within "+
+			"the deadline.",
+		nil, nil,
+	)
+	unknownChainsDesc = prometheus.NewDesc(
+		"lseed_unknown_chain_queries_total",
+		"Number of queries for chains we don't serve, by requested "+
+			"prefix.",
+		[]string{"prefix"}, nil,
+	)
+)
+
+// seedCollector exports the state of the DNS server and the chain views,
+// which keep their own counters, as read at the time of each scrape.
+type seedCollector struct {
+	dnsServer  *seed.DnsServer
+	chainViews map[string]*seed.ChainView
+}
+
+// Describe sends the descriptors of all the metrics we export.
+func (c *seedCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		reachableDesc, latencyDesc, newestUpdateDesc, skewedDesc,
+		oversizedDesc, emptyPollsDesc, addressChangesDesc, staleDesc,
+		shedDesc, deadlineDesc, unknownChainsDesc,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect sends the current value of all the metrics we export.
+func (c *seedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, chainView := range c.chainViews {
+		nview := chainView.NetView
+		chain := nview.Chain()
+
+		ch <- prometheus.MustNewConstMetric(
+			reachableDesc, prometheus.GaugeValue,
+			float64(nview.NumReachable()), chain,
+		)
+		if newest := nview.NewestUpdate(); !newest.IsZero() {
+			ch <- prometheus.MustNewConstMetric(
+				newestUpdateDesc, prometheus.GaugeValue,
+				float64(newest.Unix()), chain,
+			)
+		}
+		ch <- prometheus.MustNewConstMetric(
+			skewedDesc, prometheus.CounterValue,
+			float64(nview.SkewedNodes()), chain,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			oversizedDesc, prometheus.CounterValue,
+			float64(nview.OversizedNodes()), chain,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			emptyPollsDesc, prometheus.CounterValue,
+			float64(nview.EmptyPolls()), chain,
+		)
+		ch <- prometheus.MustNewConstMetric(
+			addressChangesDesc, prometheus.CounterValue,
+			float64(nview.AddressChanges()), chain,
+		)
+
+		if chainView.PollLatency == nil {
+			continue
+		}
+
+		quantiles := make(map[float64]float64)
+		ps, ok := chainView.PollLatency.Percentiles(latencyQuantiles...)
+		if ok {
+			for i, q := range latencyQuantiles {
+				quantiles[q] = ps[i].Seconds()
+			}
+		}
+		count, sum := chainView.PollLatency.Totals()
+		ch <- prometheus.MustNewConstSummary(
+			latencyDesc, count, sum.Seconds(), quantiles,
+			chain,
+		)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		staleDesc, prometheus.CounterValue,
+		float64(c.dnsServer.StaleResponses()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		shedDesc, prometheus.CounterValue,
+		float64(c.dnsServer.ShedQueries()),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		deadlineDesc, prometheus.CounterValue,
+		float64(c.dnsServer.DeadlineExceeded()),
+	)
+	for prefix, count := range c.dnsServer.UnknownChainQueries() {
+		ch <- prometheus.MustNewConstMetric(
+			unknownChainsDesc, prometheus.CounterValue,
+			float64(count), prefix,
+		)
+	}
+}
+
+// metricsHandler returns an http handler which exports the state of the DNS
+// server and the chain views in the Prometheus text format, or in the
+// OpenMetrics one if the scraper asks for it in its Accept header.
+func metricsHandler(dnsServer *seed.DnsServer,
+	chainViews map[string]*seed.ChainView) http.Handler {
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&seedCollector{
+		dnsServer:  dnsServer,
+		chainViews: chainViews,
+	})
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		ErrorLog:          log.StandardLogger(),
+		EnableOpenMetrics: true,
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/roasbeef/lseed/seed"
+)
+
+// runParseQuery parses the -parse-query name with the parser of the DNS
+// server, configured as it would be from the command line, and prints the
+// decoded conditions. It returns the exit code of the process, which is
+// non-zero if the name doesn't parse.
+func runParseQuery() int {
+	qtype, ok := dns.StringToType[strings.ToUpper(*parseQueryType)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown query type %v\n", *parseQueryType)
+		return 1
+	}
+
+	// All the chains are known to the parser, without their nodes, so
+	// that any chain can be named.
+	chainViews := make(map[string]*seed.ChainView)
+	for _, chain := range chains {
+		nView := seed.NewStaticNetworkView(chain.name, nil)
+
+		atypes, err := seed.ParseAddressTypes(*chain.defaultAddressType)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid %v default address "+
+				"type: %v\n", chain.ticker, err)
+			return 1
+		}
+		nView.SetDefaultAddressTypes(atypes)
+
+		chainViews[chain.prefix] = &seed.ChainView{NetView: nView}
+	}
+
+	defaultPrefix, err := chainPrefix(*defaultChain)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid default-chain: %v\n", err)
+		return 1
+	}
+
+	dnsServer := seed.NewDnsServer(
+		chainViews, "", "", *rootDomain, nil, &seed.DnsServerConfig{
+			DummyRecordName: *rootIPName,
+			CanaryNodeID:    strings.ToLower(*canaryNode),
+			CanaryName:      *canaryName,
+			BootstrapName:   strings.ToLower(*bootstrapName),
+			DefaultChain:    defaultPrefix,
+			Version:         servedVersion(),
+			MaxQueryLabels:  *maxQueryLabels,
+			MaxQueryNameLen: *maxQueryNameLen,
+		},
+	)
+
+	description, err := dnsServer.DescribeQuery(*parseQuery, qtype)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid query %v: %v\n", *parseQuery,
+			err)
+		return 1
+	}
+
+	fmt.Print(description)
+	return 0
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+const (
+	// restGraphPath is the path of the REST endpoint of lnd describing
+	// the graph.
+	restGraphPath = "/v1/graph"
+
+	// restTimeout bounds the fetch of the graph over REST.
+	restTimeout = time.Minute
+)
+
+// restGraphFetcher fetches the graph of a chain's backing lnd node over its
+// REST interface, which the poller falls back to while the gRPC one keeps
+// failing.
+type restGraphFetcher struct {
+	client *http.Client
+	url    string
+
+	// macaroon is the hex encoded macaroon authenticating the requests.
+	macaroon string
+}
+
+// newRESTGraphFetcher creates a restGraphFetcher for the REST interface of
+// the chain's lnd node, verified and authenticated just like its gRPC one.
+func newRESTGraphFetcher(chain *chainConfig) (*restGraphFetcher, error) {
+	tlsCfg, err := tlsConfig(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	macBytes, err := ioutil.ReadFile(cleanAndExpandPath(*chain.macPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return &restGraphFetcher{
+		client: &http.Client{
+			Timeout: restTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: tlsCfg,
+			},
+		},
+		url:      "https://" + *chain.restHost + restGraphPath,
+		macaroon: hex.EncodeToString(macBytes),
+	}, nil
+}
+
+// describeGraph fetches the graph.
+func (r *restGraphFetcher) describeGraph() (*lnrpc.ChannelGraph, error) {
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Grpc-Metadata-macaroon", r.macaroon)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	// lnd encodes the 64 bit integers as strings, which only the protobuf
+	// JSON decoder understands.
+	graph := &lnrpc.ChannelGraph{}
+	unmarshaler := jsonpb.Unmarshaler{AllowUnknownFields: true}
+	if err := unmarshaler.Unmarshal(resp.Body, graph); err != nil {
+		return nil, fmt.Errorf("unable to decode graph: %v", err)
+	}
+
+	return graph, nil
+}
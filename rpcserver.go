@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/roasbeef/lseed/seed"
+	"github.com/roasbeef/lseed/seedrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// rpcServer serves read-only queries of the chain views over gRPC, using the
+// same node selection as the DNS server.
+type rpcServer struct {
+	chainViews map[string]*seed.ChainView
+
+	// defaultPrefix is the prefix of the chain serving requests which
+	// don't specify any chain.
+	defaultPrefix string
+}
+
+// A compile-time check to ensure that rpcServer fully implements the
+// SeedServer gRPC service.
+var _ seedrpc.SeedServer = (*rpcServer)(nil)
+
+// GetNodes returns a random sample of the reachable nodes of a chain.
+func (s *rpcServer) GetNodes(ctx context.Context,
+	req *seedrpc.GetNodesRequest) (*seedrpc.GetNodesResponse, error) {
+
+	prefix := s.defaultPrefix
+	if req.Chain != "" {
+		var err error
+		prefix, err = chainPrefix(req.Chain)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	chainView, ok := s.chainViews[prefix]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound,
+			"chain %v isn't served", req.Chain)
+	}
+
+	query := seed.NodeType(req.Type)
+	if query == 0 {
+		query = 255
+	}
+	var filter func(seed.Node) bool
+	if req.DualStack {
+		filter = seed.Node.IsDualStack
+	}
+	if len(req.Exclude) > 0 {
+		filter = seed.ExcludeNodes(filter, req.Exclude...)
+	}
+	count := int(req.Count)
+	if count == 0 {
+		count = *numResults
+	}
+
+	resp := &seedrpc.GetNodesResponse{}
+	for _, n := range chainView.NetView.RandomSampleFunc(query, count, filter) {
+		node := &seedrpc.Node{
+			Id:             n.Id,
+			Type:           uint32(n.Type),
+			OnionAddresses: n.OnionAddresses,
+			Hostnames:      n.Hostnames,
+		}
+		if !n.LastUpdate.IsZero() {
+			node.LastUpdate = n.LastUpdate.Unix()
+		}
+		for _, addr := range n.Addresses {
+			node.Addresses = append(node.Addresses, addr.String())
+		}
+
+		resp.Nodes = append(resp.Nodes, node)
+	}
+
+	return resp, nil
+}
+
+// startRPCServer binds the gRPC API on listenAddr and serves it in the
+// background.
+func startRPCServer(listenAddr string, chainViews map[string]*seed.ChainView,
+	defaultPrefix string) error {
+
+	lis, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer()
+	seedrpc.RegisterSeedServer(grpcServer, &rpcServer{
+		chainViews:    chainViews,
+		defaultPrefix: defaultPrefix,
+	})
+
+	go func() {
+		log.Errorf("gRPC server stopped: %v", grpcServer.Serve(lis))
+	}()
+
+	log.Infof("gRPC server listening on %v", lis.Addr())
+	return nil
+}
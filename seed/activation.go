@@ -0,0 +1,85 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !windows
+// +build !windows
+
+package seed
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// activatedSockets returns the UDP and TCP sockets passed to us by systemd
+// socket activation, if any. This lets the service bind port 53 without
+// running as root. Either of them is nil if it wasn't passed.
+func activatedSockets() (*net.UDPConn, net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil, nil, nil
+	}
+
+	// The variables are meant for us only, so we'll make sure our
+	// children don't pick them up.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	var (
+		udpConn     *net.UDPConn
+		tcpListener net.Listener
+	)
+	for fd := listenFDsStart; fd < listenFDsStart+nfds; fd++ {
+		syscall.CloseOnExec(fd)
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+
+		// Stream sockets are TCP listeners, datagram ones are UDP.
+		sockType, err := syscall.GetsockoptInt(
+			fd, syscall.SOL_SOCKET, syscall.SO_TYPE,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to inspect fd %d: %v",
+				fd, err)
+		}
+
+		switch {
+		case sockType == syscall.SOCK_STREAM && tcpListener == nil:
+			tcpListener, err = net.FileListener(f)
+
+		case sockType == syscall.SOCK_DGRAM && udpConn == nil:
+			var conn net.PacketConn
+			conn, err = net.FilePacketConn(f)
+			if err == nil {
+				var ok bool
+				udpConn, ok = conn.(*net.UDPConn)
+				if !ok {
+					err = fmt.Errorf("not a udp socket")
+				}
+			}
+
+		default:
+			err = fmt.Errorf("unexpected socket")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to use fd %d: %v",
+				fd, err)
+		}
+
+		// The net package duplicated the descriptor.
+		f.Close()
+	}
+
+	return udpConn, tcpListener, nil
+}
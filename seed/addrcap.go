@@ -0,0 +1,78 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+)
+
+// capAddresses returns n with at most max of its addresses, so a node
+// advertising many addresses doesn't crowd the other nodes out of a response.
+// The first address of each family is kept before any further one, so the
+// node stays reachable over both families if it can be, and the kept
+// addresses stay in the order the node advertised them. A max of 0 keeps all
+// the addresses.
+func capAddresses(n Node, max int) Node {
+	if max <= 0 || len(n.Addresses) <= max {
+		return n
+	}
+
+	keep := make([]bool, len(n.Addresses))
+	kept := 0
+	var seenIPv4, seenIPv6 bool
+	for i, addr := range n.Addresses {
+		if kept == max {
+			break
+		}
+		if addr.IP.To4() != nil {
+			if seenIPv4 {
+				continue
+			}
+			seenIPv4 = true
+		} else {
+			if seenIPv6 {
+				continue
+			}
+			seenIPv6 = true
+		}
+
+		keep[i] = true
+		kept++
+	}
+	for i := range n.Addresses {
+		if kept == max {
+			break
+		}
+		if keep[i] {
+			continue
+		}
+
+		keep[i] = true
+		kept++
+	}
+
+	addresses := n.Addresses
+	n.Addresses = make([]net.TCPAddr, 0, kept)
+	for i, addr := range addresses {
+		if keep[i] {
+			n.Addresses = append(n.Addresses, addr)
+		}
+	}
+
+	return n
+}
+
+// capNodeAddresses applies the MaxAddressesPerNode cap to each of nodes.
+func (ds *DnsServer) capNodeAddresses(nodes []Node) []Node {
+	if ds.cfg.MaxAddressesPerNode <= 0 {
+		return nodes
+	}
+
+	for i := range nodes {
+		nodes[i] = capAddresses(nodes[i], ds.cfg.MaxAddressesPerNode)
+	}
+
+	return nodes
+}
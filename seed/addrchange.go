@@ -0,0 +1,149 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// retiredAddrs are the addresses a reachable node stopped advertising, which
+// are still served along with its new ones until the grace period ends.
+type retiredAddrs struct {
+	addrs []net.TCPAddr
+	until time.Time
+}
+
+// SetAddressGrace sets how long the addresses a reachable node stopped
+// advertising are still served along with its new ones, so the clients just
+// handed the old address of a node changing its IP can still reach it. Zero
+// replaces the old addresses right away.
+func (nv *NetworkView) SetAddressGrace(grace time.Duration) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.addressGrace = grace
+}
+
+// AddressChanges returns the number of times a node advertised other IP
+// addresses than in the previous poll.
+func (nv *NetworkView) AddressChanges() uint64 {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return nv.addressChanges
+}
+
+// NodeAddressChanges returns the number of times the node with the given ID
+// advertised other IP addresses than in the previous poll.
+func (nv *NetworkView) NodeAddressChanges(id string) int {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return nv.nodeAddressChanges[id]
+}
+
+// trackAddressChange is called as n is ingested, before it replaces its
+// previous state. If the IP addresses of the node changed, the verified
+// addresses of its reachable copy it stopped advertising are retired, to be
+// kept along with its new ones until the end of the grace period. The
+// reachable copy itself is left alone until the new addresses are verified,
+// see storeReachable. The view must be locked.
+func (nv *NetworkView) trackAddressChange(n *Node, now time.Time) {
+	prev, ok := nv.allNodes[n.Id]
+	if !ok || sameAddrs(prev.Addresses, n.Addresses) {
+		return
+	}
+
+	log.Debugf("Node(%v) (%v) changed its addresses from %v to %v",
+		n.Id, nv.chain, prev.Addresses, n.Addresses)
+
+	nv.addressChanges++
+	if nv.nodeAddressChanges == nil {
+		nv.nodeAddressChanges = make(map[string]int)
+	}
+	nv.nodeAddressChanges[n.Id]++
+
+	r, ok := nv.reachableNodes[n.Id]
+	if !ok || nv.addressGrace == 0 {
+		return
+	}
+
+	retired := withoutAddrs(r.Addresses, n.Addresses)
+	if len(retired) == 0 {
+		return
+	}
+	if nv.retiredAddrs == nil {
+		nv.retiredAddrs = make(map[string]retiredAddrs)
+	}
+	nv.retiredAddrs[n.Id] = retiredAddrs{
+		addrs: retired,
+		until: now.Add(nv.addressGrace),
+	}
+}
+
+// storeReachable stores n, whose addresses were just found reachable, as the
+// reachable copy of the node, along with the addresses it retired if still
+// within their grace period. The view must be locked.
+func (nv *NetworkView) storeReachable(n Node, now time.Time) {
+	// The node may have been updated by a poll while we were checking
+	// it, so we'll keep its cadence current.
+	if cur, ok := nv.allNodes[n.Id]; ok {
+		n.LastSeen = cur.LastSeen
+		n.LastUpdate = cur.LastUpdate
+		n.UpdateInterval = cur.UpdateInterval
+	}
+
+	if retired, ok := nv.retiredAddrs[n.Id]; ok {
+		if now.Before(retired.until) {
+			kept := withoutAddrs(retired.addrs, n.Addresses)
+			setAddresses(&n, append(n.Addresses, kept...))
+		} else {
+			delete(nv.retiredAddrs, n.Id)
+		}
+	}
+
+	nv.reachableNodes[n.Id] = n
+}
+
+// sameAddrs returns true if a and b hold the same addresses, in any order.
+func sameAddrs(a, b []net.TCPAddr) bool {
+	return len(withoutAddrs(a, b)) == 0 && len(withoutAddrs(b, a)) == 0
+}
+
+// withoutAddrs returns the addresses of addrs which aren't in drop.
+func withoutAddrs(addrs, drop []net.TCPAddr) []net.TCPAddr {
+	dropped := make(map[string]struct{}, len(drop))
+	for _, addr := range drop {
+		dropped[addr.String()] = struct{}{}
+	}
+
+	var kept []net.TCPAddr
+	for _, addr := range addrs {
+		if _, ok := dropped[addr.String()]; !ok {
+			kept = append(kept, addr)
+		}
+	}
+
+	return kept
+}
+
+// setAddresses sets the IP addresses of n, along with the matching types.
+func setAddresses(n *Node, addrs []net.TCPAddr) {
+	n.Addresses = addrs
+	n.Type &^= NodeTypeIPv4 | NodeTypeIPv6 | NodeTypeDefaultPort
+	for _, addr := range addrs {
+		if addr.IP.To4() == nil {
+			n.Type |= NodeTypeIPv6
+		} else {
+			n.Type |= NodeTypeIPv4
+		}
+		if addr.Port == defaultPort {
+			n.Type |= NodeTypeDefaultPort
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+)
+
+const (
+	// AddressTypeIPv4 is the bit of the BOLT #10 a condition selecting
+	// IPv4 addresses.
+	AddressTypeIPv4 = 1 << 1
+
+	// AddressTypeIPv6 is the bit of the BOLT #10 a condition selecting
+	// IPv6 addresses.
+	AddressTypeIPv6 = 1 << 2
+
+	// defaultAddressTypes are the address types of the queries without
+	// an a condition, unless a chain has other defaults.
+	defaultAddressTypes = AddressTypeIPv4 | AddressTypeIPv6
+)
+
+// ParseAddressTypes parses the name of a set of address types: ipv4, ipv6 or
+// both.
+func ParseAddressTypes(name string) (int, error) {
+	switch name {
+	case "ipv4":
+		return AddressTypeIPv4, nil
+	case "ipv6":
+		return AddressTypeIPv6, nil
+	case "both":
+		return AddressTypeIPv4 | AddressTypeIPv6, nil
+	default:
+		return 0, fmt.Errorf("unknown address types %q, expected "+
+			"ipv4, ipv6 or both", name)
+	}
+}
+
+// addressNodeTypes returns the node types matching the BOLT #10 address
+// types.
+func addressNodeTypes(atypes int) NodeType {
+	var t NodeType
+	if atypes&AddressTypeIPv4 != 0 {
+		t |= NodeTypeIPv4
+	}
+	if atypes&AddressTypeIPv6 != 0 {
+		t |= NodeTypeIPv6
+	}
+
+	return t
+}
+
+// SetDefaultAddressTypes sets the address types of the queries for this
+// chain which don't specify any with an a condition.
+func (nv *NetworkView) SetDefaultAddressTypes(atypes int) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.defaultAddressTypes = atypes
+}
+
+// DefaultAddressTypes returns the address types of the queries for this
+// chain which don't specify any, both IPv4 and IPv6 unless set otherwise.
+func (nv *NetworkView) DefaultAddressTypes() int {
+	nv.Lock()
+	defer nv.Unlock()
+
+	if nv.defaultAddressTypes == 0 {
+		return defaultAddressTypes
+	}
+
+	return nv.defaultAddressTypes
+}
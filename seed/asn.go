@@ -0,0 +1,131 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// asnRange maps a range of IP addresses to the autonomous system announcing
+// it.
+type asnRange struct {
+	start   net.IP
+	end     net.IP
+	asn     uint32
+	country string
+}
+
+// ASNDB maps IP addresses to autonomous systems. It's loaded from the
+// tab-separated ip2asn format (https://iptoasn.com), in which each line holds
+// the first and last address of a range, the AS number, the country code,
+// and the AS description.
+type ASNDB struct {
+	ranges []asnRange
+}
+
+// LoadASNDB reads an ASNDB from the file at path.
+func LoadASNDB(path string) (*ASNDB, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadASNDB(f)
+}
+
+// ReadASNDB reads an ASNDB in the ip2asn format from r.
+func ReadASNDB(r io.Reader) (*ASNDB, error) {
+	db := &ASNDB{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		start := net.ParseIP(fields[0])
+		end := net.ParseIP(fields[1])
+		if start == nil || end == nil {
+			return nil, fmt.Errorf("invalid range on line %d", line)
+		}
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AS number on line %d: %v",
+				line, err)
+		}
+
+		// Ranges which aren't routed are listed as AS 0, we'll leave
+		// those out.
+		if asn == 0 {
+			continue
+		}
+
+		rng := asnRange{
+			start: start.To16(),
+			end:   end.To16(),
+			asn:   uint32(asn),
+		}
+		if len(fields) > 3 {
+			rng.country = fields[3]
+		}
+		db.ranges = append(db.ranges, rng)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+
+	return db, nil
+}
+
+// lookup returns the range containing ip, or nil if there's none.
+func (db *ASNDB) lookup(ip net.IP) *asnRange {
+	ip = ip.To16()
+	if ip == nil {
+		return nil
+	}
+
+	// Find the last range starting at or before the address.
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, db.ranges[i].end) > 0 {
+		return nil
+	}
+
+	return &db.ranges[i]
+}
+
+// ASN returns the autonomous system announcing ip, or 0 if it's unknown.
+func (db *ASNDB) ASN(ip net.IP) uint32 {
+	if rng := db.lookup(ip); rng != nil {
+		return rng.asn
+	}
+
+	return 0
+}
+
+// nodeASN returns the autonomous system of the first address of the node, or
+// 0 if it's unknown.
+func (db *ASNDB) nodeASN(n Node) uint32 {
+	if len(n.Addresses) == 0 {
+		return 0
+	}
+
+	return db.ASN(n.Addresses[0].IP)
+}
@@ -0,0 +1,117 @@
+package seed
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+const testASNDB = "1.0.0.0\t1.0.0.255\t100\tUS\tFIRST-AS\n" +
+	"2.0.0.0\t2.0.0.255\t0\tNone\tNot routed\n" +
+	"3.0.0.0\t3.0.255.255\t300\tDE\tTHIRD-AS\n" +
+	"2001:db8::\t2001:db8::ffff\t400\tFR\tFOURTH-AS\n"
+
+func TestASNLookup(t *testing.T) {
+	db, err := ReadASNDB(strings.NewReader(testASNDB))
+	if err != nil {
+		t.Fatalf("unable to read db: %v", err)
+	}
+
+	tests := []struct {
+		ip  string
+		asn uint32
+	}{
+		{"1.0.0.0", 100},
+		{"1.0.0.255", 100},
+		{"1.0.1.0", 0},
+		{"2.0.0.1", 0},
+		{"3.0.12.1", 300},
+		{"0.0.0.1", 0},
+		{"2001:db8::1", 400},
+		{"2001:db9::1", 0},
+	}
+	for _, tt := range tests {
+		if asn := db.ASN(net.ParseIP(tt.ip)); asn != tt.asn {
+			t.Errorf("expected AS%d for %v, got AS%d", tt.asn,
+				tt.ip, asn)
+		}
+	}
+}
+
+func TestASNDiversity(t *testing.T) {
+	db, err := ReadASNDB(strings.NewReader(testASNDB))
+	if err != nil {
+		t.Fatalf("unable to read db: %v", err)
+	}
+
+	var nodes []Node
+	for i := 0; i < 5; i++ {
+		nodes = append(nodes,
+			testNode(fmt.Sprintf("first%d", i),
+				fmt.Sprintf("1.0.0.%d:9735", i)),
+			testNode(fmt.Sprintf("third%d", i),
+				fmt.Sprintf("3.0.0.%d:9735", i)),
+			testNode(fmt.Sprintf("unknown%d", i),
+				fmt.Sprintf("4.0.0.%d:9735", i)),
+		)
+	}
+	nv := newTestView(nodes...)
+
+	// Without the database all nodes are eligible.
+	if sample := nv.RandomSample(255, 25); len(sample) != 15 {
+		t.Fatalf("expected 15 nodes, got %d", len(sample))
+	}
+
+	// With it, at most 2 nodes per known AS are returned, and nodes of
+	// unknown AS aren't capped.
+	nv.SetASNDiversity(db, 2)
+	sample := nv.RandomSample(255, 25)
+	if len(sample) != 9 {
+		t.Fatalf("expected 9 nodes, got %d", len(sample))
+	}
+	perASN := make(map[uint32]int)
+	for _, n := range sample {
+		perASN[db.nodeASN(n)]++
+	}
+	if perASN[100] != 2 || perASN[300] != 2 || perASN[0] != 5 {
+		t.Fatalf("unexpected distribution: %v", perASN)
+	}
+}
+
+func TestAnswerCountries(t *testing.T) {
+	db, err := ReadASNDB(strings.NewReader(testASNDB))
+	if err != nil {
+		t.Fatalf("unable to read db: %v", err)
+	}
+
+	if country := db.Country(net.ParseIP("3.0.12.1")); country != "DE" {
+		t.Fatalf("expected DE, got %q", country)
+	}
+	if country := db.Country(net.ParseIP("2.0.0.1")); country != "" {
+		t.Fatalf("expected no country, got %q", country)
+	}
+
+	m := new(dns.Msg)
+	for _, rr := range []string{
+		"root. 60 IN A 1.0.0.1",
+		"root. 60 IN A 3.0.0.1",
+		"root. 60 IN A 3.0.0.2",
+		"root. 60 IN A 9.9.9.9",
+	} {
+		a, err := dns.NewRR(rr)
+		if err != nil {
+			t.Fatalf("unable to parse %v: %v", rr, err)
+		}
+		m.Answer = append(m.Answer, a)
+	}
+	aaaa, _ := dns.NewRR("root. 60 IN AAAA 2001:db8::1")
+	m.Extra = append(m.Extra, aaaa)
+
+	summary := db.answerCountries(m)
+	if summary != "??=1 DE=2 FR=1 US=1" {
+		t.Fatalf("unexpected countries: %v", summary)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/miekg/dns"
+)
+
+// maxBootstrapNodes caps the number of curated nodes returned in answer to a
+// bootstrap query, just like the random samples.
+const maxBootstrapNodes = 25
+
+// ReadNodeIDs reads the hex encoded public keys of a curated list of nodes
+// from the file at path, one per line. Empty lines and lines starting with #
+// are skipped.
+func ReadNodeIDs(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		id := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if id == "" || id[0] == '#' {
+			continue
+		}
+
+		raw, err := hex.DecodeString(id)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: malformed node id %q",
+				path, line, id)
+		}
+		if _, err := btcec.ParsePubKey(raw, btcec.S256()); err != nil {
+			return nil, fmt.Errorf("%v:%d: not a valid pubkey %q",
+				path, line, id)
+		}
+		ids = append(ids, id)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// NodesByID returns the nodes with the given IDs which may currently be
+// handed out in answer to a query for the given node type, passing filter if
+// it's set, in the order of ids. Nodes which aren't reachable, or otherwise
+// wouldn't be sampled, are left out, and the others are returned with the
+// addresses of the view rather than any configured ones.
+func (nv *NetworkView) NodesByID(ids []string, query NodeType,
+	filter func(Node) bool) []Node {
+
+	nv.Lock()
+	defer nv.Unlock()
+
+	var nodes []Node
+	for _, id := range ids {
+		n, ok := nv.reachableNodes[id]
+		if !ok {
+			continue
+		}
+		n, ok = nv.restrictFamilies(n)
+		if !ok || !nv.eligible(n, query, filter) {
+			continue
+		}
+
+		n.Capacity = nv.capacities[id]
+		nodes = append(nodes, n)
+	}
+
+	return nodes
+}
+
+// bootstrapNodes returns the curated nodes of the chain answering a query
+// for the bootstrap name, as far as they're in the view and have records of
+// the queried type. If none of them has, nil is returned so the query is
+// answered with a random sample instead, since an empty answer would leave
+// the client stranded.
+func (ds *DnsServer) bootstrapNodes(chainView *ChainView, query NodeType,
+	req *DnsRequest) []Node {
+
+	filter := req.nodeFilter()
+	nodes := chainView.NetView.NodesByID(
+		chainView.BootstrapNodes, query, func(n Node) bool {
+			if filter != nil && !filter(n) {
+				return false
+			}
+
+			return ds.hasRecords(n, req)
+		},
+	)
+	if len(nodes) == 0 {
+		log.Debugf("None of the %d %v bootstrap nodes can be served, "+
+			"answering with a random sample",
+			len(chainView.BootstrapNodes), chainView.NetView.Chain())
+		return nil
+	}
+
+	if len(nodes) > maxBootstrapNodes {
+		nodes = nodes[:maxBootstrapNodes]
+	}
+
+	return nodes
+}
+
+// hasRecords returns true if the node has any records of the type of the
+// request. Unlike the random samples, the curated nodes aren't picked out of
+// many, so we'll make sure each of them contributes to the answer.
+func (ds *DnsServer) hasRecords(n Node, req *DnsRequest) bool {
+	switch req.qtype {
+	case dns.TypeA:
+		return n.Type&NodeTypeIPv4 != 0
+
+	case dns.TypeAAAA:
+		return n.Type&NodeTypeIPv6 != 0 ||
+			(ds.cfg.NAT64Prefix != nil && n.Type&NodeTypeIPv4 != 0)
+
+	default:
+		return n.Type&addressNodeTypes(req.atypes) != 0
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker.
+type BreakerState uint8
+
+const (
+	// BreakerClosed means the backend is considered healthy and every
+	// attempt is let through.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen means the backend failed too many times in a row, and
+	// attempts are refused until the cool-down has elapsed.
+	BreakerOpen
+
+	// BreakerHalfOpen means the cool-down has elapsed and a single trial
+	// attempt is allowed to test whether the backend has recovered.
+	BreakerHalfOpen
+)
+
+// String returns a human readable name for the breaker state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker caps the cost of a long backend outage. After threshold
+// consecutive failures the breaker opens and refuses all attempts for the
+// cool-down period, after which it half-opens and lets a single attempt
+// through. A success closes the breaker again, a failure re-opens it.
+type CircuitBreaker struct {
+	sync.Mutex
+
+	threshold int
+	coolDown  time.Duration
+
+	state    BreakerState
+	failures int
+	openedAt time.Time
+
+	// now is used to fetch the current time, it can be overridden in
+	// tests.
+	now func() time.Time
+}
+
+// NewCircuitBreaker creates a new closed CircuitBreaker. A threshold of zero
+// disables the breaker, which will then always allow attempts.
+func NewCircuitBreaker(threshold int, coolDown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		coolDown:  coolDown,
+		now:       time.Now,
+	}
+}
+
+// Allow returns true if an attempt against the backend should be made.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.Lock()
+	defer cb.Unlock()
+
+	switch cb.state {
+	case BreakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.coolDown {
+			return false
+		}
+
+		// The cool-down has elapsed, so we'll let a single trial
+		// attempt through.
+		cb.state = BreakerHalfOpen
+		return true
+
+	case BreakerHalfOpen:
+		// A trial attempt is already in flight.
+		return false
+
+	default:
+		return true
+	}
+}
+
+// Success records a successful attempt, closing the breaker.
+func (cb *CircuitBreaker) Success() {
+	cb.Lock()
+	defer cb.Unlock()
+
+	cb.state = BreakerClosed
+	cb.failures = 0
+}
+
+// Failure records a failed attempt, opening the breaker if the threshold of
+// consecutive failures has been reached or the trial attempt failed.
+func (cb *CircuitBreaker) Failure() {
+	cb.Lock()
+	defer cb.Unlock()
+
+	cb.failures++
+	if cb.threshold <= 0 {
+		return
+	}
+
+	if cb.state == BreakerHalfOpen || cb.failures >= cb.threshold {
+		cb.state = BreakerOpen
+		cb.openedAt = cb.now()
+	}
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.state
+}
+
+// Failures returns the number of consecutive failures seen so far.
+func (cb *CircuitBreaker) Failures() int {
+	cb.Lock()
+	defer cb.Unlock()
+
+	return cb.failures
+}
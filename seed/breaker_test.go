@@ -0,0 +1,52 @@
+package seed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cb := NewCircuitBreaker(3, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	// The first two failures must not open the breaker.
+	for i := 0; i < 2; i++ {
+		if !cb.Allow() {
+			t.Fatalf("breaker refused attempt %d", i)
+		}
+		cb.Failure()
+	}
+	if cb.State() != BreakerClosed {
+		t.Fatalf("expected closed breaker, got %v", cb.State())
+	}
+
+	// The third one does.
+	cb.Failure()
+	if cb.State() != BreakerOpen || cb.Allow() {
+		t.Fatalf("expected open breaker, got %v", cb.State())
+	}
+
+	// Once the cool-down has elapsed a single trial is let through.
+	now = now.Add(time.Minute)
+	if !cb.Allow() {
+		t.Fatalf("breaker refused trial attempt")
+	}
+	if cb.State() != BreakerHalfOpen || cb.Allow() {
+		t.Fatalf("expected half-open breaker, got %v", cb.State())
+	}
+
+	// A failed trial re-opens the breaker immediately.
+	cb.Failure()
+	if cb.State() != BreakerOpen {
+		t.Fatalf("expected open breaker, got %v", cb.State())
+	}
+
+	// And a successful one closes it.
+	now = now.Add(time.Minute)
+	cb.Allow()
+	cb.Success()
+	if cb.State() != BreakerClosed || cb.Failures() != 0 {
+		t.Fatalf("expected closed breaker, got %v", cb.State())
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+const (
+	// maxCacheEntries caps the number of cached responses. Query names
+	// are chosen by the clients, so we can't let the cache grow freely.
+	maxCacheEntries = 1024
+
+	// srvQueryPrefix is the prefix of the SRV queries clients send for
+	// bootstrapping.
+	srvQueryPrefix = "_nodes._tcp."
+)
+
+// cacheKey identifies a cached response. The sub-domain prefix of the chain
+// serving the query is part of it, as queries for the same name may be served
+// by different chains, see ChainRotation.
+type cacheKey struct {
+	name  string
+	qtype uint16
+	chain string
+}
+
+// cacheEntry is a rendered response and its expiry.
+type cacheEntry struct {
+	answer  []dns.RR
+	extra   []dns.RR
+	expires time.Time
+}
+
+// responseCache holds the rendered responses to wildcard queries for a short
+// while, so the nodes don't need to be sampled and the records assembled for
+// every single query.
+type responseCache struct {
+	sync.Mutex
+
+	ttl     time.Duration
+	entries map[cacheKey]cacheEntry
+}
+
+// newResponseCache creates a responseCache keeping responses for ttl.
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		entries: make(map[cacheKey]cacheEntry),
+	}
+}
+
+// get returns a copy of the cached response to the query for name and qtype,
+// served by the chain with the given prefix.
+func (c *responseCache) get(name string, qtype uint16,
+	chain string) ([]dns.RR, []dns.RR, bool) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	key := cacheKey{strings.ToLower(name), qtype, chain}
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, nil, false
+	}
+
+	return copyRRs(entry.answer), copyRRs(entry.extra), true
+}
+
+// put caches a copy of the response to the query for name and qtype, served
+// by the chain with the given prefix. If the cache is full and none of the
+// entries expired, the response isn't cached.
+func (c *responseCache) put(name string, qtype uint16, chain string, answer,
+	extra []dns.RR) {
+
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	key := cacheKey{strings.ToLower(name), qtype, chain}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxCacheEntries {
+			return
+		}
+	}
+
+	c.entries[key] = cacheEntry{
+		answer:  copyRRs(answer),
+		extra:   copyRRs(extra),
+		expires: now.Add(c.ttl),
+	}
+}
+
+// copyRRs deep copies rrs, so the cached records are never shared with a
+// response being written.
+func copyRRs(rrs []dns.RR) []dns.RR {
+	if rrs == nil {
+		return nil
+	}
+
+	cp := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		cp[i] = dns.Copy(rr)
+	}
+
+	return cp
+}
+
+// handleWildcardQuery answers a query for a sample of the nodes, from the
+// response cache if it's enabled. The minimal responses to clients with a
+// small buffer are neither served from the cache nor cached, as they're
+// cached under the name of the full response.
+func (ds *DnsServer) handleWildcardQuery(r, m *dns.Msg, req *DnsRequest) {
+	name := r.Question[0].Name
+	chain := ds.requestPrefix(req)
+	cache := ds.cache
+	if req.smallBuffer {
+		cache = nil
+	}
+	if cache != nil {
+		answer, extra, ok := cache.get(name, req.qtype, chain)
+
+		// The cached response is shared by all clients, so it may
+		// hold the client's own nodes, in which case we'll sample a
+		// fresh one.
+		if ok && (req.clientSubnet == nil ||
+			!recordsInSubnet(req.clientSubnet, answer, extra)) {
+
+			m.Answer, m.Extra = answer, extra
+			return
+		}
+	}
+
+	// Answers trimmed as they exceeded the deadline aren't cached, so
+	// the next queries get the full answer.
+	ds.renderWildcardQuery(r, m, req)
+	if cache != nil && !req.deadlineExceeded {
+		cache.put(name, req.qtype, chain, m.Answer, m.Extra)
+	}
+}
+
+// renderWildcardQuery samples the nodes to answer a wildcard query with, or
+// refers it to a fallback seed if we know too few nodes.
+func (ds *DnsServer) renderWildcardQuery(r, m *dns.Msg, req *DnsRequest) {
+	if ds.referToFallbackSeed(r, m, req) {
+		return
+	}
+
+	switch req.qtype {
+	case dns.TypeAAAA:
+		ds.handleAAAAQuery(r, m, req)
+	case dns.TypeA:
+		ds.handleAQuery(r, m, req)
+	case dns.TypeSRV:
+		ds.handleSRVQuery(r, m, req)
+	}
+}
+
+// warmCache renders the responses to the default A, AAAA and SRV queries
+// served by the chain with the given prefix into the response cache, so the
+// first clients after a poll don't pay for sampling the fresh view. Those are
+// the queries naming the chain, and the ones for the bare root domain if the
+// chain serves them, as the default chain or as part of the ChainRotation.
+func (ds *DnsServer) warmCache(prefix string) {
+	// Bitcoin is served under the empty prefix, but named explicitly
+	// with its alias.
+	label := prefix
+	if label == "" {
+		label = bitcoinAlias + "."
+	}
+
+	for _, name := range []string{
+		label + ds.rootDomain + ".", ds.rootDomain + ".",
+	} {
+		ds.warmQuery(prefix, name, dns.TypeA)
+		ds.warmQuery(prefix, name, dns.TypeAAAA)
+		ds.warmQuery(prefix, srvQueryPrefix+name, dns.TypeSRV)
+	}
+
+	log.Debugf("Warmed the response cache for %v", label+ds.rootDomain)
+}
+
+// warmQuery renders the response to the query for name and qtype into the
+// response cache, if it's served by the chain with the given prefix.
+func (ds *DnsServer) warmQuery(prefix, name string, qtype uint16) {
+	req, err := ds.parseRequest(name, qtype)
+	if err != nil {
+		log.Errorf("Unable to warm the cache for %v: %v", name, err)
+		return
+	}
+
+	// The queries for the bare root domain are only served by the chain
+	// if it's the default one, or if the rotation may pick it, in which
+	// case the response is cached for it.
+	if ds.rotates(req) {
+		if !ds.cfg.ChainRotation.includes(prefix) {
+			return
+		}
+		ds.pickChain(req, prefix)
+	}
+	if ds.requestPrefix(req) != prefix {
+		return
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion(name, qtype)
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	ds.renderWildcardQuery(r, m, req)
+	ds.cache.put(name, qtype, prefix, m.Answer, m.Extra)
+}
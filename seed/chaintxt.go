@@ -0,0 +1,57 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// addChainTXT adds a TXT record to the additional section of an answer with
+// nodes, e.g. "chain=testnet" "realm=0", owned by the query name, so clients
+// tracking several chains know which one the nodes belong to even if the
+// query name doesn't say, as for the default chain or the rotating one. The
+// realm is only reported for the chains which have one. Minimal answers are
+// left as small as they can be.
+func (ds *DnsServer) addChainTXT(m *dns.Msg, req *DnsRequest) {
+	if req.minimal || req.dummy || req.discovery || req.version ||
+		req.ping || req.count || len(m.Answer) == 0 {
+
+		return
+	}
+
+	chainView := ds.chainView(req)
+	if chainView == nil {
+		return
+	}
+
+	txt := []string{"chain=" + chainView.NetView.Chain()}
+	if chainView.HasRealm {
+		txt = append(txt, fmt.Sprintf("realm=%d", chainView.Realm))
+	}
+
+	m.Extra = append(m.Extra, &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   m.Question[0].Name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    m.Answer[0].Header().Ttl,
+		},
+		Txt: txt,
+	})
+}
+
+// otherRealm returns true if the request asks for another realm than the one
+// of its chain, in which case it's answered without any node. Chains without
+// a known realm answer the queries for any realm.
+func (ds *DnsServer) otherRealm(req *DnsRequest) bool {
+	chainView := ds.chainView(req)
+	if !req.realmSet || chainView == nil || !chainView.HasRealm {
+		return false
+	}
+
+	return req.realm != int(chainView.Realm)
+}
@@ -0,0 +1,60 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// ChannelStats aggregates the channels of a node, in satoshis.
+type ChannelStats struct {
+	// Channels is the number of channels of the node.
+	Channels int `json:"channels"`
+
+	// Capacity is the total capacity of the channels.
+	Capacity int64 `json:"capacity"`
+
+	// MinChannel and MaxChannel are the capacities of the smallest and
+	// the largest channel.
+	MinChannel int64 `json:"min_channel"`
+	MaxChannel int64 `json:"max_channel"`
+}
+
+// NodeChannelStats aggregates the channels of each node of the graph, by ID.
+// It's computed once per poll, so the stats are cheap to look up.
+func NodeChannelStats(edges []*lnrpc.ChannelEdge) map[string]ChannelStats {
+	stats := make(map[string]ChannelStats)
+
+	add := func(id string, capacity int64) {
+		s, ok := stats[id]
+		if !ok || capacity < s.MinChannel {
+			s.MinChannel = capacity
+		}
+		if capacity > s.MaxChannel {
+			s.MaxChannel = capacity
+		}
+		s.Channels++
+		s.Capacity += capacity
+
+		stats[id] = s
+	}
+
+	for _, edge := range edges {
+		add(edge.Node1Pub, edge.Capacity)
+		add(edge.Node2Pub, edge.Capacity)
+	}
+
+	return stats
+}
+
+// ChannelStats returns the stats of the channels of the node with the given
+// ID, as of the last poll.
+func (nv *NetworkView) ChannelStats(id string) (ChannelStats, bool) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	stats, ok := nv.channelStats[id]
+	return stats, ok
+}
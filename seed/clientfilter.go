@@ -0,0 +1,95 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// minECSPrefixIPv4 and minECSPrefixIPv6 are the shortest client
+	// subnet prefixes we exclude the nodes of. Coarser subnets would take
+	// out many unrelated nodes, so they're ignored.
+	minECSPrefixIPv4 = 24
+	minECSPrefixIPv6 = 48
+)
+
+// clientSubnet returns the subnet of the client a query is asked on behalf
+// of: the one of the EDNS client subnet option if there's one, since the
+// source of the query is then a resolver, and otherwise the source address
+// itself. It returns nil if the subnet is unknown, or too coarse.
+func clientSubnet(r *dns.Msg, client net.Addr) *net.IPNet {
+	if opt := r.IsEdns0(); opt != nil {
+		for _, option := range opt.Option {
+			ecs, ok := option.(*dns.EDNS0_SUBNET)
+			if !ok {
+				continue
+			}
+
+			bits, minPrefix := 128, minECSPrefixIPv6
+			if ecs.Family == 1 {
+				bits, minPrefix = 32, minECSPrefixIPv4
+			}
+			if int(ecs.SourceNetmask) < minPrefix ||
+				int(ecs.SourceNetmask) > bits {
+
+				return nil
+			}
+
+			mask := net.CIDRMask(int(ecs.SourceNetmask), bits)
+			return &net.IPNet{IP: ecs.Address.Mask(mask), Mask: mask}
+		}
+	}
+
+	var ip net.IP
+	switch addr := client.(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	}
+	if ip == nil {
+		return nil
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// inSubnet returns true if any of the addresses of the node is within subnet.
+func (n Node) inSubnet(subnet *net.IPNet) bool {
+	for _, addr := range n.Addresses {
+		if subnet.Contains(addr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordsInSubnet returns true if any of the address records is within
+// subnet.
+func recordsInSubnet(subnet *net.IPNet, sections ...[]dns.RR) bool {
+	for _, section := range sections {
+		for _, rr := range section {
+			switch rr := rr.(type) {
+			case *dns.A:
+				if subnet.Contains(rr.A) {
+					return true
+				}
+			case *dns.AAAA:
+				if subnet.Contains(rr.AAAA) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,69 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// maxFutureUpdate is how far in the future the last update of a node
+	// may be before we consider its timestamp skewed. Announcements are
+	// timestamped by the node's own clock, so some leeway is due.
+	maxFutureUpdate = time.Hour
+
+	// clockSkewWarnRatio is the ratio of the nodes of a poll with a skewed
+	// timestamp past which we suspect our own clock is off.
+	clockSkewWarnRatio = 0.1
+)
+
+// clampFutureUpdate clamps the last update of n if it's too far in the
+// future, and returns true if it did. The last update is clamped to the
+// previous one of the node, so a skewed node isn't seen updating on every
+// poll, or to now if there's none.
+func clampFutureUpdate(n *Node, prev Node, now time.Time) bool {
+	if !n.LastUpdate.After(now.Add(maxFutureUpdate)) {
+		return false
+	}
+
+	if !prev.LastUpdate.IsZero() {
+		n.LastUpdate = prev.LastUpdate
+	} else {
+		n.LastUpdate = now
+	}
+
+	return true
+}
+
+// SkewedNodes returns the number of nodes added to the view whose last update
+// was too far in the future, and was clamped.
+func (nv *NetworkView) SkewedNodes() uint64 {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return nv.skewedNodes
+}
+
+// CheckClockSkew is called once the nodes of a poll were added, and warns if
+// a significant fraction of them had their last update too far in the
+// future, which hints at our own clock being behind. It returns true if so.
+func (nv *NetworkView) CheckClockSkew() bool {
+	nv.Lock()
+	total, skewed := nv.pollNodes, nv.pollSkewed
+	nv.pollNodes, nv.pollSkewed = 0, 0
+	nv.Unlock()
+
+	if total == 0 || float64(skewed) <= clockSkewWarnRatio*float64(total) {
+		return false
+	}
+
+	log.Warnf("%d of the %d %v nodes were last updated more than %v in "+
+		"the future, is the local clock behind?", skewed, total,
+		nv.chain, maxFutureUpdate)
+
+	return true
+}
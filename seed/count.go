@@ -0,0 +1,51 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// countName is the label under which the number of reachable nodes of a
+// chain is served as a TXT record, e.g. count.ltc.<root-domain>, so clients
+// and dashboards can display it without fetching a sample of nodes.
+const countName = "count"
+
+// handleCountQuery answers a TXT query at the count name with the number of
+// reachable nodes of the chain, overall and per address family.
+func (ds *DnsServer) handleCountQuery(request *dns.Msg, response *dns.Msg,
+	req *DnsRequest) {
+
+	log.Debugf("Handling count query")
+
+	if req.qtype != dns.TypeTXT {
+		return
+	}
+
+	chainView := ds.chainView(req)
+	if chainView == nil {
+		log.Errorf("count query: no chain view found for %v",
+			req.subdomain)
+		return
+	}
+
+	nv := chainView.NetView
+	counts := nv.NumReachableByType(NodeTypeIPv4, NodeTypeIPv6, NodeTypeTor)
+
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   request.Question[0].Name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    defaultTTL,
+		},
+		Txt: []string{fmt.Sprintf("total=%d ipv4=%d ipv6=%d onion=%d",
+			nv.NumReachable(), counts[0], counts[1], counts[2])},
+	}
+	response.Answer = append(response.Answer, rr)
+}
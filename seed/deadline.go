@@ -0,0 +1,40 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// pastDeadline returns true if the answer to the request wasn't assembled
+// within the AnswerDeadline, which is counted the first time it's noticed.
+// It's checked once the nodes are selected, the most expensive part of an
+// answer, so the selection is then trimmed to a minimal answer, quicker to
+// render and sign, see sampleNodes. Answers served from the response cache
+// never get that far.
+func (ds *DnsServer) pastDeadline(req *DnsRequest) bool {
+	if req.deadlineExceeded {
+		return true
+	}
+	if req.deadline.IsZero() || time.Now().Before(req.deadline) {
+		return false
+	}
+
+	req.deadlineExceeded = true
+	atomic.AddUint64(&ds.deadlineExceeded, 1)
+	log.Warnf("Answer to %v exceeded the deadline of %v, answering with "+
+		"a single node", req.subdomain, ds.cfg.AnswerDeadline)
+
+	return true
+}
+
+// DeadlineExceeded returns the number of queries whose answer couldn't be
+// assembled within the AnswerDeadline.
+func (ds *DnsServer) DeadlineExceeded() uint64 {
+	return atomic.LoadUint64(&ds.deadlineExceeded)
+}
@@ -0,0 +1,25 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+// dedupNodes returns nodes with each node only kept the first time it
+// appears, by public key, so a node selected more than once, e.g. by
+// sampling the families separately or listed twice in the curated nodes,
+// only contributes its records to a response once. The order of the nodes is
+// preserved.
+func dedupNodes(nodes []Node) []Node {
+	seen := make(map[string]struct{}, len(nodes))
+	deduped := nodes[:0]
+	for _, n := range nodes {
+		if _, ok := seen[n.Id]; ok {
+			continue
+		}
+		seen[n.Id] = struct{}{}
+
+		deduped = append(deduped, n)
+	}
+
+	return deduped
+}
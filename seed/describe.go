@@ -0,0 +1,104 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// DescribeQuery parses the query for name and qtype as the server would, and
+// returns a human readable description of the decoded BOLT #10 conditions.
+// It's meant for client developers checking the names they construct. An
+// error is returned if the server wouldn't serve the query.
+func (ds *DnsServer) DescribeQuery(name string, qtype uint16) (string, error) {
+	name = dns.Fqdn(name)
+	if ds.queryNameTooLong(name) {
+		return "", fmt.Errorf("name longer than %d characters or %d "+
+			"labels", ds.maxQueryNameLen(), ds.maxQueryLabels())
+	}
+
+	req, err := ds.parseRequest(name, qtype)
+	if err != nil {
+		return "", err
+	}
+	if req.unknownLabel != "" {
+		return "", fmt.Errorf("unknown label %q", req.unknownLabel)
+	}
+
+	var b strings.Builder
+	line := func(key string, format string, args ...interface{}) {
+		fmt.Fprintf(&b, "%-14s %s\n", key+":", fmt.Sprintf(format, args...))
+	}
+
+	line("name", "%v", name)
+	line("type", "%v", dns.TypeToString[qtype])
+
+	switch {
+	case req.dummy:
+		line("target", "authoritative name server record")
+		return b.String(), nil
+	case req.discovery:
+		line("target", "discovery record")
+		return b.String(), nil
+	case req.version:
+		line("target", "version record")
+		return b.String(), nil
+	}
+
+	chain := "unknown"
+	if chainView := ds.chainView(req); chainView != nil {
+		chain = chainView.NetView.Chain()
+	}
+	switch {
+	case ds.rotates(req):
+		chain = "picked by the chain rotation"
+	case !req.explicitChain:
+		chain += " (default)"
+	}
+	line("chain", "%v", chain)
+
+	switch {
+	case req.node_id != "" && req.canary:
+		line("node id", "%v (canary)", req.node_id)
+	case req.node_id != "":
+		line("node id", "%v", req.node_id)
+	case req.count:
+		line("target", "node count")
+	default:
+		line("realm", "%d", req.realm)
+		if qtype == dns.TypeSRV {
+			line("address types", "%d (%v)", req.atypes,
+				describeAddressTypes(req.atypes))
+		}
+		if req.numRecords != 0 {
+			line("count", "%d (the seed returns up to 25)",
+				req.numRecords)
+		}
+		line("dual-stack", "%v", req.dualStack)
+		line("minimal", "%v", req.minimal)
+		line("bootstrap", "%v", req.bootstrap)
+	}
+
+	return b.String(), nil
+}
+
+// describeAddressTypes returns the names of the BOLT #10 address types.
+func describeAddressTypes(atypes int) string {
+	var names []string
+	if atypes&AddressTypeIPv4 != 0 {
+		names = append(names, "ipv4")
+	}
+	if atypes&AddressTypeIPv6 != 0 {
+		names = append(names, "ipv6")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,94 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// ViewDigest is a compact summary of the reachable nodes of a view, so the
+// views of several seeds can be compared: seeds agreeing on the reachable
+// nodes have the same digest.
+type ViewDigest struct {
+	// Nodes is the number of reachable nodes.
+	Nodes int `json:"nodes"`
+
+	// Hash is the hex encoded SHA-256 of the sorted IDs of the reachable
+	// nodes, each followed by a newline.
+	Hash string `json:"hash"`
+
+	// IDs are the sorted IDs of the reachable nodes, only set if asked
+	// for, see Digest.
+	IDs []string `json:"ids,omitempty"`
+}
+
+// ReachableIDs returns the sorted IDs of the reachable nodes.
+func (nv *NetworkView) ReachableIDs() []string {
+	nv.Lock()
+	ids := make([]string, 0, len(nv.reachableNodes))
+	for id := range nv.reachableNodes {
+		ids = append(ids, id)
+	}
+	nv.Unlock()
+
+	sort.Strings(ids)
+	return ids
+}
+
+// Digest returns the digest of the reachable nodes of the view, along with
+// their IDs if withIDs is set, to compute the overlap with another view.
+func (nv *NetworkView) Digest(withIDs bool) ViewDigest {
+	ids := nv.ReachableIDs()
+
+	h := sha256.New()
+	for _, id := range ids {
+		h.Write([]byte(id))
+		h.Write([]byte{'\n'})
+	}
+
+	digest := ViewDigest{
+		Nodes: len(ids),
+		Hash:  hex.EncodeToString(h.Sum(nil)),
+	}
+	if withIDs {
+		digest.IDs = ids
+	}
+
+	return digest
+}
+
+// Overlap returns the fraction of the nodes of either set of IDs which are in
+// both, from 0 for disjoint sets to 1 for identical ones. Two empty sets are
+// identical.
+func Overlap(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	inA := make(map[string]struct{}, len(a))
+	for _, id := range a {
+		inA[id] = struct{}{}
+	}
+
+	var both int
+	union := len(inA)
+	seen := make(map[string]struct{}, len(b))
+	for _, id := range b {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		if _, ok := inA[id]; ok {
+			both++
+		} else {
+			union++
+		}
+	}
+
+	return float64(both) / float64(union)
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// discoveryName is the label under which the chains we serve, and how to
+// query them, are advertised to clients which can't form BOLT #10 names.
+// Such clients first issue a TXT query for discovery.<root-domain>, and then
+// a plain A or AAAA query for <chain>.<root-domain>, e.g.
+// bitcoin.nodes.lightning.directory, to get a random sample of nodes.
+const discoveryName = "discovery"
+
+// chainPrefix returns the sub-domain prefix of the chain view tracking the
+// chain with the given name.
+func (ds *DnsServer) chainPrefix(chain string) (string, bool) {
+	for prefix, chainView := range ds.chainViews {
+		if chainView.NetView.Chain() == chain {
+			return prefix, true
+		}
+	}
+
+	return "", false
+}
+
+// handleDiscoveryQuery answers a TXT query at the discovery name with the
+// query format and the list of chains we serve.
+func (ds *DnsServer) handleDiscoveryQuery(request *dns.Msg, response *dns.Msg,
+	req *DnsRequest) {
+
+	log.Debugf("Handling discovery query")
+
+	if req.qtype != dns.TypeTXT {
+		return
+	}
+
+	var chains []string
+	for _, chainView := range ds.chainViews {
+		chains = append(chains, chainView.NetView.Chain())
+	}
+	sort.Strings(chains)
+
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   request.Question[0].Name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    defaultTTL,
+		},
+		Txt: []string{
+			fmt.Sprintf("format=<chain>.%s A|AAAA", ds.rootDomain),
+			fmt.Sprintf("chains=%s", strings.Join(chains, ",")),
+		},
+	}
+	response.Answer = append(response.Answer, rr)
+}
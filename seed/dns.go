@@ -8,54 +8,422 @@ package seed
 // shoutout to miekg for his dns library :-)
 
 import (
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
-	"github.com/btcsuite/btcd/btcec"
-	"github.com/btcsuite/btcutil/bech32"
 	"github.com/miekg/dns"
 )
 
+// errUnsupportedQtype is returned when parsing a request for a query type we
+// don't serve, e.g. PTR or MX probes from recursive resolvers.
+var errUnsupportedQtype = errors.New("unsupported query type")
+
+// defaultDummyRecordName is the label under which the dummy record pointing
+// at the authoritative name server is served by default.
+const defaultDummyRecordName = "soa"
+
+// bitcoinAlias is the label naming bitcoin explicitly, whose nodes are
+// otherwise served under the empty prefix. bc is accepted as well.
+const bitcoinAlias = "btc"
+
+// defaultCanaryName is the label under which the canary node is served by
+// default.
+const defaultCanaryName = "canary"
+
+// defaultTTL is the TTL of the records we serve, in seconds.
+const defaultTTL = 60
+
+// adaptiveTTLDivisor is the fraction of a node's observed update interval
+// used as the TTL of its records when AdaptiveTTL is enabled.
+const adaptiveTTLDivisor = 10
+
+// tcpQueueTimeout is how long a new TCP connection is held waiting for a
+// free slot once MaxTCPConns connections are open, before it's refused.
+const tcpQueueTimeout = 100 * time.Millisecond
+
+// DnsServerConfig holds the optional tunables of a DnsServer. The zero value
+// of each field keeps the default behavior.
+type DnsServerConfig struct {
+	// MaxTCPConns caps the number of concurrently handled TCP
+	// connections, 0 means unlimited.
+	MaxTCPConns int
+
+	// TCPReadTimeout and TCPIdleTimeout are how long a TCP connection is
+	// kept open waiting for the first query, and for any further one
+	// once answered. They default to 2 and 8 seconds.
+	TCPReadTimeout time.Duration
+	TCPIdleTimeout time.Duration
+
+	// ProxyProtocol, if set, expects each TCP connection to start with a
+	// PROXY protocol v1 or v2 header, e.g. from a load balancer in front
+	// of the seed, holding the address of the client it's proxying.
+	// Connections without one are closed, so it must only be set if all
+	// of them come from a trusted load balancer.
+	ProxyProtocol bool
+
+	// UDPWorkers caps the number of concurrently processed UDP queries,
+	// 0 means unlimited. Up to UDPQueueDepth further queries per socket
+	// wait for a worker, and the ones beyond are shed.
+	UDPWorkers    int
+	UDPQueueDepth int
+
+	// DummyRecordName is the label under which the dummy record pointing
+	// at the authoritative name server is served, defaults to soa.
+	DummyRecordName string
+
+	// PingName is the label under which the health of the server is
+	// served to DNS-only monitors, see handlePingQuery, defaults to ping.
+	PingName string
+
+	// AdaptiveTTL derives the TTL of each node's records from the observed
+	// update interval of the node, clamped to [MinAdaptiveTTL,
+	// MaxAdaptiveTTL], so that frequently changing nodes are refreshed
+	// sooner by clients. This is experimental.
+	AdaptiveTTL    bool
+	MinAdaptiveTTL uint32
+	MaxAdaptiveTTL uint32
+
+	// QueryStats, if set, aggregates the queries we receive.
+	QueryStats *QueryStats
+
+	// NAT64Prefix, if set, is used to synthesize AAAA records for
+	// IPv4-only nodes, so IPv6-only clients can reach them.
+	NAT64Prefix *net.IPNet
+
+	// MinTTL is the lowest TTL we'll ever serve, regardless of how the
+	// TTL was computed, so resolvers don't hammer us. Only the ping
+	// answers are exempt.
+	MinTTL uint32
+
+	// CanaryNodeID is the hex encoded pubkey of a known-good node which
+	// is served under CanaryName, defaulting to canary, so monitoring can
+	// assert that the seed is alive and the node still in its view.
+	CanaryNodeID string
+	CanaryName   string
+
+	// DefaultChain is the sub-domain prefix of the chain serving queries
+	// which don't specify any chain. It defaults to the empty prefix,
+	// i.e. bitcoin.
+	DefaultChain string
+
+	// ChainRotation, if set, picks the chain serving each wildcard query
+	// which doesn't specify any chain, instead of the DefaultChain.
+	ChainRotation *ChainRotation
+
+	// User and Group, if set, are the unprivileged user and group the
+	// server switches to once the listeners are bound. Linux only.
+	User  string
+	Group string
+
+	// ResponseCacheTTL, if set, is how long the responses to wildcard
+	// queries are cached and served to all clients asking the same.
+	ResponseCacheTTL time.Duration
+
+	// WarmCache, if set along with ResponseCacheTTL, renders the
+	// responses to the default queries of each chain into the cache once
+	// its view was polled, and the polled nodes checked for reachability.
+	WarmCache bool
+
+	// AnswerDeadline, if set, bounds the time spent assembling the answer
+	// to a query, see pastDeadline.
+	AnswerDeadline time.Duration
+
+	// StaleAfter, if set, is the age of the last successful poll of a
+	// chain after which its view is considered stale. Queries for a
+	// stale chain are answered with SERVFAIL, unless ServeStale is set,
+	// in which case the last known nodes are served with short TTLs.
+	StaleAfter time.Duration
+	ServeStale bool
+
+	// AgingTTL, if set along with StaleAfter, reduces the TTLs of the
+	// records of a chain as its view ages, so they reach the TTL of the
+	// stale responses as the view goes stale, see ageTTLs.
+	AgingTTL bool
+
+	// AnswerHMACKey, if set, is the shared secret with which responses
+	// are signed with TSIG, see signAnswers.
+	AnswerHMACKey []byte
+
+	// Version, if set, is served as a TXT record at
+	// version.<root-domain>.
+	Version string
+
+	// FallbackMinNodes is the number of reachable nodes of a chain below
+	// which its queries are referred to its FallbackSeeds, if any.
+	FallbackMinNodes int
+
+	// GeoDB, if set, is used to log the country of the clients and of
+	// the nodes returned to them, see logGeo.
+	GeoDB *ASNDB
+
+	// MaxQueryLabels and MaxQueryNameLen, if set, are the number of
+	// labels and the length of the longest query name we parse, longer
+	// ones are answered with FORMERR. They default to 16 labels and 192
+	// characters.
+	MaxQueryLabels  int
+	MaxQueryNameLen int
+
+	// ExcludeClientSubnet excludes the nodes within the subnet of the
+	// client from the answers, so nodes bootstrapping from the seed don't
+	// get their own address back. The subnet is the one of the EDNS
+	// client subnet option if there's one, or the source address.
+	ExcludeClientSubnet bool
+
+	// AddressAnswerSRV adds the SRV records of the nodes returned to
+	// wildcard A and AAAA queries, and the glue of their targets, to the
+	// additional section, for clients expecting SRV records. The answer
+	// section keeps the A or AAAA records, as mandated for the query type.
+	AddressAnswerSRV bool
+
+	// MinimalUDPSize, if set, answers the queries received over UDP
+	// advertising an EDNS0 buffer of at most that many bytes, or none if
+	// it's at least 512, with a minimal response, as if they asked for
+	// one, see smallUDPBuffer.
+	MinimalUDPSize uint16
+
+	// ChainTXT adds a TXT record naming the chain, and realm if known, of
+	// the nodes answered with to the additional section, for clients
+	// querying several chains through names which don't tell them apart,
+	// see addChainTXT.
+	ChainTXT bool
+
+	// MaxAddressesPerNode, if set, caps the number of addresses each node
+	// contributes to a response, preferring one address per family, see
+	// capAddresses.
+	MaxAddressesPerNode int
+
+	// BootstrapName, if set, is the label under which the curated
+	// BootstrapNodes of each chain are served instead of a random sample,
+	// e.g. bootstrap.<root-domain>, for wallets shipping a hardcoded
+	// name.
+	BootstrapName string
+
+	// NegativeTTL, if set, is how long resolvers may cache our NXDOMAIN
+	// answers, in seconds, served as the minimum of the SOA record in
+	// their authority section. It defaults to 60 seconds, so a newly
+	// served chain soon becomes resolvable.
+	NegativeTTL uint32
+
+	// ShuffleAnswers shuffles the sampled nodes before answering, so
+	// selectors ranking the nodes don't bias the order of the records.
+	ShuffleAnswers bool
+}
+
 type DnsServer struct {
-	chainViews      map[string]*ChainView
-	listenAddrUDP   string
-	listenAddrTCP   string
-	rootDomain      string
-	authoritativeIP net.IP
+	// The counters are updated atomically, so they come first to be
+	// 64-bit aligned on 32-bit platforms.
+
+	// staleResponses counts the responses served from a stale view.
+	staleResponses uint64
+
+	// deadlineExceeded counts the queries whose answer couldn't be
+	// assembled within the AnswerDeadline.
+	deadlineExceeded uint64
+
+	// shedQueries counts the UDP queries dropped under load.
+	shedQueries uint64
+
+	chainViews    map[string]*ChainView
+	listenAddrUDP string
+	listenAddrTCP string
+	rootDomain    string
+
+	// authoritativeIP is the address served as the dummy record, it can be
+	// replaced at runtime, e.g. on failover.
+	authoritativeIPMtx sync.Mutex
+	authoritativeIP    net.IP
+
+	cfg DnsServerConfig
+
+	// cache holds the rendered responses to wildcard queries, nil if
+	// caching is disabled.
+	cache *responseCache
+
+	listenerMtx sync.Mutex
+	listeners   []ListenerState
+
+	// staleChains tracks which chains were stale when last queried.
+	staleMtx    sync.Mutex
+	staleChains map[string]bool
+
+	// unknownChains counts the queries for chains we don't serve, by
+	// requested prefix.
+	unknownChainMtx sync.Mutex
+	unknownChains   map[string]uint64
+
+	// udpWorkers holds a token for each UDP query being processed, nil
+	// if their number is unbounded.
+	udpWorkers chan struct{}
 }
 
 func NewDnsServer(chainViews map[string]*ChainView, listenAddrUDP, listenAddrTCP, rootDomain string,
-	authoritativeIP net.IP) *DnsServer {
+	authoritativeIP net.IP, cfg *DnsServerConfig) *DnsServer {
 
-	return &DnsServer{
+	ds := &DnsServer{
 		chainViews:      chainViews,
 		listenAddrUDP:   listenAddrUDP,
 		listenAddrTCP:   listenAddrTCP,
 		rootDomain:      rootDomain,
 		authoritativeIP: authoritativeIP,
+		cfg:             *cfg,
+	}
+
+	if cfg.UDPWorkers > 0 {
+		ds.udpWorkers = make(chan struct{}, cfg.UDPWorkers)
+	}
+
+	if cfg.ResponseCacheTTL > 0 {
+		ds.cache = newResponseCache(cfg.ResponseCacheTTL)
+
+		if cfg.WarmCache {
+			for prefix, chainView := range chainViews {
+				prefix := prefix
+				chainView.NetView.OnPoll(func() {
+					ds.warmCache(prefix)
+				})
+			}
+		}
 	}
+
+	return ds
+}
+
+// dummyRecordName returns the label under which the dummy record pointing at
+// the authoritative name server is served.
+func (ds *DnsServer) dummyRecordName() string {
+	if ds.cfg.DummyRecordName != "" {
+		return strings.ToLower(ds.cfg.DummyRecordName)
+	}
+
+	return defaultDummyRecordName
+}
+
+// ParseAuthoritativeIP parses the IPv4 or IPv6 address of the authoritative
+// name server, which is served as the dummy record.
+func ParseAuthoritativeIP(addr string) (net.IP, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("%q isn't an IP address", addr)
+	}
+
+	return ip, nil
+}
+
+// AuthoritativeIP returns the address of the authoritative name server.
+func (ds *DnsServer) AuthoritativeIP() net.IP {
+	ds.authoritativeIPMtx.Lock()
+	defer ds.authoritativeIPMtx.Unlock()
+
+	return ds.authoritativeIP
+}
+
+// SetAuthoritativeIP replaces the address of the authoritative name server,
+// which is served in the dummy record of any later response.
+func (ds *DnsServer) SetAuthoritativeIP(ip net.IP) {
+	ds.authoritativeIPMtx.Lock()
+	defer ds.authoritativeIPMtx.Unlock()
+
+	ds.authoritativeIP = ip
+}
+
+// chainAuthoritativeIP returns the address of the authoritative name server
+// of the chain targeted by the request, the chain's own if it has one.
+func (ds *DnsServer) chainAuthoritativeIP(req *DnsRequest) net.IP {
+	chainView := ds.chainView(req)
+	if chainView != nil && chainView.AuthoritativeIP != nil {
+		return chainView.AuthoritativeIP
+	}
+
+	return ds.AuthoritativeIP()
 }
 
-func addAResponse(n Node, name string, responses *[]dns.RR) {
+// dummyRecord returns the record pointing at the authoritative name server of
+// the chain targeted by the request, an A record if its address is IPv4 and
+// an AAAA record otherwise, or nil if the address isn't of the family the
+// query is for.
+func (ds *DnsServer) dummyRecord(name string, req *DnsRequest) dns.RR {
+	authoritativeIP := ds.chainAuthoritativeIP(req)
+
 	header := dns.RR_Header{
-		Rrtype: dns.TypeA,
+		Rrtype: req.qtype,
 		Class:  dns.ClassINET,
-		Ttl:    60,
+		Ttl:    defaultTTL,
 		Name:   name,
 	}
 
-	for _, a := range n.Addresses {
-		if isPrivateIP(a.IP) {
-			continue
+	ip4 := authoritativeIP.To4()
+	switch {
+	case req.qtype == dns.TypeA && ip4 != nil:
+		return &dns.A{Hdr: header, A: ip4}
+
+	case req.qtype == dns.TypeAAAA && ip4 == nil:
+		return &dns.AAAA{Hdr: header, AAAA: authoritativeIP}
+	}
+
+	return nil
+}
+
+// canaryName returns the label under which the canary node is served.
+func (ds *DnsServer) canaryName() string {
+	if ds.cfg.CanaryName != "" {
+		return strings.ToLower(ds.cfg.CanaryName)
+	}
+
+	return defaultCanaryName
+}
+
+// nodeTTL returns the TTL of the records of the given node.
+func (ds *DnsServer) nodeTTL(n Node) uint32 {
+	if !ds.cfg.AdaptiveTTL || n.UpdateInterval == 0 {
+		return defaultTTL
+	}
+
+	ttl := uint32(n.UpdateInterval.Seconds() / adaptiveTTLDivisor)
+	switch {
+	case ttl < ds.cfg.MinAdaptiveTTL:
+		return ds.cfg.MinAdaptiveTTL
+	case ds.cfg.MaxAdaptiveTTL != 0 && ttl > ds.cfg.MaxAdaptiveTTL:
+		return ds.cfg.MaxAdaptiveTTL
+	default:
+		return ttl
+	}
+}
+
+// applyTTLFloor raises the TTL of all the records of the message to at least
+// MinTTL. It's applied once the response is fully assembled, so it holds no
+// matter how the individual TTLs were computed.
+func (ds *DnsServer) applyTTLFloor(m *dns.Msg) {
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT {
+				continue
+			}
+			if hdr.Ttl < ds.cfg.MinTTL {
+				hdr.Ttl = ds.cfg.MinTTL
+			}
 		}
+	}
+}
 
+func addAResponse(n Node, name string, ttl uint32, responses *[]dns.RR) {
+	header := dns.RR_Header{
+		Rrtype: dns.TypeA,
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+		Name:   name,
+	}
+
+	for _, a := range n.Addresses {
 		if a.IP.To4() == nil {
 			continue
 		}
@@ -69,18 +437,14 @@ func addAResponse(n Node, name string, responses *[]dns.RR) {
 
 }
 
-func addAAAAResponse(n Node, name string, responses *[]dns.RR) {
+func addAAAAResponse(n Node, name string, ttl uint32, responses *[]dns.RR) {
 	header := dns.RR_Header{
 		Rrtype: dns.TypeAAAA,
 		Class:  dns.ClassINET,
-		Ttl:    60,
+		Ttl:    ttl,
 		Name:   name,
 	}
 	for _, a := range n.Addresses {
-		if isPrivateIP(a.IP) {
-			continue
-		}
-
 		if a.IP.To4() != nil {
 			continue
 		}
@@ -94,61 +458,164 @@ func addAAAAResponse(n Node, name string, responses *[]dns.RR) {
 	}
 }
 
-func (ds *DnsServer) locateChainView(subdomain string) *ChainView {
-	//fmt.Println("locate subdom")
+// chainView returns the chain view targeted by the request, or nil if the
+// chain isn't served by us.
+func (ds *DnsServer) chainView(req *DnsRequest) *ChainView {
+	return ds.chainViews[ds.requestPrefix(req)]
+}
 
-	subdomain = strings.TrimSpace(subdomain)
-	segments := strings.SplitAfter(subdomain, ".")
+// requestPrefix returns the sub-domain prefix of the chain targeted by the
+// request.
+func (ds *DnsServer) requestPrefix(req *DnsRequest) string {
+	// Queries not specifying a chain are served by the default one.
+	if req.chain == "" && !req.explicitChain {
+		return ds.cfg.DefaultChain
+	}
 
-	switch {
+	return req.chain
+}
 
-	// If the segment has three parts, then this means it's of the form:
-	// nodeid.chain.root-domain. In this case, we'll target the middle item
-	// in order to fetch the proper chain view.
-	case len(segments) == 3:
-		chain := segments[1]
+// nodeNamePrefix returns the chain prefix of the names of the nodes served in
+// answer to the request, so that resolving them is served by the same chain.
+func (ds *DnsServer) nodeNamePrefix(req *DnsRequest) string {
+	// The empty prefix is the default chain's, which isn't bitcoin's if
+	// another chain is the default.
+	if req.chain == "" && req.explicitChain && ds.cfg.DefaultChain != "" {
+		return bitcoinAlias + "."
+	}
 
-		return ds.chainViews[chain]
+	return req.chain
+}
+
+// chainName returns the name of the chain targeted by the request, or
+// "unknown" if we don't serve it.
+func (ds *DnsServer) chainName(req *DnsRequest) string {
+	chainView := ds.chainView(req)
+	if chainView == nil {
+		return "unknown"
+	}
 
-	// Otherwise, it's of the form nodeid.root-domain. In this case, we'll
-	// target the final element, which should give us "", or the btc
-	// mainnet chain view.
-	//
-	// nodeid.
-	case len(segments) == 2:
-		return ds.chainViews[segments[1]]
+	return chainView.NetView.Chain()
+}
 
-	default:
-		return nil
+// sampleNodes samples the nodes of the given type to answer the request
+// with. If ShuffleAnswers is set, the sample is shuffled, so that the order
+// in which the selector preferred the nodes doesn't bias which one clients
+// try first. The records of each node, including the SRV glue, follow the
+// order of the nodes. The addresses of each node are capped to
+// MaxAddressesPerNode. Queries for the bootstrap name are answered with the
+// curated nodes of the chain instead, see bootstrapNodes.
+func (ds *DnsServer) sampleNodes(chainView *ChainView, query NodeType,
+	req *DnsRequest) []Node {
+
+	var nodes []Node
+	if req.bootstrap && len(chainView.BootstrapNodes) > 0 {
+		nodes = ds.bootstrapNodes(chainView, query, req)
+	}
+
+	switch {
+	case req.minimal && nodes != nil:
+		return ds.capNodeAddresses(bestNode(nodes))
+
+	case req.minimal:
+		return ds.capNodeAddresses(bestNode(
+			chainView.NetView.RandomSampleFunc(
+				query, minimalCandidates, req.nodeFilter(),
+			),
+		))
+
+	case nodes == nil:
+		nodes = chainView.NetView.RandomSampleFunc(
+			query, 25, req.nodeFilter(),
+		)
+	}
+
+	// Rather than keeping the client waiting for the rest of the answer,
+	// we'll only give it the best node.
+	if ds.pastDeadline(req) {
+		return ds.capNodeAddresses(bestNode(nodes))
+	}
+
+	// Each node is only answered with once, whichever way it was
+	// selected.
+	nodes = dedupNodes(nodes)
+
+	if ds.cfg.ShuffleAnswers {
+		chainView.NetView.Shuffle(len(nodes), func(i, j int) {
+			nodes[i], nodes[j] = nodes[j], nodes[i]
+		})
 	}
+
+	return ds.capNodeAddresses(nodes)
 }
 
 func (ds *DnsServer) handleAAAAQuery(request *dns.Msg, response *dns.Msg,
-	subDomain string) {
+	req *DnsRequest) {
 
 	log.Debugf("Handling AAAA query")
-	chainView, ok := ds.chainViews[subDomain]
+	chainView := ds.chainView(req)
+	if chainView == nil {
+		log.Errorf("no chain view found for %v", req.subdomain)
+		return
+	}
 
-	nodes := chainView.NetView.RandomSample(3, 25)
+	nodes := ds.sampleNodes(chainView, 3, req)
 	for _, n := range nodes {
-		addAAAAResponse(n, request.Question[0].Name, &response.Answer)
+		ds.addAAAAResponse(n, request.Question[0].Name, &response.Answer)
+
+		// Minimal responses carry the other family as well, so the
+		// client can connect whatever its connectivity.
+		if req.minimal {
+			addAResponse(
+				n, request.Question[0].Name, ds.nodeTTL(n),
+				&response.Extra,
+			)
+		}
+
+		ds.addSRVHint(n, request, response, req)
+	}
+}
+
+// addAAAAResponse adds the AAAA records of the node, synthesizing them from
+// its IPv4 addresses if the node is IPv4-only and a NAT64 prefix is
+// configured.
+func (ds *DnsServer) addAAAAResponse(n Node, name string, responses *[]dns.RR) {
+	ttl := ds.nodeTTL(n)
+	if ds.cfg.NAT64Prefix != nil && n.Type&NodeTypeIPv6 == 0 {
+		addNAT64Response(n, name, ttl, ds.cfg.NAT64Prefix, responses)
+		return
 	}
+
+	addAAAAResponse(n, name, ttl, responses)
 }
 
 func (ds *DnsServer) handleAQuery(request *dns.Msg, response *dns.Msg,
-	subDomain string) {
+	req *DnsRequest) {
 
 	log.Debugf("Handling A query")
-	chainView, ok := ds.chainViews[subDomain]
-	if !ok {
-		log.Errorf("no chain view found for %v", subDomain)
+	chainView := ds.chainView(req)
+	if chainView == nil {
+		log.Errorf("no chain view found for %v", req.subdomain)
 		return
 	}
 
-	nodes := chainView.NetView.RandomSample(2, 25)
+	nodes := ds.sampleNodes(chainView, 2, req)
 
 	for _, n := range nodes {
-		addAResponse(n, request.Question[0].Name, &response.Answer)
+		addAResponse(
+			n, request.Question[0].Name, ds.nodeTTL(n),
+			&response.Answer,
+		)
+
+		// Minimal responses carry the other family as well, so the
+		// client can connect whatever its connectivity.
+		if req.minimal {
+			ds.addAAAAResponse(
+				n, request.Question[0].Name, &response.Extra,
+			)
+		}
+
+		ds.addSRVHint(n, request, response, req)
 	}
 }
 
@@ -158,96 +625,191 @@ func (ds *DnsServer) handleAQuery(request *dns.Msg, response *dns.Msg,
 // client may either be IPv4 or IPv6, so just return a mix and let the
 // client figure it out.
 func (ds *DnsServer) handleSRVQuery(request *dns.Msg, response *dns.Msg,
-	subDomain string) {
+	req *DnsRequest) {
 
 	log.Debugf("Handling SRV query")
-	log.Debugf("taget subdomain: %s", subDomain)
+	log.Debugf("taget subdomain: %s", req.subdomain)
 
-	var (
-		chainView *ChainView
-		prefix    string
-	)
+	chainView := ds.chainView(req)
+	prefix := ds.nodeNamePrefix(req)
+	hrp := ds.nodeIDHRP(req)
 
-	subDomain = strings.TrimSpace(subDomain)
-	segments := strings.SplitAfter(subDomain, ".")
+	if chainView == nil {
+		log.Errorf("srv no chain view found for %v", req.subdomain)
+		return
+	}
 
-	switch {
+	nodes := ds.sampleNodes(chainView, addressNodeTypes(req.atypes), req)
 
-	// w/ chain and target (_nodes._tcp.test)
-	case len(segments) == 4:
-		prefix = segments[2]
-		chainView = ds.chainViews[segments[2]]
+	for _, n := range nodes {
+		rr := ds.nodeSRV(n, request.Question[0].Name, prefix, hrp)
+		if rr == nil {
+			continue
+		}
+		response.Answer = append(response.Answer, rr)
 
-	// w/ no chain and target  (_nodes._tcp.)
-	case len(segments) == 3:
-		prefix = segments[2]
-		chainView = ds.chainViews[segments[2]]
+		// Clients expect the glue of the target in the additional
+		// section, which is exactly what they'd get by querying the
+		// target itself.
+		if req.atypes&AddressTypeIPv4 != 0 {
+			addAResponse(n, rr.Target, rr.Hdr.Ttl, &response.Extra)
+		}
+		if req.atypes&AddressTypeIPv6 != 0 {
+			ds.addAAAAResponse(n, rr.Target, &response.Extra)
+		}
+	}
 
-	// str8 just target (subdomain) (test.)
-	case len(segments) == 2:
-		prefix = segments[0]
-		chainView = ds.chainViews[segments[0]]
+}
 
-	// default nodes.lightning.diretory no target
-	default:
-		chainView = ds.chainViews[""]
+// nodeSRV returns the SRV record of the node, named name, whose target is the
+// name of the node under the chain prefix, with its ID encoded with the human
+// readable part hrp, or nil if the node can't be served over SRV.
+func (ds *DnsServer) nodeSRV(n Node, name, prefix, hrp string) *dns.SRV {
+	// Nodes only reachable over Tor can't be served over SRV.
+	if len(n.Addresses) == 0 {
+		return nil
 	}
 
-	if chainView == nil {
-		log.Errorf("srv no chain view found for %v", subDomain)
-		return
+	encodedId, err := EncodeNodeID(n.Id, hrp)
+	if err != nil {
+		log.Errorf("Unable to encode node id: %v", err)
+		return nil
 	}
 
-	nodes := chainView.NetView.RandomSample(255, 25)
-
-	header := dns.RR_Header{
-		Name:   request.Question[0].Name,
-		Rrtype: dns.TypeSRV,
-		Class:  dns.ClassINET,
-		Ttl:    60,
+	nodeName := fmt.Sprintf("%s.%s%s.", encodedId, prefix, ds.rootDomain)
+	return &dns.SRV{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeSRV,
+			Class:  dns.ClassINET,
+			Ttl:    ds.nodeTTL(n),
+		},
+		Priority: 10,
+		Weight:   10,
+		Target:   nodeName,
+		Port:     uint16(n.Addresses[0].Port),
 	}
+}
 
-	for _, n := range nodes {
-		rawID, err := hex.DecodeString(n.Id)
-		if err != nil {
-			continue
-		}
+// addSRVHint adds the SRV record of a node returned to an A or AAAA query to
+// the additional section, along with the glue of its target of the queried
+// family, if AddressAnswerSRV is set. Clients expecting SRV records thereby
+// learn the ID of the node without a further query.
+func (ds *DnsServer) addSRVHint(n Node, request, response *dns.Msg,
+	req *DnsRequest) {
 
-		convertedID, err := bech32.ConvertBits(rawID, 8, 5, true)
-		if err != nil {
-			log.Errorf("Unable to convert key=%x, %v", rawID, err)
-			continue
-		}
-		encodedId, err := bech32.Encode("ln", convertedID)
-		if err != nil {
-			log.Errorf("Unable to encode key=%x, %v", convertedID, err)
-			continue
-		}
+	if !ds.cfg.AddressAnswerSRV {
+		return
+	}
 
-		nodeName := fmt.Sprintf("%s.%s%s.", encodedId, prefix, ds.rootDomain)
-		rr := &dns.SRV{
-			Hdr:      header,
-			Priority: 10,
-			Weight:   10,
-			Target:   nodeName,
-			Port:     uint16(n.Addresses[0].Port),
-		}
-		response.Answer = append(response.Answer, rr)
-		//if n.Type&1 == 1 {
-		//	addAAAAResponse(n, nodeName, &response.Extra)
-		//} else {
-		//	addAResponse(n, nodeName, &response.Extra)
-		//}
+	rr := ds.nodeSRV(
+		n, srvQueryPrefix+request.Question[0].Name, ds.nodeNamePrefix(req),
+		ds.nodeIDHRP(req),
+	)
+	if rr == nil {
+		return
 	}
+	response.Extra = append(response.Extra, rr)
 
+	if req.qtype == dns.TypeAAAA {
+		ds.addAAAAResponse(n, rr.Target, &response.Extra)
+	} else {
+		addAResponse(n, rr.Target, rr.Hdr.Ttl, &response.Extra)
+	}
 }
 
 type DnsRequest struct {
 	subdomain string
+	chain     string
 	qtype     uint16
 	atypes    int
 	realm     int
 	node_id   string
+
+	// numRecords is the number of records asked for with the n
+	// condition, which we don't honour.
+	numRecords int
+
+	// explicitChain is set if the request names its chain, rather than
+	// being served by the default chain. Bitcoin's prefix is empty, so
+	// this tells apart the queries naming it from the default ones.
+	explicitChain bool
+
+	// atypesSet is set once the request specifies its address types,
+	// otherwise they're the defaults of the chain.
+	atypesSet bool
+
+	// realmSet is set if the request specifies its realm, otherwise it
+	// targets whichever realm its chain is.
+	realmSet bool
+
+	// dualStack restricts the answer to nodes advertising both an IPv4
+	// and an IPv6 address, it's requested with the d1 label.
+	dualStack bool
+
+	// dummy is set if the request targets the dummy record pointing at
+	// the authoritative name server.
+	dummy bool
+
+	// discovery is set if the request targets the discovery name.
+	discovery bool
+
+	// version is set if the request targets the version name.
+	version bool
+
+	// ping is set if the request targets the ping name.
+	ping bool
+
+	// canary is set if the request targets the canary node by the canary
+	// name.
+	canary bool
+
+	// count is set if the request targets the count name of a chain.
+	count bool
+
+	// minimal is set if the request asks for a single node, with its
+	// records of both address families.
+	minimal bool
+
+	// smallBuffer is set if the request is answered with a minimal
+	// response because of the small buffer of the client, rather than
+	// asking for one.
+	smallBuffer bool
+
+	// bootstrap is set if the request targets the bootstrap name, which
+	// is answered with the curated nodes of the chain.
+	bootstrap bool
+
+	// deadline, if set, is the time by which the answer must be
+	// assembled, and deadlineExceeded is set once it passed, see
+	// pastDeadline.
+	deadline         time.Time
+	deadlineExceeded bool
+
+	// unknownLabel is a label of the request which is neither a condition
+	// nor a chain we know of, usually a chain prefix we don't serve.
+	unknownLabel string
+
+	// clientSubnet, if set, is the subnet of the client, whose nodes are
+	// excluded from the answer, see ExcludeClientSubnet.
+	clientSubnet *net.IPNet
+}
+
+// nodeFilter returns the filter the sampled nodes must pass in order to
+// satisfy the request, or nil if any node will do.
+func (req *DnsRequest) nodeFilter() func(Node) bool {
+	dualStack, client := req.dualStack, req.clientSubnet
+	if !dualStack && client == nil {
+		return nil
+	}
+
+	return func(n Node) bool {
+		if dualStack && !n.IsDualStack() {
+			return false
+		}
+
+		return client == nil || !n.inSubnet(client)
+	}
 }
 
 func (ds *DnsServer) parseRequest(name string, qtype uint16) (*DnsRequest, error) {
@@ -262,78 +824,258 @@ func (ds *DnsServer) parseRequest(name string, qtype uint16) (*DnsRequest, error
 	case dns.TypeA:
 	case dns.TypeAAAA:
 	case dns.TypeSRV:
+	case dns.TypeTXT:
 	default:
 		// If they don't query for any of our supported request types,
 		// then we'll exit early with an error.
-		return nil, fmt.Errorf("refusing to handle query type %d (%s)",
-			qtype, dns.TypeToString[qtype])
+		return nil, fmt.Errorf("refusing to handle query type %d "+
+			"(%s): %w", qtype, dns.TypeToString[qtype],
+			errUnsupportedQtype)
 	}
 
 	req := &DnsRequest{
 		subdomain: name[:len(name)-len(ds.rootDomain)-1],
 		qtype:     qtype,
-		atypes:    6,
+		atypes:    defaultAddressTypes,
 	}
 	parts := strings.Split(req.subdomain, ".")
 
+	// nodeIDHRP is the human readable part of the node ID the request
+	// targets, if any.
+	var nodeIDHRP string
+
 	log.Debugf("Dispatching request for sub-domain %v", req.subdomain)
 
 	// If they're attempting to pool for the IP address of the
 	// authoritative name server (us), then we'll return a slimmed down
-	// request to indicate this.
-	if strings.HasPrefix(req.subdomain, "soa") {
-		return &DnsRequest{
+	// request to indicate this. The dummy record is only served under its
+	// dedicated name, so it never mixes with the node answers.
+	if parts[0] == ds.dummyRecordName() {
+		dummyReq := &DnsRequest{
 			subdomain: req.subdomain,
-		}, nil
+			qtype:     qtype,
+			dummy:     true,
+		}
+
+		// Each chain may be served by its own server, whose address
+		// is served under the chain's prefix, e.g. soa.ltc.
+		for _, cond := range parts[1:] {
+			if prefix, ok := ds.chainLabel(cond); ok {
+				dummyReq.chain = prefix
+				dummyReq.explicitChain = true
+			}
+		}
+
+		return dummyReq, nil
+	}
+
+	// Simple clients first look up the available chains and the query
+	// format at the discovery name.
+	if req.subdomain == discoveryName+"." {
+		req.discovery = true
+		return req, nil
+	}
+
+	// Monitors probe the health of the server at the ping name.
+	if req.subdomain == ds.pingName()+"." {
+		req.ping = true
+		return req, nil
+	}
+
+	// The version is only served if enabled.
+	if ds.cfg.Version != "" && req.subdomain == versionName+"." {
+		req.version = true
+		return req, nil
 	}
 
 	for _, cond := range parts {
-		// We'll skip any empty conditionals, as well as any of the
+		// We'll skip any empty conditionals, and note down any of the
 		// chain-specific sub-domains that this DNS server currently
 		// uses.
-		if len(cond) == 0 || cond == "ltc" || cond == "test" {
+		if len(cond) == 0 {
+			continue
+		}
+		if prefix, ok := ds.chainLabel(cond); ok {
+			req.chain = prefix
+			req.explicitChain = true
+			continue
+		}
+
+		if cond == countName {
+			req.count = true
+			continue
+		}
+
+		if cond == minimalName {
+			req.minimal = true
+			continue
+		}
+
+		if cond == ds.cfg.BootstrapName && ds.cfg.BootstrapName != "" {
+			req.bootstrap = true
+			continue
+		}
+
+		// The canary name is an alias for the configured canary node.
+		if cond == ds.canaryName() && ds.cfg.CanaryNodeID != "" {
+			req.node_id = ds.cfg.CanaryNodeID
+			req.canary = true
+			continue
+		}
+
+		// The service labels of SRV queries, e.g. _nodes._tcp.
+		if cond[0] == '_' {
 			continue
 		}
 
 		k, v := cond[0], cond[1:]
+		_, numErr := strconv.Atoi(v)
 
-		if k == 'r' {
+		if k == 'r' && numErr == nil {
 			req.realm, _ = strconv.Atoi(v)
-		} else if k == 'a' && qtype == dns.TypeSRV {
-			req.atypes, _ = strconv.Atoi(v)
-		} else if k == 'l' {
-			_, bin5, err := bech32.Decode(cond)
-			if err != nil {
-				return nil, fmt.Errorf("malformed bech32 pubkey")
+			req.realmSet = true
+		} else if k == 'a' && numErr == nil {
+			if qtype == dns.TypeSRV {
+				req.atypes, _ = strconv.Atoi(v)
+				req.atypesSet = true
 			}
-			bin, err := bech32.ConvertBits(bin5, 5, 8, false)
+		} else if k == 'n' && numErr == nil {
+			// The number of records is up to us.
+			req.numRecords, _ = strconv.Atoi(v)
+		} else if k == 'd' && (v == "0" || v == "1") {
+			req.dualStack = v == "1"
+		} else if k == 'l' || ds.isNodeIDLabel(cond) {
+			var err error
+			nodeIDHRP, req.node_id, err = DecodeNodeID(cond)
 			if err != nil {
-				return nil, fmt.Errorf("unable to convert bits: %x", bin5)
+				return nil, err
 			}
+		} else {
+			// Chain prefixes come last, so we'll keep the label
+			// closest to the root.
+			req.unknownLabel = cond
+		}
+	}
 
-			p, err := btcec.ParsePubKey(bin, btcec.S256())
-			if err != nil {
-				return nil, fmt.Errorf("not a valid pubkey: %x", bin)
-			}
-			req.node_id = fmt.Sprintf("%x", p.SerializeCompressed())
+	// Node IDs encoded with the human readable part of a chain target
+	// that chain, so the node IDs of different chains never collide.
+	if prefix, ok := ds.nodeIDChain(nodeIDHRP); ok {
+		switch {
+		case !req.explicitChain:
+			req.chain = prefix
+			req.explicitChain = true
+
+		case req.chain != prefix:
+			return nil, fmt.Errorf("node id of another chain: %v",
+				nodeIDHRP)
 		}
 	}
 
+	ds.setDefaultAddressTypes(req)
+
 	return req, nil
 }
 
-func (ds *DnsServer) handleLightningDns(w dns.ResponseWriter, r *dns.Msg) {
+// chainLabel returns the sub-domain prefix of the chain named by the label, if
+// it names one. Bitcoin is served under the empty prefix, but clients may name
+// it explicitly as well, and simple clients may name any chain in full.
+func (ds *DnsServer) chainLabel(label string) (string, bool) {
+	switch label {
+	case "ltc", "test":
+		return label + ".", true
+
+	case bitcoinAlias, "bc":
+		return "", true
+	}
 
-	if len(r.Question) < 1 {
-		log.Errorf("empty request")
+	return ds.chainPrefix(label)
+}
+
+// setDefaultAddressTypes sets the address types of the request to the
+// defaults of its chain, unless it specifies them.
+func (ds *DnsServer) setDefaultAddressTypes(req *DnsRequest) {
+	if chainView := ds.chainView(req); chainView != nil && !req.atypesSet {
+		req.atypes = chainView.NetView.DefaultAddressTypes()
+	}
+}
+
+// handleLightningDns answers the query r over the transport of w.
+func (ds *DnsServer) handleLightningDns(w dns.ResponseWriter, r *dns.Msg) {
+	m := ds.answer(r, w.RemoteAddr())
+	if m == nil {
+		log.Debugf("Not answering query from %v", w.RemoteAddr())
 		return
 	}
 
+	w.WriteMsg(m)
+	ds.logGeo(w.RemoteAddr(), m)
+}
+
+// answer returns the response to the query r from client, or nil if it's
+// dropped. It's independent of the transport the query was received over,
+// except for UDP clients being treated with more suspicion.
+func (ds *DnsServer) answer(r *dns.Msg, client net.Addr) *dns.Msg {
+	start := time.Now()
+	_, udp := client.(*net.UDPAddr)
+
+	// Anything but a standard query with a single question is dropped
+	// over UDP, where we'd only risk being used as an amplifier, while TCP
+	// clients are told what's wrong.
+	if !isQuery(r) {
+		log.Debugf("Malformed query")
+
+		if udp {
+			return nil
+		}
+
+		m := new(dns.Msg)
+		m.SetRcodeFormatError(r)
+		return m
+	}
+
+	// Names longer than any we serve aren't even parsed, so they can't be
+	// used to waste our time or probe the parser.
+	if ds.queryNameTooLong(r.Question[0].Name) {
+		log.Debugf("Query name too long")
+
+		m := new(dns.Msg)
+		m.SetRcodeFormatError(r)
+		return m
+	}
+
 	req, err := ds.parseRequest(r.Question[0].Name, r.Question[0].Qtype)
 
+	// Strict resolvers and validators probe us with query types we don't
+	// serve, so rather than dropping those we'll politely tell them we
+	// don't implement them.
+	if errors.Is(err, errUnsupportedQtype) {
+		log.Debugf("Refusing request: %v", err)
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		return m
+	}
+
 	if err != nil {
 		log.Errorf("error parsing request: %v", err)
-		return
+		return nil
+	}
+
+	ds.rotateChain(req)
+
+	if ds.cfg.ExcludeClientSubnet {
+		req.clientSubnet = clientSubnet(r, client)
+	}
+
+	// Rather than risking an answer too large for the client, we'll only
+	// give it the best node.
+	if !req.minimal && ds.smallUDPBuffer(r, udp) {
+		req.minimal = true
+		req.smallBuffer = true
+	}
+
+	if ds.cfg.AnswerDeadline > 0 {
+		req.deadline = start.Add(ds.cfg.AnswerDeadline)
 	}
 
 	log.WithFields(log.Fields{
@@ -341,6 +1083,38 @@ func (ds *DnsServer) handleLightningDns(w dns.ResponseWriter, r *dns.Msg) {
 		"type":      dns.TypeToString[req.qtype],
 	}).Debugf("Incoming request")
 
+	if ds.cfg.QueryStats != nil {
+		ds.cfg.QueryStats.Record(
+			ds.chainName(req), dns.TypeToString[r.Question[0].Qtype],
+		)
+	}
+
+	// Queries for chains we don't serve are answered with NXDOMAIN, and
+	// counted, to surface the demand for other chains.
+	if prefix, ok := ds.unknownChain(req); ok {
+		log.Debugf("Unknown chain %v for %v", prefix, req.subdomain)
+		ds.recordUnknownChain(prefix)
+
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		ds.addNegativeSOA(m)
+		return m
+	}
+
+	// Unless told to favour availability, we'd rather fail than hand out
+	// nodes we didn't hear about in a while.
+	var stale bool
+	if !req.dummy && !req.discovery && !req.version && !req.ping &&
+		!req.count {
+
+		stale = ds.isStale(req)
+		if stale && !ds.cfg.ServeStale {
+			m := new(dns.Msg)
+			m.SetRcode(r, dns.RcodeServerFailure)
+			return m
+		}
+	}
+
 	m := new(dns.Msg)
 	m.SetReply(r)
 
@@ -348,74 +1122,229 @@ func (ds *DnsServer) handleLightningDns(w dns.ResponseWriter, r *dns.Msg) {
 	// If they're requesting our SOA shim, then we'll directly return the
 	// IP address of the authoritative DNS server for fallback TCP
 	// purposes.
-	case strings.HasPrefix(req.subdomain, "soa"):
+	case req.dummy:
 		log.Debugf("Handling SOA request")
-		soaResp := &dns.A{
-			Hdr: dns.RR_Header{
-				Rrtype: dns.TypeA,
-				Class:  dns.ClassINET,
-				Ttl:    60,
-				Name:   r.Question[0].Name,
-			},
-			A: ds.authoritativeIP,
+
+		// The name exists whatever the family of the address, so
+		// we'll tell resolvers there's no record of the other one.
+		rr := ds.dummyRecord(r.Question[0].Name, req)
+		if rr == nil {
+			m.Ns = append(m.Ns, ds.soaRecord())
+			break
 		}
-		m.Answer = append(m.Answer, soaResp)
+		m.Answer = append(m.Answer, rr)
+
+	case req.discovery:
+		ds.handleDiscoveryQuery(r, m, req)
+
+	case req.version:
+		ds.handleVersionQuery(r, m, req)
+
+	case req.ping:
+		ds.handlePingQuery(r, m, req)
+
+	case req.count:
+		ds.handleCountQuery(r, m, req)
+
+	// The nodes of a chain are no answer to a query for another realm.
+	case req.node_id == "" && ds.otherRealm(req):
+		log.Debugf("No nodes of realm %d for %v", req.realm,
+			req.subdomain)
 
 	// Is this a wildcard query? If so we'll either return: a set of
 	// reachable IPv6 addresses, IPv4 addresses, or return a set of SRV
 	// records that nodes can use to bootstrap to the network.
 	case req.node_id == "":
-		switch req.qtype {
-		case dns.TypeAAAA:
-			ds.handleAAAAQuery(r, m, req.subdomain)
-			break
-		case dns.TypeA:
-			ds.handleAQuery(r, m, req.subdomain)
-			break
-		case dns.TypeSRV:
-			ds.handleSRVQuery(r, m, req.subdomain)
-		}
+		ds.handleWildcardQuery(r, m, req)
 
 	// If they're targeting a specific sub-domain (which targets a node on
 	// the network), then we'll attempt to return a reachable IP address
 	// for the target node.
 	default:
-		chainView := ds.locateChainView(req.subdomain)
+		chainView := ds.chainView(req)
 		if chainView == nil {
 			log.Errorf("node query: no chain view found for %v", req.subdomain)
 			break
 		}
 
-		n, ok := chainView.NetView.reachableNodes[req.node_id]
+		n, ok := chainView.NetView.Lookup(req.node_id)
 		if !ok {
 			log.Debugf("Unable to find node with ID %s", req.node_id)
+
+			// Monitoring relies on the canary being served, so
+			// we'll make sure it notices its absence.
+			if req.canary {
+				m.SetRcode(r, dns.RcodeServerFailure)
+				break
+			}
+
+			// Otherwise, the name of a node we don't know
+			// doesn't exist as far as we're concerned.
+			m.SetRcode(r, dns.RcodeNameError)
+			break
 		}
+		n = capAddresses(n, ds.cfg.MaxAddressesPerNode)
 
 		// Reply with the correct type
 		if req.qtype == dns.TypeAAAA {
-			addAAAAResponse(n, r.Question[0].Name, &m.Answer)
+			ds.addAAAAResponse(n, r.Question[0].Name, &m.Answer)
 		} else if req.qtype == dns.TypeA {
-			addAResponse(n, r.Question[0].Name, &m.Answer)
+			addAResponse(
+				n, r.Question[0].Name, ds.nodeTTL(n), &m.Answer,
+			)
 		}
 	}
 
-	w.WriteMsg(m)
+	if stale {
+		ds.shortenTTLs(m)
+	} else if !req.dummy && !req.discovery && !req.version && !req.ping {
+		ds.ageTTLs(m, req)
+	}
+	if ds.cfg.ChainTXT {
+		ds.addChainTXT(m, req)
+	}
+	ds.addNegativeSOA(m)
+
+	// The ping answers are never to be cached, so each probe reaches us.
+	if !req.ping {
+		ds.applyTTLFloor(m)
+	}
+	ds.signAnswers(m)
+
 	log.WithField("replies", len(m.Answer)).Debugf(
 		"Replying with %d answers and %d extras (len=%v)",
 		len(m.Answer), len(m.Extra), m.Len())
+
+	return m
 }
 
 func (ds *DnsServer) Serve() {
 	dns.HandleFunc(ds.rootDomain, ds.handleLightningDns)
 
-	// We'll launch a goroutine to listen on UDP.
-	go func() {
-		udpServer := &dns.Server{Addr: ds.listenAddrUDP, Net: "udp"}
-		if err := udpServer.ListenAndServe(); err != nil {
-			panic(fmt.Sprintf("failed to setup the udp "+
-				"server: %s\n", err.Error()))
+	// When started through systemd socket activation, we'll use the
+	// sockets it bound for us.
+	activatedUDP, activatedTCP, err := activatedSockets()
+	if err != nil {
+		panic(fmt.Sprintf("failed to use the systemd sockets: %v", err))
+	}
+
+	// Otherwise, we'll bind all the listeners up front, so a partial
+	// start can be reported clearly. Only if none of them can be bound
+	// there's no point in carrying on.
+	var (
+		udpConns     []boundListener
+		tcpListeners []boundListener
+		bindFailed   []listenAddr
+		bindErrs     []string
+	)
+	bind := func(l listenAddr) {
+		var err error
+		switch l.net {
+		case "udp", "udp4", "udp6":
+			var conn net.PacketConn
+			conn, err = net.ListenPacket(l.net, l.addr)
+			if err == nil {
+				udpConns = append(udpConns, boundListener{
+					listenAddr: l,
+					conn:       conn,
+				})
+			}
+
+		default:
+			var listener net.Listener
+			listener, err = net.Listen(l.net, l.addr)
+			if err == nil {
+				tcpListeners = append(tcpListeners, boundListener{
+					listenAddr: l,
+					listener:   listener,
+				})
+			}
+		}
+
+		ds.setListenerState(l.net, l.addr, err)
+		if err != nil {
+			bindFailed = append(bindFailed, l)
+			bindErrs = append(bindErrs, fmt.Sprintf("%v %v: %v",
+				l.net, l.addr, err))
+			return
+		}
+
+		log.Infof("Listening on %v %v", l.net, l.addr)
+	}
+
+	if activatedUDP != nil {
+		log.Infof("Using systemd udp socket %v", activatedUDP.LocalAddr())
+		l := listenAddr{"udp", ds.listenAddrUDP}
+		udpConns = append(udpConns, boundListener{
+			listenAddr: l,
+			conn:       activatedUDP,
+		})
+		ds.setListenerState(l.net, l.addr, nil)
+	} else {
+		for _, l := range listenAddrs("udp", ds.listenAddrUDP) {
+			bind(l)
+		}
+	}
+
+	if activatedTCP != nil {
+		log.Infof("Using systemd tcp socket %v", activatedTCP.Addr())
+		l := listenAddr{"tcp", ds.listenAddrTCP}
+		tcpListeners = append(tcpListeners, boundListener{
+			listenAddr: l,
+			listener:   activatedTCP,
+		})
+		ds.setListenerState(l.net, l.addr, nil)
+	} else {
+		for _, l := range listenAddrs("tcp", ds.listenAddrTCP) {
+			bind(l)
 		}
-	}()
+	}
+
+	if len(udpConns) == 0 && len(tcpListeners) == 0 {
+		panic(fmt.Sprintf("failed to setup any listener: %v",
+			strings.Join(bindErrs, ", ")))
+	}
+
+	var bound []listenAddr
+	for _, l := range append(udpConns, tcpListeners...) {
+		bound = append(bound, l.listenAddr)
+	}
+
+	// Hosts without IPv6, or rarely IPv4, can't bind the wildcard address
+	// of that family, which is expected as long as the other one is bound.
+	for i, failed := range bindFailed {
+		if familyFallback(failed, bound) {
+			log.Warnf("Serving over the other address family "+
+				"only: %v", bindErrs[i])
+			continue
+		}
+
+		log.Errorf("!!! Failed to setup a listener, serving on the "+
+			"others only: %v", bindErrs[i])
+	}
+	log.Infof("Serving on %v", describeListenAddrs(bound))
+
+	// Now that the privileged ports are bound, there's no need to keep
+	// running as root before serving any query.
+	if ds.cfg.User != "" || ds.cfg.Group != "" {
+		if err := dropPrivileges(ds.cfg.User, ds.cfg.Group); err != nil {
+			panic(fmt.Sprintf("failed to drop privileges: %v", err))
+		}
+		log.Infof("Dropped privileges to user=%v group=%v", ds.cfg.User,
+			ds.cfg.Group)
+	}
+
+	// We'll launch a goroutine to listen on UDP.
+	for _, l := range udpConns {
+		l := l
+		go func() {
+			udpServer := ds.newUDPServer(l.conn, dns.DefaultServeMux)
+			err := udpServer.ActivateAndServe()
+			err = fmt.Errorf("%v server stopped: %v", l.net, err)
+			log.Error(err)
+			ds.setListenerState(l.net, l.addr, err)
+		}()
+	}
 
 	// TCP is handled separately as some clients may fallback to opening a
 	// direct connection to the authoritative server in the case that their
@@ -423,15 +1352,21 @@ func (ds *DnsServer) Serve() {
 	// To make this paletable for Kubernetes we need to be able to expose
 	// two different ports for UDP and TCP to support both protocls behind
 	// a load balancer.
-	go func() {
-		tcpServer := &dns.Server{Addr: ds.listenAddrTCP, Net: "tcp"}
-		if err := tcpServer.ListenAndServe(); err != nil {
-			panic(fmt.Sprintf("failed to setup the tcp "+
-				"server: %s\n", err.Error()))
-		}
-	}()
-	quitChan := make(chan os.Signal)
+	// Each TCP connection is handled by its own goroutine, so we'll cap
+	// the number of concurrent connections, and drop the idle ones, to
+	// avoid being exhausted by a flood of them.
+	for _, l := range tcpListeners {
+		l := l
+		go func() {
+			tcpServer := ds.newTCPServer(l.listener, dns.DefaultServeMux)
+			err := tcpServer.ActivateAndServe()
+			err = fmt.Errorf("%v server stopped: %v", l.net, err)
+			log.Error(err)
+			ds.setListenerState(l.net, l.addr, err)
+		}()
+	}
+
+	quitChan := make(chan os.Signal, 1)
 	signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM)
 	<-quitChan
 }
-
@@ -1,10 +1,20 @@
 package seed
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcutil/bech32"
 	"github.com/davecgh/go-spew/spew"
+	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/miekg/dns"
 )
 
@@ -21,16 +31,52 @@ var parserstestsA = []struct {
 		subdomain: "r0.",
 		atypes:    6,
 		realm:     0,
+		realmSet:  true,
 	}},
 	{parseInput{"r0.root.", dns.TypeSRV}, &DnsRequest{
 		subdomain: "r0.",
 		atypes:    6,
 		realm:     0,
+		realmSet:  true,
 	}},
 	{parseInput{"a4.r0.root.", dns.TypeSRV}, &DnsRequest{
 		subdomain: "a4.r0.",
 		atypes:    4,
+		atypesSet: true,
 		realm:     0,
+		realmSet:  true,
+	}},
+	{parseInput{"d1.root.", dns.TypeA}, &DnsRequest{
+		subdomain: "d1.",
+		atypes:    6,
+		dualStack: true,
+	}},
+	{parseInput{"d1.ltc.root.", dns.TypeSRV}, &DnsRequest{
+		subdomain:     "d1.ltc.",
+		chain:         "ltc.",
+		explicitChain: true,
+		atypes:        6,
+		dualStack:     true,
+	}},
+	{parseInput{"soa.root.", dns.TypeA}, &DnsRequest{
+		subdomain: "soa.",
+		dummy:     true,
+	}},
+	{parseInput{"soa.ltc.root.", dns.TypeA}, &DnsRequest{
+		subdomain:     "soa.ltc.",
+		chain:         "ltc.",
+		explicitChain: true,
+		dummy:         true,
+	}},
+	{parseInput{"soap.root.", dns.TypeA}, &DnsRequest{
+		subdomain:    "soap.",
+		atypes:       6,
+		unknownLabel: "soap",
+	}},
+	{parseInput{"_nodes._tcp.doge.root.", dns.TypeSRV}, &DnsRequest{
+		subdomain:    "_nodes._tcp.doge.",
+		atypes:       6,
+		unknownLabel: "doge",
 	}},
 	{parseInput{"s.o.m.t.h.i.n.g.", dns.TypeSRV}, nil},
 	{parseInput{"0.root.", dns.TypeCNAME}, nil},
@@ -55,11 +101,1857 @@ func TestParseRequest(t *testing.T) {
 		req, err := ds.parseRequest(tt.in.name, tt.in.qtype)
 
 		if err != nil && tt.out != nil {
-			t.Errorf("unexpected error %q => %q, want %q, %v", tt.in, req, tt.out, err)
+			t.Errorf("unexpected error %v => %v, want %v, %v", tt.in, req, tt.out, err)
 		} else if !reflect.DeepEqual(req, tt.out) {
 			spew.Dump(req)
 			spew.Dump(tt.out)
-			t.Errorf("parser error %q => %#v, want %#v", tt.in, req, tt.out)
+			t.Errorf("parser error %v => %#v, want %#v", tt.in, req, tt.out)
+		}
+	}
+}
+
+// exchange answers a query for name of type qtype as if it was received over
+// UDP, calling straight into the handler without any transport.
+func exchange(t *testing.T, ds *DnsServer, name string,
+	qtype uint16) *dns.Msg {
+
+	t.Helper()
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+
+	resp := ds.answer(req, &net.UDPAddr{})
+	if resp == nil {
+		t.Fatalf("no answer to %v %v", name, dns.TypeToString[qtype])
+	}
+	if resp.Id != req.Id {
+		t.Fatalf("mismatched answer to %v: %v", name, resp)
+	}
+	return resp
+}
+
+func TestUnsupportedQtype(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+	}
+
+	for _, qtype := range []uint16{dns.TypePTR, dns.TypeMX} {
+		resp := exchange(t, ds, "r0.root.", qtype)
+		if resp.Rcode != dns.RcodeNotImplemented {
+			t.Fatalf("expected NOTIMP for %v, got %v",
+				dns.TypeToString[qtype],
+				dns.RcodeToString[resp.Rcode])
+		}
+		if len(resp.Answer) != 0 {
+			t.Fatalf("malformed reply: %v", resp)
+		}
+	}
+}
+
+func TestDualStackQuery(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode("v4", "1.1.1.1:9735"),
+				testNode("dual", "1.1.1.2:9735", "[2001:db8::2]:9735"),
+			)},
+		},
+	}
+
+	answer := exchange(t, ds, "d1.root.", dns.TypeA).Answer
+	if len(answer) != 1 || !answer[0].(*dns.A).A.Equal(net.ParseIP("1.1.1.2")) {
+		t.Fatalf("expected only the dual-stack node, got %v", answer)
+	}
+}
+
+func TestDummyRecordName(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		cfg: DnsServerConfig{
+			DummyRecordName: "seed",
+		},
+	}
+
+	req, err := ds.parseRequest("seed.root.", dns.TypeA)
+	if err != nil || !req.dummy {
+		t.Fatalf("expected dummy request, got %v, %v", req, err)
+	}
+
+	req, err = ds.parseRequest("soa.root.", dns.TypeA)
+	if err != nil || req.dummy {
+		t.Fatalf("expected regular request, got %v, %v", req, err)
+	}
+}
+
+func TestAuthoritativeIP(t *testing.T) {
+	if _, err := ParseAuthoritativeIP("127.0.0.256"); err == nil {
+		t.Fatalf("expected an invalid address to be refused")
+	}
+
+	tests := []struct {
+		addr  string
+		rtype uint16
+	}{
+		{"192.0.2.1", dns.TypeA},
+		{"2001:db8::1", dns.TypeAAAA},
+	}
+
+	// The address is replaced at runtime, as on failover.
+	ds := &DnsServer{rootDomain: "root"}
+	for _, test := range tests {
+		ip, err := ParseAuthoritativeIP(test.addr)
+		if err != nil {
+			t.Fatalf("unable to parse %v: %v", test.addr, err)
+		}
+		ds.SetAuthoritativeIP(ip)
+
+		// Only the query for the family of the address gets it, the
+		// other one gets no data along with the SOA.
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			resp := exchange(t, ds, "soa.root.", qtype)
+			if resp.Rcode != dns.RcodeSuccess {
+				t.Fatalf("expected NOERROR, got %v",
+					dns.RcodeToString[resp.Rcode])
+			}
+
+			if qtype != test.rtype {
+				if len(resp.Answer) != 0 || len(resp.Ns) != 1 {
+					t.Fatalf("expected no %v record for "+
+						"%v, got %v",
+						dns.TypeToString[qtype],
+						test.addr, resp)
+				}
+				continue
+			}
+
+			if len(resp.Answer) != 1 ||
+				resp.Answer[0].Header().Rrtype != qtype {
+
+				t.Fatalf("expected a %v record for %v, got %v",
+					dns.TypeToString[qtype], test.addr,
+					resp)
+			}
+		}
+	}
+}
+
+func TestChainAuthoritativeIP(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain:      "root",
+		authoritativeIP: net.ParseIP("192.0.2.1"),
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView()},
+			"ltc.": {
+				NetView:         NewNetworkView("litecoin"),
+				AuthoritativeIP: net.ParseIP("192.0.2.2"),
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		ip   string
+	}{
+		{"soa.root.", "192.0.2.1"},
+		{"soa.btc.root.", "192.0.2.1"},
+		{"soa.ltc.root.", "192.0.2.2"},
+		{"soa.litecoin.root.", "192.0.2.2"},
+	}
+	for _, test := range tests {
+		answer := exchange(t, ds, test.name, dns.TypeA).Answer
+		if len(answer) != 1 || answer[0].(*dns.A).A.String() != test.ip {
+			t.Fatalf("expected %v for %v, got %v", test.ip,
+				test.name, answer)
+		}
+	}
+}
+
+func TestAdaptiveTTL(t *testing.T) {
+	frequent := testNode("frequent", "1.1.1.1:9735")
+	frequent.UpdateInterval = 10 * time.Minute
+
+	stable := testNode("stable", "1.1.1.2:9735")
+	stable.UpdateInterval = 24 * time.Hour
+
+	unknown := testNode("unknown", "1.1.1.3:9735")
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(frequent, stable, unknown)},
+		},
+		cfg: DnsServerConfig{
+			AdaptiveTTL:    true,
+			MinAdaptiveTTL: 30,
+			MaxAdaptiveTTL: 600,
+		},
+	}
+
+	expected := map[string]uint32{
+		"1.1.1.1": 60,
+		"1.1.1.2": 600,
+		"1.1.1.3": defaultTTL,
+	}
+	answer := exchange(t, ds, "root.", dns.TypeA).Answer
+	if len(answer) != len(expected) {
+		t.Fatalf("expected %d answers, got %v", len(expected), answer)
+	}
+	for _, rr := range answer {
+		a := rr.(*dns.A)
+		if a.Hdr.Ttl != expected[a.A.String()] {
+			t.Fatalf("expected ttl %d for %v, got %d",
+				expected[a.A.String()], a.A, a.Hdr.Ttl)
+		}
+	}
+
+	// Without the flag the TTL stays fixed.
+	ds.cfg.AdaptiveTTL = false
+	if ttl := ds.nodeTTL(frequent); ttl != defaultTTL {
+		t.Fatalf("expected default ttl, got %d", ttl)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode("btc", "1.1.1.1:9735"),
+			)},
+			"ltc.": {NetView: &NetworkView{
+				chain: "litecoin",
+				reachableNodes: map[string]Node{
+					"ltc": testNode("ltc", "2.2.2.2:9735"),
+				},
+			}},
+		},
+	}
+
+	resp := exchange(t, ds, "discovery.root.", dns.TypeTXT)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected a single TXT record, got %v", resp.Answer)
+	}
+	txt := resp.Answer[0].(*dns.TXT).Txt
+	if len(txt) != 2 || txt[0] != "format=<chain>.root A|AAAA" ||
+		txt[1] != "chains=bitcoin,litecoin" {
+
+		t.Fatalf("unexpected discovery record: %v", txt)
+	}
+
+	// The advertised per-chain names must map to the chain's view.
+	for name, ip := range map[string]string{
+		"bitcoin.root.":  "1.1.1.1",
+		"litecoin.root.": "2.2.2.2",
+	} {
+		resp := exchange(t, ds, name, dns.TypeA)
+		if len(resp.Answer) != 1 ||
+			resp.Answer[0].(*dns.A).A.String() != ip {
+
+			t.Fatalf("expected %v for %v, got %v", ip, name,
+				resp.Answer)
+		}
+	}
+}
+
+func TestNAT64(t *testing.T) {
+	if _, err := ParseNAT64Prefix("64:ff9b::/64"); err == nil {
+		t.Fatalf("expected non /96 prefix to be rejected")
+	}
+	prefix, err := ParseNAT64Prefix("64:ff9b::/96")
+	if err != nil {
+		t.Fatalf("unable to parse prefix: %v", err)
+	}
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode("v4", "1.2.3.4:9735"),
+				testNode("v6", "[2001:db8::1]:9735"),
+			)},
+		},
+	}
+
+	query := func() []dns.RR {
+		return exchange(t, ds, "root.", dns.TypeAAAA).Answer
+	}
+
+	// Without a prefix only the native IPv6 node is returned.
+	if answer := query(); len(answer) != 1 {
+		t.Fatalf("expected a single record, got %v", answer)
+	}
+
+	ds.cfg.NAT64Prefix = prefix
+	answer := query()
+	if len(answer) != 2 {
+		t.Fatalf("expected two records, got %v", answer)
+	}
+	found := false
+	for _, rr := range answer {
+		if rr.(*dns.AAAA).AAAA.Equal(net.ParseIP("64:ff9b::102:304")) {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("no synthesized record in %v", answer)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	n := testNode("frequent", "1.1.1.1:9735")
+	n.UpdateInterval = 10 * time.Second
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(n)},
+		},
+		cfg: DnsServerConfig{
+			AdaptiveTTL: true,
+			MinTTL:      30,
+		},
+	}
+
+	// The adaptive TTL of the node is a single second.
+	if ttl := ds.nodeTTL(n); ttl != 1 {
+		t.Fatalf("expected computed ttl of 1, got %d", ttl)
+	}
+
+	answer := exchange(t, ds, "root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].Header().Ttl != 30 {
+		t.Fatalf("expected ttl floor to apply, got %v", answer)
+	}
+}
+
+func TestCanary(t *testing.T) {
+	nv := newTestView(
+		testNode("02aaaa", "1.1.1.1:9735"),
+		testNode("02bbbb", "2.2.2.2:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: nv},
+		},
+		cfg: DnsServerConfig{
+			CanaryNodeID: "02aaaa",
+		},
+	}
+
+	query := func() *dns.Msg {
+		return exchange(t, ds, "canary.root.", dns.TypeA)
+	}
+
+	resp := query()
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 ||
+		resp.Answer[0].(*dns.A).A.String() != "1.1.1.1" {
+
+		t.Fatalf("expected the canary's record, got %v", resp)
+	}
+
+	// Once the canary drops out of the view, monitoring must notice.
+	delete(nv.reachableNodes, "02aaaa")
+	if resp := query(); resp.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("expected SERVFAIL, got %v", resp)
+	}
+}
+
+func TestDefaultChain(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode("btc", "1.1.1.1:9735"),
+			)},
+			"ltc.": {NetView: newTestView(
+				testNode("ltc", "2.2.2.2:9735"),
+			)},
+		},
+		cfg: DnsServerConfig{
+			DefaultChain: "ltc.",
+		},
+	}
+
+	answer := exchange(t, ds, "root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].(*dns.A).A.String() != "2.2.2.2" {
+		t.Fatalf("expected the default chain to answer, got %v", answer)
+	}
+}
+
+func TestChainRotation(t *testing.T) {
+	if _, err := NewChainRotation([]string{""}, []int{0}); err == nil {
+		t.Fatalf("expected a zero weight to be refused")
+	}
+
+	rotation, err := NewChainRotation([]string{"", "ltc."}, []int{2, 1})
+	if err != nil {
+		t.Fatalf("unable to create rotation: %v", err)
+	}
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode("btc", "1.1.1.1:9735"),
+			)},
+			"ltc.": {NetView: newTestView(
+				testNode("ltc", "2.2.2.2:9735"),
+			)},
+		},
+		cache: newResponseCache(time.Minute),
+		cfg: DnsServerConfig{
+			ChainRotation: rotation,
+		},
+	}
+
+	// The queries not naming their chain follow the weights, whether
+	// their answer is cached or not, and describing them doesn't advance
+	// the rotation.
+	want := []string{
+		"1.1.1.1", "1.1.1.1", "2.2.2.2", "1.1.1.1", "1.1.1.1", "2.2.2.2",
+	}
+	for i, ip := range want {
+		if _, err := ds.DescribeQuery("root.", dns.TypeA); err != nil {
+			t.Fatalf("unable to describe query: %v", err)
+		}
+
+		answer := exchange(t, ds, "root.", dns.TypeA).Answer
+		if len(answer) != 1 || answer[0].(*dns.A).A.String() != ip {
+			t.Fatalf("expected %v for query %d, got %v", ip, i,
+				answer)
+		}
+	}
+
+	// The ones naming it aren't affected.
+	for i := 0; i < 3; i++ {
+		answer := exchange(t, ds, "ltc.root.", dns.TypeA).Answer
+		if len(answer) != 1 || answer[0].(*dns.A).A.String() != "2.2.2.2" {
+			t.Fatalf("expected the ltc node, got %v", answer)
+		}
+	}
+}
+
+func TestBitcoinAlias(t *testing.T) {
+	const nodeID = "02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1"
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode(nodeID, "1.1.1.1:9735"),
+			)},
+			"ltc.": {NetView: newTestView(
+				testNode("ltc", "2.2.2.2:9735"),
+			)},
+		},
+		cfg: DnsServerConfig{
+			DefaultChain: "ltc.",
+		},
+	}
+
+	// Bitcoin can be named explicitly, even if it isn't the default.
+	for _, name := range []string{"btc.root.", "bc.root.", "r0.btc.root."} {
+		answer := exchange(t, ds, name, dns.TypeA).Answer
+		if len(answer) != 1 || answer[0].(*dns.A).A.String() != "1.1.1.1" {
+			t.Fatalf("expected bitcoin to answer %v, got %v", name,
+				answer)
+		}
+	}
+
+	// The targets of SRV records resolve to the same chain.
+	resp := exchange(t, ds, "_nodes._tcp.btc.root.", dns.TypeSRV)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected a single SRV record, got %v", resp)
+	}
+	target := resp.Answer[0].(*dns.SRV).Target
+	answer := exchange(t, ds, target, dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].(*dns.A).A.String() != "1.1.1.1" {
+		t.Fatalf("expected %v to resolve to the bitcoin node, got %v",
+			target, answer)
+	}
+
+	// The bare root domain is still served by the default chain.
+	answer = exchange(t, ds, "root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].(*dns.A).A.String() != "2.2.2.2" {
+		t.Fatalf("expected the default chain to answer, got %v", answer)
+	}
+}
+
+func TestWarmCache(t *testing.T) {
+	btc := newTestView(testNode("old", "1.1.1.1:9735"))
+	startPruner(btc, func(string) bool { return true })
+	ltc := newTestView(testNode("ltc", "3.3.3.3:9735"))
+	chainViews := map[string]*ChainView{
+		"":     {NetView: btc},
+		"ltc.": {NetView: ltc},
+	}
+	ds := NewDnsServer(
+		chainViews, "", "", "root", nil,
+		&DnsServerConfig{
+			DefaultChain:     "ltc.",
+			ResponseCacheTTL: time.Minute,
+			WarmCache:        true,
+		},
+	)
+
+	// The poll hooks are called in order, so the cache was warmed once
+	// these are called.
+	btcPolled := make(chan struct{}, 1)
+	btc.OnPoll(func() { btcPolled <- struct{}{} })
+	ltcPolled := make(chan struct{}, 1)
+	ltc.OnPoll(func() { ltcPolled <- struct{}{} })
+
+	setReachable := func(nv *NetworkView, nodes ...Node) {
+		nv.Lock()
+		defer nv.Unlock()
+
+		nv.reachableNodes = make(map[string]Node)
+		for _, n := range nodes {
+			nv.reachableNodes[n.Id] = n
+		}
+	}
+	answerIPs := func(name string) []string {
+		var ips []string
+		for _, rr := range exchange(t, ds, name, dns.TypeA).Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		sort.Strings(ips)
+		return ips
+	}
+
+	// A successful poll should render the default queries of the chain
+	// into the cache once the polled nodes were checked, so they are
+	// served along with the others, even once the view changed.
+	btc.ApplyPoll(&PollResult{Nodes: []*lnrpc.LightningNode{{
+		PubKey: "02bbbb",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "2.2.2.2:9735"},
+		},
+	}}})
+	<-btcPolled
+	setReachable(btc, testNode("newer", "4.4.4.4:9735"))
+	setReachable(ltc, testNode("ltc", "5.5.5.5:9735"))
+
+	ips := answerIPs("btc.root.")
+	if !reflect.DeepEqual(ips, []string{"1.1.1.1", "2.2.2.2"}) {
+		t.Fatalf("expected the warmed response, got %v", ips)
+	}
+
+	// Queries which weren't warmed are rendered from the current view.
+	ips = answerIPs("r0.btc.root.")
+	if !reflect.DeepEqual(ips, []string{"4.4.4.4"}) {
+		t.Fatalf("expected a fresh response, got %v", ips)
+	}
+
+	// The bare root domain is served by the default chain, so it's only
+	// warmed by the polls of that chain.
+	ips = answerIPs("root.")
+	if !reflect.DeepEqual(ips, []string{"5.5.5.5"}) {
+		t.Fatalf("expected a fresh response, got %v", ips)
+	}
+
+	setReachable(ltc, testNode("ltc", "6.6.6.6:9735"))
+	markPolled(ltc)
+	<-ltcPolled
+	setReachable(ltc, testNode("ltc", "7.7.7.7:9735"))
+
+	ips = answerIPs("root.")
+	if !reflect.DeepEqual(ips, []string{"6.6.6.6"}) {
+		t.Fatalf("expected the warmed response, got %v", ips)
+	}
+
+	// With a rotation, it's warmed for each chain the rotation picks.
+	ds.cfg.ChainRotation, _ = NewChainRotation(
+		[]string{"", "ltc."}, []int{1, 1},
+	)
+	ds.warmCache("")
+	if _, _, ok := ds.cache.get("root.", dns.TypeA, ""); !ok {
+		t.Fatalf("expected the bare root domain to be warmed")
+	}
+}
+
+func TestServeStale(t *testing.T) {
+	nv := newTestView(testNode("a", "1.1.1.1:9735"))
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+		cfg: DnsServerConfig{
+			StaleAfter: time.Minute,
+		},
+	}
+
+	// The view was never polled, so it's stale and we fail.
+	resp := exchange(t, ds, "root.", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("expected SERVFAIL, got %v",
+			dns.RcodeToString[resp.Rcode])
+	}
+
+	// When serving stale data, the nodes are returned with a short TTL.
+	ds.cfg.ServeStale = true
+	answer := exchange(t, ds, "root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].Header().Ttl != staleTTL {
+		t.Fatalf("expected a stale answer, got %v", answer)
+	}
+	if ds.StaleResponses() != 1 {
+		t.Fatalf("expected 1 stale response, got %d",
+			ds.StaleResponses())
+	}
+
+	// Once polled, the view is fresh again.
+	markPolled(nv)
+	answer = exchange(t, ds, "root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].Header().Ttl != defaultTTL {
+		t.Fatalf("expected a fresh answer, got %v", answer)
+	}
+}
+
+func TestAgingTTL(t *testing.T) {
+	nv := newTestView(testNode("a", "1.1.1.1:9735"))
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+		cfg: DnsServerConfig{
+			StaleAfter: 90 * time.Second,
+			AgingTTL:   true,
+		},
+	}
+
+	// The TTL is untouched at first, then decreases as the view ages,
+	// down to the TTL of the stale responses.
+	lastTTL := uint32(defaultTTL + 1)
+	for _, age := range []time.Duration{
+		0, 40 * time.Second, 60 * time.Second, 80 * time.Second,
+		89 * time.Second,
+	} {
+		nv.Lock()
+		nv.lastPoll = time.Now().Add(-age)
+		nv.Unlock()
+
+		answer := exchange(t, ds, "root.", dns.TypeA).Answer
+		if len(answer) != 1 {
+			t.Fatalf("expected 1 answer at %v, got %v", age, answer)
+		}
+
+		ttl := answer[0].Header().Ttl
+		switch {
+		case age == 0 && ttl != defaultTTL:
+			t.Fatalf("expected a TTL of %d, got %d", defaultTTL, ttl)
+		case age > 0 && ttl >= lastTTL:
+			t.Fatalf("expected the TTL to decrease at %v, got %d "+
+				"after %d", age, ttl, lastTTL)
+		case ttl < staleTTL:
+			t.Fatalf("expected a TTL of at least %d, got %d",
+				staleTTL, ttl)
+		}
+		lastTTL = ttl
+	}
+}
+
+// slowSelector is a Selector taking delay to select the nodes.
+type slowSelector struct {
+	delay time.Duration
+}
+
+func (s slowSelector) Select(candidates []Node, query SelectQuery) []Node {
+	time.Sleep(s.delay)
+	return UniformSelector{}.Select(candidates, query)
+}
+
+func TestAnswerDeadline(t *testing.T) {
+	nv := newTestView(
+		testNode("a", "1.1.1.1:9735"),
+		testNode("b", "1.1.1.2:9735"),
+		testNode("c", "1.1.1.3:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+		cache:      newResponseCache(time.Minute),
+		cfg: DnsServerConfig{
+			AnswerDeadline: 50 * time.Millisecond,
+		},
+	}
+
+	query := func(name string) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetQuestion(name, dns.TypeA)
+
+		return ds.answer(req, &net.UDPAddr{})
+	}
+
+	// Answers assembled in time are returned as is.
+	if resp := query("root."); len(resp.Answer) != 3 {
+		t.Fatalf("expected 3 answers, got %v", resp)
+	}
+
+	// Past the deadline, we only answer with the best node rather than
+	// keep the client waiting.
+	nv.SetSelector(slowSelector{delay: 100 * time.Millisecond})
+	resp := query("r0.root.")
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != 1 {
+		t.Fatalf("expected a single answer, got %v", resp)
+	}
+	if ds.DeadlineExceeded() != 1 {
+		t.Fatalf("expected 1 exceeded deadline, got %d",
+			ds.DeadlineExceeded())
+	}
+
+	// The trimmed answer isn't cached, while the cached answers are still
+	// served whatever the selector's latency.
+	if _, _, ok := ds.cache.get("r0.root.", dns.TypeA, ""); ok {
+		t.Fatalf("expected the trimmed answer not to be cached")
+	}
+	if resp := query("root."); len(resp.Answer) != 3 {
+		t.Fatalf("expected the 3 cached answers, got %v", resp)
+	}
+	if ds.DeadlineExceeded() != 1 {
+		t.Fatalf("expected 1 exceeded deadline, got %d",
+			ds.DeadlineExceeded())
+	}
+}
+
+func TestSRVGlue(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(testNode(
+				"02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+				"1.1.1.1:9735", "[2001:db8::1]:9735",
+			))},
+		},
+	}
+
+	resp := exchange(t, ds, "_nodes._tcp.root.", dns.TypeSRV)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 2 {
+		t.Fatalf("expected one SRV record with its glue, got %v", resp)
+	}
+	target := resp.Answer[0].(*dns.SRV).Target
+
+	// Resolving the target directly yields the same records as the glue.
+	for i, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		answer := exchange(t, ds, target, qtype).Answer
+		if len(answer) != 1 || answer[0].String() != resp.Extra[i].String() {
+			t.Fatalf("expected %v for %v, got %v", resp.Extra[i],
+				target, answer)
 		}
 	}
 }
+
+func TestNodeQuery(t *testing.T) {
+	const nodeID = "02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1"
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(testNode(nodeID, "1.1.1.1:9735"))},
+		},
+	}
+
+	rawID, _ := hex.DecodeString(nodeID)
+	converted, _ := bech32.ConvertBits(rawID, 8, 5, true)
+	name, err := bech32.Encode("ln", converted)
+	if err != nil {
+		t.Fatalf("unable to encode node ID: %v", err)
+	}
+
+	answer := exchange(t, ds, name+".root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].(*dns.A).A.String() != "1.1.1.1" {
+		t.Fatalf("expected the node's address, got %v", answer)
+	}
+
+	// Nodes which aren't in the view don't exist.
+	delete(ds.chainViews[""].NetView.reachableNodes, nodeID)
+	resp := exchange(t, ds, name+".root.", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN, got %v", resp)
+	}
+}
+
+func TestNodeIDHRP(t *testing.T) {
+	const nodeID = "02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1"
+
+	for _, hrp := range []string{DefaultNodeIDHRP, "tln", "sln"} {
+		encoded, err := EncodeNodeID(nodeID, hrp)
+		if err != nil {
+			t.Fatalf("unable to encode with %v: %v", hrp, err)
+		}
+		if len(encoded) > 63 {
+			t.Fatalf("%v doesn't fit in a label", encoded)
+		}
+
+		decodedHRP, id, err := DecodeNodeID(encoded)
+		if err != nil {
+			t.Fatalf("unable to decode %v: %v", encoded, err)
+		}
+		if decodedHRP != hrp || id != nodeID {
+			t.Fatalf("expected %v %v, got %v %v", hrp, nodeID,
+				decodedHRP, id)
+		}
+	}
+
+	for _, hrp := range []string{"", "lntb", "t1n", "TLN"} {
+		if ValidateNodeIDHRP(hrp) == nil {
+			t.Fatalf("expected %q to be refused", hrp)
+		}
+	}
+
+	// The same node is known on both chains, at different addresses.
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode(nodeID, "1.1.1.1:9735"),
+			)},
+			"test.": {
+				NetView: newTestView(
+					testNode(nodeID, "2.2.2.2:9735"),
+				),
+				NodeIDHRP: "tln",
+			},
+		},
+	}
+
+	// The node names of the testnet nodes use its HRP.
+	answer := exchange(t, ds, "_nodes._tcp.test.root.", dns.TypeSRV).Answer
+	if len(answer) != 1 ||
+		!strings.HasPrefix(answer[0].(*dns.SRV).Target, "tln1") {
+
+		t.Fatalf("expected a tln node name, got %v", answer)
+	}
+	target := answer[0].(*dns.SRV).Target
+
+	// They target the testnet node, even without the chain prefix.
+	tln, _ := EncodeNodeID(nodeID, "tln")
+	for _, name := range []string{target, tln + ".root."} {
+		answer = exchange(t, ds, name, dns.TypeA).Answer
+		if len(answer) != 1 ||
+			answer[0].(*dns.A).A.String() != "2.2.2.2" {
+
+			t.Fatalf("expected the testnet node for %v, got %v",
+				name, answer)
+		}
+	}
+
+	// While the default HRP keeps targeting the default chain.
+	ln, _ := EncodeNodeID(nodeID, DefaultNodeIDHRP)
+	answer = exchange(t, ds, ln+".root.", dns.TypeA).Answer
+	if len(answer) != 1 || answer[0].(*dns.A).A.String() != "1.1.1.1" {
+		t.Fatalf("expected the mainnet node, got %v", answer)
+	}
+
+	// A testnet node ID can't be looked up on another chain.
+	if _, err := ds.parseRequest(tln+".btc.root.", dns.TypeA); err == nil {
+		t.Fatalf("expected a testnet node ID to be refused on btc")
+	}
+}
+
+func TestShuffleAnswers(t *testing.T) {
+	nv := newTestView(
+		testNode("02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+			"1.1.1.1:9735"),
+		testNode("03864ef025fde8fb587d989186ce6a4a186895ee44a926bfc370e2c366597a3f8f",
+			"2.2.2.2:9735"),
+	)
+	nv.SetSelector(CapacitySelector{})
+	nv.SetCapacities(map[string]int64{
+		"02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1": 1e12,
+	})
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+	}
+
+	firsts := func() map[string]int {
+		counts := make(map[string]int)
+		for i := 0; i < 50; i++ {
+			resp := exchange(t, ds, "_nodes._tcp.root.", dns.TypeSRV)
+
+			// The glue follows the order of the answers.
+			for i, rr := range resp.Answer {
+				target := rr.(*dns.SRV).Target
+				if resp.Extra[i].Header().Name != target {
+					t.Fatalf("glue out of order: %v", resp)
+				}
+			}
+			counts[resp.Extra[0].(*dns.A).A.String()]++
+		}
+		return counts
+	}
+
+	// The capacity selector ranks the large node first, every time.
+	if counts := firsts(); counts["1.1.1.1"] != 50 {
+		t.Fatalf("expected the large node first, got %v", counts)
+	}
+
+	// Once shuffled, both come first in turn.
+	ds.cfg.ShuffleAnswers = true
+	if counts := firsts(); counts["1.1.1.1"] == 50 || counts["2.2.2.2"] == 0 {
+		t.Fatalf("expected a shuffled order, got %v", counts)
+	}
+}
+
+func TestVersionRecord(t *testing.T) {
+	nv := newTestView(
+		testNode("02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+			"1.1.1.1:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+	}
+
+	query := func() *dns.Msg {
+		return exchange(t, ds, "version.root.", dns.TypeTXT)
+	}
+
+	// The version isn't advertised unless enabled.
+	if resp := query(); len(resp.Answer) != 0 {
+		t.Fatalf("expected no version record, got %v", resp.Answer)
+	}
+
+	ds.cfg.Version = "v0.1.0-abcdef"
+	resp := query()
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected a single TXT record, got %v", resp.Answer)
+	}
+	txt := resp.Answer[0].(*dns.TXT).Txt
+	if len(txt) != 1 || txt[0] != "v0.1.0-abcdef" {
+		t.Fatalf("unexpected version record: %v", txt)
+	}
+}
+
+func TestPingName(t *testing.T) {
+	nv := newTestView(testNode("a", "1.1.1.1:9735"))
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+		cfg: DnsServerConfig{
+			StaleAfter: time.Minute,
+			PingName:   "health",
+			MinTTL:     30,
+		},
+	}
+
+	// Until a chain is polled, the server isn't healthy.
+	resp := exchange(t, ds, "health.root.", dns.TypeA)
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("expected SERVFAIL, got %v",
+			dns.RcodeToString[resp.Rcode])
+	}
+
+	// Once healthy, the ping name has a fixed answer, whatever the nodes.
+	markPolled(nv)
+	answer := exchange(t, ds, "health.root.", dns.TypeA).Answer
+	if len(answer) != 1 || !answer[0].(*dns.A).A.Equal(pingIP) {
+		t.Fatalf("expected %v, got %v", pingIP, answer)
+	}
+
+	// It's not to be cached, whatever the TTL floor.
+	if answer[0].Header().Ttl != pingTTL {
+		t.Fatalf("expected a TTL of %d, got %d", pingTTL,
+			answer[0].Header().Ttl)
+	}
+	answer = exchange(t, ds, "health.root.", dns.TypeTXT).Answer
+	if len(answer) != 1 || answer[0].(*dns.TXT).Txt[0] != "ok" {
+		t.Fatalf("expected ok, got %v", answer)
+	}
+}
+
+func TestAnswerTSIG(t *testing.T) {
+	nv := newTestView(
+		testNode("02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+			"1.1.1.1:9735"),
+	)
+	key := []byte("shared secret")
+	secret := base64.StdEncoding.EncodeToString(key)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+		cfg:        DnsServerConfig{AnswerHMACKey: key},
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := ds.newUDPServer(
+		conn, dns.HandlerFunc(ds.handleLightningDns),
+	)
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	// query returns the raw response to an SRV query.
+	query := func() []byte {
+		client, err := net.Dial("udp", conn.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("unable to dial: %v", err)
+		}
+		defer client.Close()
+
+		m := new(dns.Msg)
+		m.SetQuestion("_nodes._tcp.root.", dns.TypeSRV)
+		b, err := m.Pack()
+		if err != nil {
+			t.Fatalf("unable to pack query: %v", err)
+		}
+		if _, err := client.Write(b); err != nil {
+			t.Fatalf("unable to send query: %v", err)
+		}
+
+		b = make([]byte, dns.MaxMsgSize)
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := client.Read(b)
+		if err != nil {
+			t.Fatalf("unable to read response: %v", err)
+		}
+		return b[:n]
+	}
+
+	// verify checks the TSIG record of a raw response with the secret,
+	// which strips it from the buffer it's given.
+	verify := func(b []byte, secret string) error {
+		return dns.TsigVerify(append([]byte(nil), b...), secret, "",
+			false)
+	}
+
+	// Check the TSIG record the way a client would, from the wire.
+	b := query()
+	if err := verify(b, secret); err != nil {
+		t.Fatalf("expected a valid TSIG record: %v", err)
+	}
+	resp := new(dns.Msg)
+	if err := resp.Unpack(b); err != nil {
+		t.Fatalf("unable to unpack response: %v", err)
+	}
+	if tsig := resp.IsTsig(); tsig == nil || tsig.Hdr.Name != "root." {
+		t.Fatalf("expected a TSIG record for root., got %v", resp)
+	}
+
+	// Neither the header of the response, e.g. its rcode, nor its records
+	// can be tampered with.
+	tampered := append([]byte(nil), b...)
+	tampered[3] |= dns.RcodeNameError
+	if verify(tampered, secret) == nil {
+		t.Fatalf("expected a tampered rcode to fail verification")
+	}
+	resp.Answer[0].(*dns.SRV).Port++
+	tampered, err = resp.Pack()
+	if err != nil {
+		t.Fatalf("unable to pack response: %v", err)
+	}
+	if verify(tampered, secret) == nil {
+		t.Fatalf("expected a tampered answer to fail verification")
+	}
+
+	// Nor is it valid for another secret.
+	other := base64.StdEncoding.EncodeToString([]byte("other secret"))
+	if verify(b, other) == nil {
+		t.Fatalf("expected another secret to fail verification")
+	}
+
+	// Nothing is signed unless enabled. The server above may still be
+	// reading its config, so a separate one is used.
+	unsigned := &DnsServer{
+		rootDomain: "root",
+		chainViews: ds.chainViews,
+	}
+	resp = exchange(t, unsigned, "_nodes._tcp.root.", dns.TypeSRV)
+	if resp.IsTsig() != nil {
+		t.Fatalf("unexpected TSIG record in %v", resp)
+	}
+}
+
+func TestUnknownChain(t *testing.T) {
+	nv := newTestView(
+		testNode("02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+			"1.1.1.1:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+	}
+
+	query := func(name string) *dns.Msg {
+		return exchange(t, ds, name, dns.TypeA)
+	}
+
+	// The chains we serve are answered as usual.
+	for _, name := range []string{"root.", "r0.n5.d1.root."} {
+		resp := query(name)
+		if resp.Rcode != dns.RcodeSuccess {
+			t.Fatalf("expected %v to succeed, got %v", name,
+				dns.RcodeToString[resp.Rcode])
+		}
+	}
+
+	// Both a prefix we don't know of and a known one whose chain isn't
+	// configured don't exist.
+	for _, name := range []string{"doge.root.", "r0.doge.root.", "ltc.root."} {
+		resp := query(name)
+		if resp.Rcode != dns.RcodeNameError || len(resp.Answer) != 0 {
+			t.Fatalf("expected NXDOMAIN for %v, got %v", name, resp)
+		}
+	}
+
+	// With doge and ltc taking two slots, the last two prefixes are past
+	// the cap and counted together.
+	for i := 0; i < maxUnknownChains; i++ {
+		query(fmt.Sprintf("chain%d.root.", i))
+	}
+	counts := ds.UnknownChainQueries()
+	if len(counts) != maxUnknownChains+1 {
+		t.Fatalf("expected %d prefixes, got %v", maxUnknownChains+1,
+			counts)
+	}
+	if counts["doge"] != 2 || counts["ltc"] != 1 ||
+		counts[otherUnknownChain] != 2 {
+
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
+
+func TestCountRecord(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode("v4", "1.1.1.1:9735"),
+				testNode("v6", "[2001:db8::1]:9735"),
+				testNode("dual", "1.1.1.2:9735", "[2001:db8::2]:9735"),
+			)},
+			"ltc.": {NetView: &NetworkView{
+				chain: "litecoin",
+				reachableNodes: map[string]Node{
+					"ltc": testNode("ltc", "2.2.2.2:9735"),
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name string
+		txt  string
+	}{
+		{"count.root.", "total=3 ipv4=2 ipv6=2 onion=0"},
+		{"count.ltc.root.", "total=1 ipv4=1 ipv6=0 onion=0"},
+		{"count.litecoin.root.", "total=1 ipv4=1 ipv6=0 onion=0"},
+	}
+	for _, test := range tests {
+		answer := exchange(t, ds, test.name, dns.TypeTXT).Answer
+		if len(answer) != 1 {
+			t.Fatalf("expected a single TXT record for %v, got %v",
+				test.name, answer)
+		}
+		txt := answer[0].(*dns.TXT).Txt
+		if len(txt) != 1 || txt[0] != test.txt {
+			t.Fatalf("unexpected count for %v: %v", test.name, txt)
+		}
+	}
+}
+
+func TestDefaultAddressTypes(t *testing.T) {
+	id := func(b string) string {
+		return "02" + strings.Repeat(b, 32)
+	}
+	nv := newTestView(
+		testNode(id("aa"), "1.1.1.1:9735"),
+		testNode(id("bb"), "[2001:db8::1]:9735"),
+		testNode(id("cc"), "1.1.1.2:9735", "[2001:db8::2]:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+	}
+
+	// query returns the number of SRV records, and of A and AAAA glue
+	// records.
+	query := func(name string) (int, int, int) {
+		resp := exchange(t, ds, name, dns.TypeSRV)
+
+		var a, aaaa int
+		for _, rr := range resp.Extra {
+			switch rr.(type) {
+			case *dns.A:
+				a++
+			case *dns.AAAA:
+				aaaa++
+			}
+		}
+		return len(resp.Answer), a, aaaa
+	}
+
+	tests := []struct {
+		defaults     int
+		name         string
+		srv, a, aaaa int
+	}{
+		// Both families are served by default.
+		{0, "_nodes._tcp.root.", 3, 2, 2},
+
+		// A chain can default to a single family.
+		{AddressTypeIPv6, "_nodes._tcp.root.", 2, 0, 2},
+		{AddressTypeIPv4, "_nodes._tcp.root.", 2, 2, 0},
+
+		// An explicit a condition overrides the default.
+		{AddressTypeIPv6, "a2._nodes._tcp.root.", 2, 2, 0},
+		{AddressTypeIPv4, "a6._nodes._tcp.root.", 3, 2, 2},
+	}
+	for _, test := range tests {
+		nv.SetDefaultAddressTypes(test.defaults)
+
+		srv, a, aaaa := query(test.name)
+		if srv != test.srv || a != test.a || aaaa != test.aaaa {
+			t.Fatalf("expected %d SRV, %d A and %d AAAA records "+
+				"for %v with defaults %d, got %d, %d and %d",
+				test.srv, test.a, test.aaaa, test.name,
+				test.defaults, srv, a, aaaa)
+		}
+	}
+}
+
+func TestMinimalResponse(t *testing.T) {
+	id := func(b string) string {
+		return "02" + strings.Repeat(b, 32)
+	}
+	nv := newTestView(
+		testNode(id("aa"), "1.1.1.1:9735"),
+		testNode(id("bb"), "[2001:db8::1]:9735"),
+		testNode(id("cc"), "1.1.1.2:9735", "[2001:db8::2]:9735"),
+	)
+	nv.SetCapacities(map[string]int64{id("aa"): 1e9, id("cc"): 1e6})
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+	}
+
+	// A minimal response holds a single node, with the records of its
+	// other address family alongside. The dual-stack node is preferred.
+	resp := exchange(t, ds, "min.root.", dns.TypeA)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 1 ||
+		resp.Answer[0].(*dns.A).A.String() != "1.1.1.2" ||
+		resp.Extra[0].(*dns.AAAA).AAAA.String() != "2001:db8::2" {
+
+		t.Fatalf("unexpected minimal A response: %v", resp)
+	}
+
+	resp = exchange(t, ds, "min.root.", dns.TypeAAAA)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 1 ||
+		resp.Answer[0].(*dns.AAAA).AAAA.String() != "2001:db8::2" ||
+		resp.Extra[0].(*dns.A).A.String() != "1.1.1.2" {
+
+		t.Fatalf("unexpected minimal AAAA response: %v", resp)
+	}
+
+	resp = exchange(t, ds, "min._nodes._tcp.root.", dns.TypeSRV)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 2 {
+		t.Fatalf("unexpected minimal SRV response: %v", resp)
+	}
+
+	// Without a dual-stack node, the one with the most capacity wins.
+	delete(nv.reachableNodes, id("cc"))
+	resp = exchange(t, ds, "min.root.", dns.TypeA)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 0 ||
+		resp.Answer[0].(*dns.A).A.String() != "1.1.1.1" {
+
+		t.Fatalf("unexpected minimal A response: %v", resp)
+	}
+}
+
+func TestMinimalUDPSize(t *testing.T) {
+	nv := newTestView(
+		testNode("02aaaa", "1.1.1.1:9735"),
+		testNode("02bbbb", "1.1.1.2:9735"),
+		testNode("02cccc", "1.1.1.3:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: nv}},
+		cache:      newResponseCache(time.Minute),
+		cfg: DnsServerConfig{
+			MinimalUDPSize: 512,
+		},
+	}
+
+	// query asks for the A records of the nodes, advertising the given
+	// EDNS0 buffer size unless zero, and returns the number of answers.
+	query := func(size uint16, client net.Addr) int {
+		r := new(dns.Msg)
+		r.SetQuestion("root.", dns.TypeA)
+		if size != 0 {
+			r.SetEdns0(size, false)
+		}
+
+		resp := ds.answer(r, client)
+		if resp == nil || resp.Rcode != dns.RcodeSuccess {
+			t.Fatalf("unexpected response: %v", resp)
+		}
+		return len(resp.Answer)
+	}
+
+	tests := []struct {
+		size    uint16
+		client  net.Addr
+		answers int
+	}{
+		// A client with a tiny buffer only gets the best node, as
+		// does one without EDNS0, limited to 512 bytes.
+		{512, &net.UDPAddr{}, 1},
+		{0, &net.UDPAddr{}, 1},
+
+		// The others get the full, and cached, response.
+		{1232, &net.UDPAddr{}, 3},
+		{512, &net.TCPAddr{}, 3},
+		{0, &net.TCPAddr{}, 3},
+
+		// The cached response isn't served to a tiny buffer either.
+		{512, &net.UDPAddr{}, 1},
+		{0, &net.UDPAddr{}, 1},
+	}
+	for _, test := range tests {
+		answers := query(test.size, test.client)
+		if answers != test.answers {
+			t.Fatalf("expected %d answers with a buffer of %d bytes "+
+				"from %T, got %d", test.answers, test.size,
+				test.client, answers)
+		}
+	}
+
+	// Disabled, every client gets the full response.
+	ds.cfg.MinimalUDPSize = 0
+	if answers := query(0, &net.UDPAddr{}); answers != 3 {
+		t.Fatalf("expected 3 answers when disabled, got %d", answers)
+	}
+}
+
+func TestMaxAddressesPerNode(t *testing.T) {
+	const nodeID = "02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1"
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(testNode(nodeID,
+				"1.1.1.1:9735", "1.1.1.2:9735",
+				"1.1.1.3:9735", "[2001:db8::1]:9735",
+				"[2001:db8::2]:9735",
+			))},
+		},
+		cfg: DnsServerConfig{MaxAddressesPerNode: 2},
+	}
+
+	// With a cap of 2, the node contributes its first address of each
+	// family, and nothing else.
+	resp := exchange(t, ds, "_nodes._tcp.root.", dns.TypeSRV)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 2 ||
+		resp.Extra[0].(*dns.A).A.String() != "1.1.1.1" ||
+		resp.Extra[1].(*dns.AAAA).AAAA.String() != "2001:db8::1" {
+
+		t.Fatalf("unexpected capped SRV response: %v", resp)
+	}
+
+	resp = exchange(t, ds, "root.", dns.TypeA)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected a single A record, got %v", resp)
+	}
+
+	// The cap is filled up with the further addresses in order.
+	ds.cfg.MaxAddressesPerNode = 3
+	resp = exchange(t, ds, "root.", dns.TypeA)
+	if len(resp.Answer) != 2 ||
+		resp.Answer[0].(*dns.A).A.String() != "1.1.1.1" ||
+		resp.Answer[1].(*dns.A).A.String() != "1.1.1.2" {
+
+		t.Fatalf("unexpected capped A response: %v", resp)
+	}
+
+	// Without a cap, all the addresses are returned.
+	ds.cfg.MaxAddressesPerNode = 0
+	resp = exchange(t, ds, "_nodes._tcp.root.", dns.TypeSRV)
+	if len(resp.Extra) != 5 {
+		t.Fatalf("expected all five addresses, got %v", resp)
+	}
+
+	// The view itself is left untouched.
+	n, _ := ds.chainViews[""].NetView.Lookup(nodeID)
+	if len(n.Addresses) != 5 {
+		t.Fatalf("expected the node to keep its addresses, got %v",
+			n.Addresses)
+	}
+}
+
+func TestFallbackSeeds(t *testing.T) {
+	seeds, err := ParseSeedList(" lseed.example.com, ,Other.Example.org")
+	if err != nil {
+		t.Fatalf("unable to parse seeds: %v", err)
+	}
+	if !reflect.DeepEqual(seeds, []string{
+		"lseed.example.com.", "other.example.org.",
+	}) {
+		t.Fatalf("unexpected seeds: %v", seeds)
+	}
+	if _, err := ParseSeedList("bad..seed"); err == nil {
+		t.Fatalf("expected an invalid seed to be refused")
+	}
+
+	chainView := &ChainView{
+		NetView: newTestView(testNode(
+			"02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+			"1.1.1.1:9735",
+		)),
+		FallbackSeeds: []string{"lseed.example.com."},
+	}
+	ds := &DnsServer{
+		rootDomain:      "root",
+		authoritativeIP: net.ParseIP("192.0.2.1"),
+		chainViews:      map[string]*ChainView{"test.": chainView},
+		cfg:             DnsServerConfig{FallbackMinNodes: 2},
+	}
+
+	// With too few nodes, queries are referred to the fallback seed,
+	// with their standard conditions only.
+	resp := exchange(t, ds, "a2.d1._nodes._tcp.test.root.", dns.TypeSRV)
+	if len(resp.Answer) != 1 {
+		t.Fatalf("expected a referral, got %v", resp)
+	}
+	cname, ok := resp.Answer[0].(*dns.CNAME)
+	if !ok || cname.Target != "a2._nodes._tcp.lseed.example.com." {
+		t.Fatalf("unexpected referral: %v", resp.Answer[0])
+	}
+
+	resp = exchange(t, ds, "r0.test.root.", dns.TypeA)
+	cname, ok = resp.Answer[0].(*dns.CNAME)
+	if !ok || cname.Target != "r0.lseed.example.com." {
+		t.Fatalf("unexpected referral: %v", resp.Answer[0])
+	}
+
+	// The bare name of the chain is not referred, as it's the apex of
+	// the zone.
+	resp = exchange(t, ds, "test.root.", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Rrtype != dns.TypeA {
+		t.Fatalf("expected the node, got %v", resp)
+	}
+	resp = exchange(t, ds, "root.", dns.TypeA)
+	for _, rr := range resp.Answer {
+		if _, ok := rr.(*dns.CNAME); ok {
+			t.Fatalf("unexpected referral: %v", rr)
+		}
+	}
+
+	// The dummy record is still served by us.
+	resp = exchange(t, ds, "soa.test.root.", dns.TypeA)
+	if _, ok := resp.Answer[0].(*dns.A); !ok {
+		t.Fatalf("unexpected referral: %v", resp.Answer[0])
+	}
+
+	// The fallback seed is picked with the source of randomness of the
+	// view, so the picks can be reproduced.
+	chainView.FallbackSeeds = []string{
+		"a.example.com.", "b.example.com.", "c.example.com.",
+	}
+	picks := func() []string {
+		chainView.NetView.SetRand(rand.New(rand.NewSource(1)))
+
+		var targets []string
+		for i := 0; i < 8; i++ {
+			resp := exchange(t, ds, "r0.test.root.", dns.TypeA)
+			targets = append(
+				targets, resp.Answer[0].(*dns.CNAME).Target,
+			)
+		}
+		return targets
+	}
+	if a, b := picks(), picks(); !reflect.DeepEqual(a, b) {
+		t.Fatalf("expected the same picks, got %v and %v", a, b)
+	}
+
+	// Once we know enough nodes, we answer ourselves.
+	ds.cfg.FallbackMinNodes = 1
+	resp = exchange(t, ds, "r0.test.root.", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].Header().Rrtype != dns.TypeA {
+		t.Fatalf("expected the node, got %v", resp)
+	}
+}
+
+func TestAddressAnswerSRV(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(testNode(
+				"02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+				"1.1.1.1:9735", "[2001:db8::1]:9735",
+			))},
+		},
+	}
+
+	// By default, only the address records are returned.
+	resp := exchange(t, ds, "root.", dns.TypeA)
+	if len(resp.Answer) != 1 || len(resp.Extra) != 0 {
+		t.Fatalf("expected a single A record, got %v", resp)
+	}
+
+	// Otherwise, the SRV record of the node and its glue of the queried
+	// family are added, as for an SRV query.
+	ds.cfg.AddressAnswerSRV = true
+	srv := exchange(t, ds, "_nodes._tcp.root.", dns.TypeSRV)
+	for i, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		resp := exchange(t, ds, "root.", qtype)
+		if len(resp.Answer) != 1 || len(resp.Extra) != 2 ||
+			resp.Answer[0].Header().Rrtype != qtype {
+
+			t.Fatalf("unexpected %v response: %v",
+				dns.TypeToString[qtype], resp)
+		}
+		if resp.Extra[0].String() != srv.Answer[0].String() {
+			t.Fatalf("expected %v, got %v", srv.Answer[0],
+				resp.Extra[0])
+		}
+		if resp.Extra[1].String() != srv.Extra[i].String() {
+			t.Fatalf("expected %v, got %v", srv.Extra[i],
+				resp.Extra[1])
+		}
+	}
+}
+
+func TestExcludeClientSubnet(t *testing.T) {
+	id := func(b string) string {
+		return "02" + strings.Repeat(b, 32)
+	}
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {NetView: newTestView(
+				testNode(id("aa"), "1.1.1.1:9735"),
+				testNode(id("bb"), "2.2.2.2:9735"),
+			)},
+		},
+		cfg: DnsServerConfig{ExcludeClientSubnet: true},
+	}
+
+	query := func(client net.Addr, ecs *dns.EDNS0_SUBNET) []string {
+		req := new(dns.Msg)
+		req.SetQuestion("root.", dns.TypeA)
+		if ecs != nil {
+			req.SetEdns0(dns.DefaultMsgSize, false)
+			opt := req.IsEdns0()
+			opt.Option = append(opt.Option, ecs)
+		}
+
+		resp := ds.answer(req, client)
+		if resp == nil {
+			t.Fatalf("no answer")
+		}
+
+		var ips []string
+		for _, rr := range resp.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+
+	// A node querying us directly doesn't get itself back.
+	client := &net.TCPAddr{IP: net.ParseIP("1.1.1.1")}
+	if ips := query(client, nil); !reflect.DeepEqual(ips, []string{"2.2.2.2"}) {
+		t.Fatalf("expected the client to be excluded, got %v", ips)
+	}
+
+	// Behind a resolver, the client subnet option is used instead.
+	ecs := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: 24,
+		Address:       net.ParseIP("2.2.2.0").To4(),
+	}
+	if ips := query(client, ecs); !reflect.DeepEqual(ips, []string{"1.1.1.1"}) {
+		t.Fatalf("expected the client subnet to be excluded, got %v", ips)
+	}
+
+	// Subnets too coarse to be meaningful are ignored.
+	ecs.SourceNetmask = 8
+	if ips := query(client, ecs); len(ips) != 2 {
+		t.Fatalf("expected both nodes, got %v", ips)
+	}
+
+	// Unless enabled, the client gets all the nodes.
+	ds.cfg.ExcludeClientSubnet = false
+	if ips := query(client, nil); len(ips) != 2 {
+		t.Fatalf("expected both nodes, got %v", ips)
+	}
+}
+
+func TestDescribeQuery(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"":     {NetView: newTestView()},
+			"ltc.": {NetView: &NetworkView{chain: "litecoin"}},
+		},
+	}
+
+	description, err := ds.DescribeQuery("r0.a2.n5.ltc.root", dns.TypeSRV)
+	if err != nil {
+		t.Fatalf("unable to describe query: %v", err)
+	}
+	for _, line := range []string{
+		"chain:         litecoin\n",
+		"address types: 2 (ipv4)\n",
+		"count:         5",
+	} {
+		if !strings.Contains(description, line) {
+			t.Fatalf("expected %q in:\n%v", line, description)
+		}
+	}
+
+	for _, name := range []string{"doge.root", "root.example", "lfoo.root"} {
+		if _, err := ds.DescribeQuery(name, dns.TypeA); err == nil {
+			t.Fatalf("expected %v to be refused", name)
+		}
+	}
+}
+
+func TestBootstrapName(t *testing.T) {
+	id := func(b string) string {
+		return "02" + strings.Repeat(b, 32)
+	}
+	nv := newTestView(
+		testNode(id("aa"), "1.1.1.1:9735"),
+		testNode(id("bb"), "2.2.2.2:9735"),
+		testNode(id("cc"), "3.3.3.3:9735"),
+		testNode(id("ee"), "5.5.5.5:9735"),
+		testNode(id("ff"), "[2001:db8::6]:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {
+				NetView: nv,
+				BootstrapNodes: []string{
+					id("cc"), id("dd"), id("bb"),
+				},
+			},
+		},
+		cfg: DnsServerConfig{BootstrapName: "bootstrap"},
+	}
+
+	ips := func(resp *dns.Msg) []string {
+		var ips []string
+		for _, rr := range resp.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+
+	// The curated nodes we know of are served in order, the unknown one
+	// is left out.
+	resp := exchange(t, ds, "bootstrap.root.", dns.TypeA)
+	if got := ips(resp); !reflect.DeepEqual(got, []string{"3.3.3.3", "2.2.2.2"}) {
+		t.Fatalf("expected the curated nodes, got %v", got)
+	}
+
+	// The other names still get a random sample.
+	resp = exchange(t, ds, "root.", dns.TypeA)
+	if got := ips(resp); len(got) != 4 {
+		t.Fatalf("expected all 4 nodes, got %v", got)
+	}
+
+	// A curated node which went away isn't handed out anymore.
+	nv.Lock()
+	delete(nv.reachableNodes, id("cc"))
+	nv.Unlock()
+	resp = exchange(t, ds, "bootstrap.root.", dns.TypeA)
+	if got := ips(resp); !reflect.DeepEqual(got, []string{"2.2.2.2"}) {
+		t.Fatalf("expected the reachable curated node, got %v", got)
+	}
+
+	// Without any reachable curated node of the queried family, a random
+	// sample is better than leaving the client stranded.
+	resp = exchange(t, ds, "bootstrap.root.", dns.TypeAAAA)
+	if len(resp.Answer) != 1 ||
+		resp.Answer[0].(*dns.AAAA).AAAA.String() != "2001:db8::6" {
+
+		t.Fatalf("expected a random sample, got %v", resp.Answer)
+	}
+
+	nv.Lock()
+	delete(nv.reachableNodes, id("bb"))
+	nv.Unlock()
+	resp = exchange(t, ds, "bootstrap.root.", dns.TypeA)
+	if got := ips(resp); len(got) != 2 {
+		t.Fatalf("expected a random sample, got %v", got)
+	}
+
+	// Unless configured, the bootstrap name doesn't exist.
+	ds.cfg.BootstrapName = ""
+	resp = exchange(t, ds, "bootstrap.root.", dns.TypeA)
+	if resp.Rcode != dns.RcodeNameError {
+		t.Fatalf("expected NXDOMAIN, got %v", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	const nodeID = "02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1"
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: newTestView()}},
+		cfg:        DnsServerConfig{NegativeTTL: 15},
+	}
+
+	rawID, _ := hex.DecodeString(nodeID)
+	converted, _ := bech32.ConvertBits(rawID, 8, 5, true)
+	nodeName, err := bech32.Encode("ln", converted)
+	if err != nil {
+		t.Fatalf("unable to encode node ID: %v", err)
+	}
+
+	// Both unknown chains and unknown nodes carry the SOA record, with
+	// the negative caching TTL as its minimum.
+	for _, name := range []string{"doge.root.", nodeName + ".root."} {
+		resp := exchange(t, ds, name, dns.TypeA)
+		if resp.Rcode != dns.RcodeNameError || len(resp.Ns) != 1 {
+			t.Fatalf("expected NXDOMAIN with an SOA for %v, got %v",
+				name, resp)
+		}
+
+		soa, ok := resp.Ns[0].(*dns.SOA)
+		if !ok || soa.Hdr.Name != "root." || soa.Minttl != 15 ||
+			soa.Hdr.Ttl != 15 || soa.Ns != "soa.root." {
+
+			t.Fatalf("unexpected SOA for %v: %v", name, resp.Ns[0])
+		}
+	}
+
+	// Successful answers don't carry it.
+	resp := exchange(t, ds, "root.", dns.TypeA)
+	if resp.Rcode != dns.RcodeSuccess || len(resp.Ns) != 0 {
+		t.Fatalf("expected no SOA in a successful answer, got %v", resp)
+	}
+
+	// The default keeps negative answers short-lived.
+	ds.cfg.NegativeTTL = 0
+	resp = exchange(t, ds, "doge.root.", dns.TypeA)
+	if soa := resp.Ns[0].(*dns.SOA); soa.Minttl != defaultNegativeTTL {
+		t.Fatalf("expected the default negative TTL, got %v", soa)
+	}
+}
+
+func TestNoDuplicateNodes(t *testing.T) {
+	id := func(b string) string {
+		return "02" + strings.Repeat(b, 32)
+	}
+	nv := newTestView(
+		testNode(id("aa"), "1.1.1.1:9735", "[2001:db8::1]:9735"),
+		testNode(id("bb"), "2.2.2.2:9735", "[2001:db8::2]:9735"),
+		testNode(id("cc"), "3.3.3.3:9735", "[2001:db8::3]:9735"),
+	)
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"": {
+				NetView: nv,
+				BootstrapNodes: []string{
+					id("aa"), id("bb"), id("aa"), id("bb"),
+				},
+			},
+		},
+		cfg: DnsServerConfig{BootstrapName: "bootstrap"},
+	}
+
+	for _, q := range []parseInput{
+		{"a6._nodes._tcp.root.", dns.TypeSRV},
+		{"a6._nodes._tcp.bootstrap.root.", dns.TypeSRV},
+	} {
+		resp := exchange(t, ds, q.name, q.qtype)
+
+		targets := make(map[string]bool)
+		for _, rr := range resp.Answer {
+			target := rr.(*dns.SRV).Target
+			if targets[target] {
+				t.Fatalf("%v answered with %v twice: %v", q.name,
+					target, resp.Answer)
+			}
+			targets[target] = true
+		}
+
+		// Each node has the glue of both of its families.
+		if len(resp.Extra) != 2*len(resp.Answer) {
+			t.Fatalf("expected the glue of both families, got %v",
+				resp.Extra)
+		}
+	}
+
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		resp := exchange(t, ds, "bootstrap.root.", qtype)
+		if len(resp.Answer) != 2 {
+			t.Fatalf("expected each curated node once, got %v",
+				resp.Answer)
+		}
+	}
+}
+
+func TestChainTXT(t *testing.T) {
+	btc := newTestView(testNode("02aaaa", "1.1.1.1:9735"))
+	ltc := newTestView(testNode("02bbbb", "2.2.2.2:9735"))
+	ltc.chain = "litecoin"
+	testnet := newTestView(testNode("02cccc", "3.3.3.3:9735"))
+	testnet.chain = "testnet"
+
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"":      {NetView: btc, HasRealm: true},
+			"ltc.":  {NetView: ltc, Realm: 1, HasRealm: true},
+			"test.": {NetView: testnet},
+		},
+		cfg: DnsServerConfig{
+			ChainTXT: true,
+		},
+	}
+
+	// chainTXT returns the number of answers to the query, and the
+	// strings of the chain TXT record, if any.
+	chainTXT := func(name string) (int, string) {
+		resp := exchange(t, ds, name, dns.TypeA)
+		for _, rr := range resp.Extra {
+			if txt, ok := rr.(*dns.TXT); ok {
+				return len(resp.Answer), strings.Join(txt.Txt, " ")
+			}
+		}
+		return len(resp.Answer), ""
+	}
+
+	tests := []struct {
+		name    string
+		answers int
+		txt     string
+	}{
+		// Each chain is reported with its realm, if it has one.
+		{"root.", 1, "chain=bitcoin realm=0"},
+		{"r0.root.", 1, "chain=bitcoin realm=0"},
+		{"ltc.root.", 1, "chain=litecoin realm=1"},
+		{"r1.ltc.root.", 1, "chain=litecoin realm=1"},
+		{"test.root.", 1, "chain=testnet"},
+
+		// The queries for another realm than the chain's get no
+		// nodes, while chains without a realm answer any.
+		{"r1.root.", 0, ""},
+		{"r0.ltc.root.", 0, ""},
+		{"r1.test.root.", 1, "chain=testnet"},
+	}
+	for _, test := range tests {
+		answers, txt := chainTXT(test.name)
+		if answers != test.answers || txt != test.txt {
+			t.Fatalf("expected %d answers and %q for %v, got %d "+
+				"and %q", test.answers, test.txt, test.name,
+				answers, txt)
+		}
+	}
+
+	// The records are left out of the answers unless asked for.
+	ds.cfg.ChainTXT = false
+	if answers, txt := chainTXT("ltc.root."); answers != 1 || txt != "" {
+		t.Fatalf("unexpected chain TXT record %q", txt)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AllFamilies are all the address families a node can advertise.
+const AllFamilies = NodeTypeIPv4 | NodeTypeIPv6 | NodeTypeTor |
+	NodeTypeHostname
+
+// familyNames are the names of the address families, as configured.
+var familyNames = map[string]NodeType{
+	"ipv4":     NodeTypeIPv4,
+	"ipv6":     NodeTypeIPv6,
+	"tor":      NodeTypeTor,
+	"hostname": NodeTypeHostname,
+}
+
+// ParseFamilies parses a comma separated list of address families, e.g.
+// "ipv4,ipv6", out of ipv4, ipv6, tor and hostname, or all of them.
+func ParseFamilies(s string) (NodeType, error) {
+	if s == "all" {
+		return AllFamilies, nil
+	}
+
+	var families NodeType
+	for _, name := range strings.Split(s, ",") {
+		family, ok := familyNames[strings.TrimSpace(name)]
+		if !ok {
+			return 0, fmt.Errorf("unknown address family %q, "+
+				"expected ipv4, ipv6, tor, hostname or all", name)
+		}
+		families |= family
+	}
+
+	return families, nil
+}
+
+// SetAllowedFamilies restricts the nodes served from the view to the
+// addresses of the given families, e.g. to never hand out onion addresses.
+// The nodes left without any address aren't served at all. Zero allows all
+// the families.
+func (nv *NetworkView) SetAllowedFamilies(families NodeType) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.allowedFamilies = families
+}
+
+// restrictFamilies returns n stripped of the addresses of the families which
+// aren't allowed, and false if it's left without any. The caller must hold
+// the lock.
+func (nv *NetworkView) restrictFamilies(n Node) (Node, bool) {
+	allowed := nv.allowedFamilies
+	if allowed == 0 || allowed&AllFamilies == AllFamilies {
+		return n, true
+	}
+
+	var addrs []net.TCPAddr
+	n.Type &^= NodeTypeIPv4 | NodeTypeIPv6 | NodeTypeDefaultPort
+	for _, addr := range n.Addresses {
+		family := NodeTypeIPv6
+		if addr.IP.To4() != nil {
+			family = NodeTypeIPv4
+		}
+		if allowed&family == 0 {
+			continue
+		}
+
+		n.Type |= family
+		if addr.Port == defaultPort {
+			n.Type |= NodeTypeDefaultPort
+		}
+		addrs = append(addrs, addr)
+	}
+	n.Addresses = addrs
+
+	if allowed&NodeTypeTor == 0 {
+		n.Type &^= NodeTypeTor
+		n.OnionAddresses = nil
+	}
+	if allowed&NodeTypeHostname == 0 {
+		n.Type &^= NodeTypeHostname
+		n.Hostnames = nil
+	}
+
+	ok := len(n.Addresses) > 0 || len(n.OnionAddresses) > 0 ||
+		len(n.Hostnames) > 0
+
+	return n, ok
+}
@@ -0,0 +1,139 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// ModernFeatures are the features required of the nodes served when only
+// modern nodes are wanted. Nodes lacking them are old enough to be poor
+// bootstrap targets.
+var ModernFeatures = []lnwire.FeatureBit{
+	lnwire.DataLossProtectRequired,
+	lnwire.GossipQueriesRequired,
+}
+
+// featuresFile is the part of a static node list file describing the
+// features of the nodes, in the format of newer lnd versions' describegraph
+// output, in which the features are keyed by bit.
+type featuresFile struct {
+	Nodes []struct {
+		PubKey   string                     `json:"pub_key"`
+		Features map[string]json.RawMessage `json:"features"`
+	} `json:"nodes"`
+}
+
+// ReadNodeFeatures reads the features of the nodes, by ID, from the static
+// node list file at path. Nodes without any listed feature are left out.
+func ReadNodeFeatures(path string) (map[string]*lnwire.RawFeatureVector,
+	error) {
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f featuresFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %v", path, err)
+	}
+
+	features := make(map[string]*lnwire.RawFeatureVector)
+	for _, node := range f.Nodes {
+		if len(node.Features) == 0 {
+			continue
+		}
+
+		fv := lnwire.NewRawFeatureVector()
+		for key := range node.Features {
+			bit, err := strconv.ParseUint(key, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("invalid feature bit %q "+
+					"of %v", key, node.PubKey)
+			}
+			fv.Set(lnwire.FeatureBit(bit))
+		}
+		features[node.PubKey] = fv
+	}
+
+	return features, nil
+}
+
+// hasFeatures returns true if the node supports all the required features,
+// either as required or as optional, or if its features are unknown. The
+// caller must hold the lock.
+func (nv *NetworkView) hasFeatures(id string) bool {
+	fv, ok := nv.features[id]
+	if !ok {
+		return true
+	}
+
+	return supportsFeatures(fv, nv.requiredFeatures)
+}
+
+// supportsFeatures returns true if fv has all the features, either as
+// required or as optional.
+func supportsFeatures(fv *lnwire.RawFeatureVector,
+	bits []lnwire.FeatureBit) bool {
+
+	for _, bit := range bits {
+		// Each feature is a pair of bits, the even one signaling it's
+		// required and the odd one that it's optional.
+		even := bit &^ 1
+		if !fv.IsSet(even) && !fv.IsSet(even+1) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FeatureFilter returns a filter rejecting the nodes lacking any of the given
+// features, on top of those rejected by filter, which may be nil. Like the
+// required features of the view, nodes whose features aren't known aren't
+// affected. The filter is based on the features known when it's created.
+func (nv *NetworkView) FeatureFilter(filter func(Node) bool,
+	bits ...lnwire.FeatureBit) func(Node) bool {
+
+	nv.Lock()
+	var lacking []string
+	for id, fv := range nv.features {
+		if !supportsFeatures(fv, bits) {
+			lacking = append(lacking, id)
+		}
+	}
+	nv.Unlock()
+
+	return ExcludeNodes(filter, lacking...)
+}
+
+// SetNodeFeatures records the features advertised by the node with the given
+// ID.
+func (nv *NetworkView) SetNodeFeatures(id string,
+	features *lnwire.RawFeatureVector) {
+
+	nv.Lock()
+	defer nv.Unlock()
+
+	if nv.features == nil {
+		nv.features = make(map[string]*lnwire.RawFeatureVector)
+	}
+	nv.features[id] = features
+}
+
+// SetRequiredFeatures excludes the nodes lacking any of the given features
+// from the samples. The nodes whose features aren't known aren't affected.
+func (nv *NetworkView) SetRequiredFeatures(bits ...lnwire.FeatureBit) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.requiredFeatures = bits
+}
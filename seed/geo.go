@@ -0,0 +1,90 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// unknownCountry stands for the addresses whose country is unknown.
+const unknownCountry = "??"
+
+// Country returns the code of the country in which the range containing ip
+// is registered, or the empty string if it's unknown.
+func (db *ASNDB) Country(ip net.IP) string {
+	if rng := db.lookup(ip); rng != nil {
+		return rng.country
+	}
+
+	return ""
+}
+
+// country returns the country code of ip, or unknownCountry.
+func (db *ASNDB) country(ip net.IP) string {
+	if country := db.Country(ip); country != "" {
+		return country
+	}
+
+	return unknownCountry
+}
+
+// answerCountries summarizes the countries of the addresses returned in m,
+// e.g. "DE=2 US=1", counting each country code once per address.
+func (db *ASNDB) answerCountries(m *dns.Msg) string {
+	counts := make(map[string]int)
+	for _, section := range [][]dns.RR{m.Answer, m.Extra} {
+		for _, rr := range section {
+			switch rr := rr.(type) {
+			case *dns.A:
+				counts[db.country(rr.A)]++
+			case *dns.AAAA:
+				counts[db.country(rr.AAAA)]++
+			}
+		}
+	}
+
+	countries := make([]string, 0, len(counts))
+	for country := range counts {
+		countries = append(countries, country)
+	}
+	sort.Strings(countries)
+
+	summary := make([]string, len(countries))
+	for i, country := range countries {
+		summary[i] = fmt.Sprintf("%v=%d", country, counts[country])
+	}
+
+	return strings.Join(summary, " ")
+}
+
+// logGeo logs the country of the client and of the nodes returned to it, if
+// geolocation logging is enabled. This is purely meant for operators
+// debugging where their clients connect to.
+func (ds *DnsServer) logGeo(client net.Addr, m *dns.Msg) {
+	db := ds.cfg.GeoDB
+	if db == nil || len(m.Question) == 0 {
+		return
+	}
+
+	var clientIP net.IP
+	switch addr := client.(type) {
+	case *net.UDPAddr:
+		clientIP = addr.IP
+	case *net.TCPAddr:
+		clientIP = addr.IP
+	}
+
+	log.WithFields(log.Fields{
+		"name":           m.Question[0].Name,
+		"client_country": db.country(clientIP),
+		"node_countries": db.answerCountries(m),
+	}).Infof("Answered query")
+}
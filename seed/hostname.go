@@ -0,0 +1,54 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/miekg/dns"
+)
+
+// hostnameNetwork is the network of the hostname addresses in lnd's node
+// address model.
+const hostnameNetwork = "dns"
+
+// isHostnameAddr returns true if addr is a DNS hostname address, either
+// explicitly or because its host isn't an IP literal.
+func isHostnameAddr(addr *lnrpc.NodeAddress) bool {
+	if addr.Network == hostnameNetwork {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr.Addr)
+	if err != nil {
+		host = addr.Addr
+	}
+
+	return net.ParseIP(host) == nil
+}
+
+// normalizeHostnameAddr validates a hostname address, and returns it in its
+// canonical lowercase host:port form, with the default port unless one is
+// given.
+func normalizeHostnameAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, strconv.Itoa(defaultPort)
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if _, ok := dns.IsDomainName(host); !ok || !strings.Contains(host, ".") {
+		return "", fmt.Errorf("invalid hostname %q", host)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid port %q", port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
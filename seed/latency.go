@@ -0,0 +1,91 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencyWindow is the number of most recent samples a LatencyTracker
+// computes its percentiles over.
+const latencyWindow = 256
+
+// LatencyTracker keeps a rolling window of latency samples, e.g., of the
+// polls of a backend, and computes percentiles over it. Its memory use is
+// bounded by the window size.
+type LatencyTracker struct {
+	sync.Mutex
+
+	samples []time.Duration
+	next    int
+
+	count uint64
+	sum   time.Duration
+}
+
+// NewLatencyTracker creates an empty LatencyTracker.
+func NewLatencyTracker() *LatencyTracker {
+	return &LatencyTracker{
+		samples: make([]time.Duration, 0, latencyWindow),
+	}
+}
+
+// Observe records a latency sample, evicting the oldest one once the window
+// is full.
+func (lt *LatencyTracker) Observe(d time.Duration) {
+	lt.Lock()
+	defer lt.Unlock()
+
+	if len(lt.samples) < latencyWindow {
+		lt.samples = append(lt.samples, d)
+	} else {
+		lt.samples[lt.next] = d
+	}
+	lt.next = (lt.next + 1) % latencyWindow
+
+	lt.count++
+	lt.sum += d
+}
+
+// Percentiles returns the given percentiles, between 0 and 1, of the samples
+// in the window. It returns false if there aren't any samples yet.
+func (lt *LatencyTracker) Percentiles(ps ...float64) ([]time.Duration, bool) {
+	lt.Lock()
+	sorted := append([]time.Duration(nil), lt.samples...)
+	lt.Unlock()
+
+	if len(sorted) == 0 {
+		return nil, false
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	// We use the nearest rank method, so each percentile is an actual
+	// sample.
+	result := make([]time.Duration, len(ps))
+	for i, p := range ps {
+		rank := int(p*float64(len(sorted))+0.5) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		if rank >= len(sorted) {
+			rank = len(sorted) - 1
+		}
+		result[i] = sorted[rank]
+	}
+
+	return result, true
+}
+
+// Totals returns the number and the sum of all the samples ever observed.
+func (lt *LatencyTracker) Totals() (uint64, time.Duration) {
+	lt.Lock()
+	defer lt.Unlock()
+
+	return lt.count, lt.sum
+}
@@ -0,0 +1,52 @@
+package seed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	lt := NewLatencyTracker()
+	if _, ok := lt.Percentiles(0.5); ok {
+		t.Fatalf("expected no percentiles without samples")
+	}
+
+	for i := 1; i <= 100; i++ {
+		lt.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	ps, ok := lt.Percentiles(0.5, 0.9, 0.99)
+	if !ok {
+		t.Fatalf("expected percentiles")
+	}
+	expected := []time.Duration{
+		50 * time.Millisecond, 90 * time.Millisecond,
+		99 * time.Millisecond,
+	}
+	for i := range expected {
+		if ps[i] != expected[i] {
+			t.Fatalf("expected percentiles %v, got %v", expected, ps)
+		}
+	}
+
+	// Once the window is full, the oldest samples are evicted.
+	for i := 0; i < latencyWindow; i++ {
+		lt.Observe(time.Second)
+	}
+	ps, _ = lt.Percentiles(0)
+	if ps[0] != time.Second {
+		t.Fatalf("expected the old samples to be evicted, got %v", ps)
+	}
+	if len(lt.samples) != latencyWindow {
+		t.Fatalf("expected the window to be bounded, got %d samples",
+			len(lt.samples))
+	}
+
+	count, sum := lt.Totals()
+	if count != 100+latencyWindow {
+		t.Fatalf("unexpected count %d", count)
+	}
+	if sum != 5050*time.Millisecond+latencyWindow*time.Second {
+		t.Fatalf("unexpected sum %v", sum)
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// ListenerState describes the state of one of the listeners of a DnsServer.
+type ListenerState struct {
+	Net   string `json:"net"`
+	Addr  string `json:"addr"`
+	Bound bool   `json:"bound"`
+	Error string `json:"error,omitempty"`
+}
+
+// listenAddr is an address to bind on a network, e.g. udp4.
+type listenAddr struct {
+	net  string
+	addr string
+}
+
+// boundListener is a bound UDP connection or TCP listener.
+type boundListener struct {
+	listenAddr
+
+	conn     net.PacketConn
+	listener net.Listener
+}
+
+// listenAddrs returns the addresses to bind on network n, udp or tcp, to
+// listen on addr. Wildcard addresses are bound separately for IPv4 and IPv6,
+// since dual-stack sockets don't accept any IPv4 client on hosts with
+// bindv6only set, and IPv4 sockets don't accept any IPv6 client.
+func listenAddrs(n, addr string) []listenAddr {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []listenAddr{{n, addr}}
+	}
+
+	switch host {
+	case "", "0.0.0.0", "::":
+		return []listenAddr{
+			{n + "4", net.JoinHostPort("0.0.0.0", port)},
+			{n + "6", net.JoinHostPort("::", port)},
+		}
+
+	default:
+		return []listenAddr{{n, addr}}
+	}
+}
+
+// familyFallback returns true if the listener l, which failed to bind, is
+// the wildcard address of one address family split by listenAddrs, while the
+// one of the other family on the same protocol is among the bound listeners.
+func familyFallback(l listenAddr, bound []listenAddr) bool {
+	var other string
+	switch {
+	case strings.HasSuffix(l.net, "4"):
+		other = strings.TrimSuffix(l.net, "4") + "6"
+	case strings.HasSuffix(l.net, "6"):
+		other = strings.TrimSuffix(l.net, "6") + "4"
+	default:
+		return false
+	}
+
+	for _, b := range bound {
+		if b.net == other {
+			return true
+		}
+	}
+
+	return false
+}
+
+// describeListenAddrs returns a human readable list of the listeners, e.g.
+// "udp4 0.0.0.0:53, tcp4 0.0.0.0:53".
+func describeListenAddrs(addrs []listenAddr) string {
+	descs := make([]string, 0, len(addrs))
+	for _, l := range addrs {
+		descs = append(descs, l.net+" "+l.addr)
+	}
+
+	return strings.Join(descs, ", ")
+}
+
+// setListenerState records the state of the listener on network n and
+// address addr, err being the reason it isn't bound.
+func (ds *DnsServer) setListenerState(n, addr string, err error) {
+	ds.listenerMtx.Lock()
+	defer ds.listenerMtx.Unlock()
+
+	state := ListenerState{
+		Net:   n,
+		Addr:  addr,
+		Bound: err == nil,
+	}
+	if err != nil {
+		state.Error = err.Error()
+	}
+
+	for i, l := range ds.listeners {
+		if l.Net == n && l.Addr == addr {
+			ds.listeners[i] = state
+			return
+		}
+	}
+	ds.listeners = append(ds.listeners, state)
+}
+
+// Listeners returns the state of each of the listeners.
+func (ds *DnsServer) Listeners() []ListenerState {
+	ds.listenerMtx.Lock()
+	defer ds.listenerMtx.Unlock()
+
+	return append([]ListenerState(nil), ds.listeners...)
+}
+
+// Listening returns true if at least one of the listeners is bound.
+func (ds *DnsServer) Listening() bool {
+	for _, l := range ds.Listeners() {
+		if l.Bound {
+			return true
+		}
+	}
+
+	return false
+}
+
+// limitListener is a net.Listener which caps the number of concurrently open
+// connections. Once the cap is reached new connections are held for up to
+// queueTimeout waiting for a slot to free up, and are closed if none does.
+type limitListener struct {
+	net.Listener
+
+	sema         chan struct{}
+	queueTimeout time.Duration
+}
+
+// newLimitListener wraps l such that at most maxConns connections are open at
+// the same time.
+func newLimitListener(l net.Listener, maxConns int,
+	queueTimeout time.Duration) net.Listener {
+
+	return &limitListener{
+		Listener:     l,
+		sema:         make(chan struct{}, maxConns),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Accept waits for and returns the next connection for which a slot is
+// available.
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		timer := time.NewTimer(l.queueTimeout)
+		select {
+		case l.sema <- struct{}{}:
+			timer.Stop()
+			return &limitConn{Conn: conn, release: l.release}, nil
+
+		case <-timer.C:
+			log.Debugf("Too many TCP connections, refusing %v",
+				conn.RemoteAddr())
+			conn.Close()
+		}
+	}
+}
+
+// release frees up a connection slot.
+func (l *limitListener) release() {
+	<-l.sema
+}
+
+// limitConn is a connection which releases its slot in the limitListener
+// once closed.
+type limitConn struct {
+	net.Conn
+
+	releaseOnce sync.Once
+	release     func()
+}
+
+// Close closes the connection and releases its slot.
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(c.release)
+	return err
+}
+
+// newTCPServer creates the server answering the queries received on the
+// connections accepted by listener with handler, each starting with a PROXY
+// protocol header if ProxyProtocol is set. The connections are capped
+// to MaxTCPConns, and closed if the client doesn't send a query within
+// TCPReadTimeout of connecting, or any further one within TCPIdleTimeout of
+// the previous answer, so idle clients can't hold on to them.
+func (ds *DnsServer) newTCPServer(listener net.Listener,
+	handler dns.Handler) *dns.Server {
+
+	if ds.cfg.ProxyProtocol {
+		listener = &proxyListener{Listener: listener}
+	}
+	if ds.cfg.MaxTCPConns > 0 {
+		listener = newLimitListener(
+			listener, ds.cfg.MaxTCPConns, tcpQueueTimeout,
+		)
+	}
+
+	server := &dns.Server{
+		Listener:    listener,
+		Net:         "tcp",
+		Handler:     handler,
+		ReadTimeout: ds.cfg.TCPReadTimeout,
+		TsigSecret:  ds.tsigSecrets(),
+	}
+	if ds.cfg.TCPIdleTimeout != 0 {
+		idleTimeout := ds.cfg.TCPIdleTimeout
+		server.IdleTimeout = func() time.Duration {
+			return idleTimeout
+		}
+	}
+
+	return server
+}
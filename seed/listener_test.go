@@ -0,0 +1,237 @@
+package seed
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestListenAddrs(t *testing.T) {
+	tests := []struct {
+		addr     string
+		expected []listenAddr
+	}{
+		{"0.0.0.0:53", []listenAddr{
+			{"udp4", "0.0.0.0:53"}, {"udp6", "[::]:53"},
+		}},
+		{"[::]:53", []listenAddr{
+			{"udp4", "0.0.0.0:53"}, {"udp6", "[::]:53"},
+		}},
+		{":5353", []listenAddr{
+			{"udp4", "0.0.0.0:5353"}, {"udp6", "[::]:5353"},
+		}},
+		{"192.0.2.1:53", []listenAddr{{"udp", "192.0.2.1:53"}}},
+		{"[2001:db8::1]:53", []listenAddr{{"udp", "[2001:db8::1]:53"}}},
+	}
+
+	for _, test := range tests {
+		addrs := listenAddrs("udp", test.addr)
+		if !reflect.DeepEqual(addrs, test.expected) {
+			t.Fatalf("expected %v for %v, got %v", test.expected,
+				test.addr, addrs)
+		}
+	}
+}
+
+func TestFamilyFallback(t *testing.T) {
+	bound := []listenAddr{
+		{"udp4", "0.0.0.0:53"},
+		{"tcp6", "[::]:53"},
+	}
+
+	tests := []struct {
+		failed   listenAddr
+		fallback bool
+	}{
+		// IPv6 is missing, but the IPv4 wildcard was bound.
+		{listenAddr{"udp6", "[::]:53"}, true},
+
+		// And conversely.
+		{listenAddr{"tcp4", "0.0.0.0:53"}, true},
+
+		// Nothing serves TCP over IPv4.
+		{listenAddr{"tcp6", "[::]:53"}, false},
+
+		// Explicit addresses aren't split by family.
+		{listenAddr{"udp", "192.0.2.1:53"}, false},
+	}
+	for _, test := range tests {
+		if familyFallback(test.failed, bound) != test.fallback {
+			t.Fatalf("expected fallback=%v for %v", test.fallback,
+				test.failed)
+		}
+	}
+
+	expected := "udp4 0.0.0.0:53, tcp6 [::]:53"
+	if desc := describeListenAddrs(bound); desc != expected {
+		t.Fatalf("expected %q, got %q", expected, desc)
+	}
+}
+
+func TestTCPIdleTimeout(t *testing.T) {
+	ds := NewDnsServer(nil, "", "", "root", nil, &DnsServerConfig{
+		MaxTCPConns:    1,
+		TCPReadTimeout: 100 * time.Millisecond,
+		TCPIdleTimeout: 100 * time.Millisecond,
+	})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := ds.newTCPServer(listener, handler)
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	// closedWithin asserts that the server closes the connection within
+	// the given time.
+	closedWithin := func(conn net.Conn, d time.Duration) {
+		t.Helper()
+
+		conn.SetReadDeadline(time.Now().Add(d))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("expected the connection to be closed, got %v",
+				err)
+		}
+	}
+
+	// A client which never sends a query is dropped, freeing up the only
+	// connection slot for the next one.
+	idle, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer idle.Close()
+	closedWithin(idle, time.Second)
+
+	// So is a client lingering once answered.
+	conn, err := dns.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer conn.Close()
+
+	query := new(dns.Msg)
+	query.SetQuestion("root.", dns.TypeA)
+	if err := conn.WriteMsg(query); err != nil {
+		t.Fatalf("unable to send query: %v", err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatalf("unable to read answer: %v", err)
+	}
+	closedWithin(conn.Conn, time.Second)
+}
+
+func TestProxyProtocol(t *testing.T) {
+	ds := NewDnsServer(nil, "", "", "root", nil, &DnsServerConfig{
+		TCPReadTimeout: time.Second,
+		ProxyProtocol:  true,
+	})
+
+	// The handler answers with the address of the client it sees.
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{
+				Name:   r.Question[0].Name,
+				Rrtype: dns.TypeTXT,
+				Class:  dns.ClassINET,
+			},
+			Txt: []string{w.RemoteAddr().String()},
+		})
+		w.WriteMsg(m)
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := ds.newTCPServer(listener, handler)
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	// query sends a query preceded by the given PROXY protocol header, and
+	// returns the client address seen by the handler.
+	query := func(header []byte) (string, error) {
+		conn, err := dns.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatalf("unable to dial: %v", err)
+		}
+		defer conn.Close()
+
+		if _, err := conn.Conn.Write(header); err != nil {
+			t.Fatalf("unable to send header: %v", err)
+		}
+
+		query := new(dns.Msg)
+		query.SetQuestion("root.", dns.TypeTXT)
+		if err := conn.WriteMsg(query); err != nil {
+			t.Fatalf("unable to send query: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		m, err := conn.ReadMsg()
+		if err != nil {
+			return "", err
+		}
+
+		return m.Answer[0].(*dns.TXT).Txt[0], nil
+	}
+
+	v2 := append([]byte(nil), proxyV2Signature...)
+	v2 = append(v2, 0x21, 0x21, 0, 36)
+	v2 = append(v2, net.ParseIP("2001:db8::1")...)
+	v2 = append(v2, net.ParseIP("2001:db8::2")...)
+	v2 = append(v2, 0xdc, 0x04, 0, 53)
+
+	local := append([]byte(nil), proxyV2Signature...)
+	local = append(local, 0x20, 0, 0, 0)
+
+	tests := []struct {
+		header []byte
+		client string
+	}{
+		{
+			[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\r\n"),
+			"192.0.2.1:56324",
+		},
+		{v2, "[2001:db8::1]:56324"},
+
+		// Without a client address, the one of the load balancer
+		// is kept.
+		{[]byte("PROXY UNKNOWN\r\n"), "127.0.0.1:"},
+		{local, "127.0.0.1:"},
+	}
+	for _, test := range tests {
+		client, err := query(test.header)
+		if err != nil {
+			t.Fatalf("unable to query with header %q: %v",
+				test.header, err)
+		}
+		if !strings.HasPrefix(client, test.client) {
+			t.Fatalf("expected client %v, got %v", test.client,
+				client)
+		}
+	}
+
+	// Connections without a valid header are closed.
+	if _, err := query([]byte("PROXY TCP4 192.0.2.1\r\n")); err == nil {
+		t.Fatalf("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// minimalName is the label requesting a minimal response, e.g.
+	// min.<root-domain>, for constrained clients which only need a single
+	// node to connect to.
+	minimalName = "min"
+
+	// minimalCandidates is the number of nodes sampled to pick the one
+	// returned in a minimal response from.
+	minimalCandidates = 8
+)
+
+// bestNode picks the node of a minimal response, out of a few sampled ones.
+// Dual-stack nodes are preferred, since the client can reach them whatever
+// its connectivity, and then the nodes with the most channel capacity.
+func bestNode(candidates []Node) []Node {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.IsDualStack() != b.IsDualStack() {
+			return a.IsDualStack()
+		}
+
+		return a.Capacity > b.Capacity
+	})
+
+	return candidates[:1]
+}
+
+// smallUDPBuffer returns true if the query r, received over UDP if udp is set,
+// advertises an EDNS0 buffer of at most MinimalUDPSize bytes, too small for a
+// full response to be worth sending. Clients without EDNS0 only accept the
+// 512 bytes of plain DNS.
+func (ds *DnsServer) smallUDPBuffer(r *dns.Msg, udp bool) bool {
+	if !udp || ds.cfg.MinimalUDPSize == 0 {
+		return false
+	}
+
+	size := uint16(dns.MinMsgSize)
+	if opt := r.IsEdns0(); opt != nil {
+		size = opt.UDPSize()
+	}
+
+	return size <= ds.cfg.MinimalUDPSize
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultMaxQueryLabels is the default number of labels of the
+	// longest query name we parse. The longest names we serve, e.g.
+	// min.d1.a2.r0._nodes._tcp.test.nodes.lightning.directory., have
+	// about a dozen of them.
+	defaultMaxQueryLabels = 16
+
+	// defaultMaxQueryNameLen is the default length of the longest query
+	// name we parse, which leaves ample room for a node query under a
+	// long root domain.
+	defaultMaxQueryNameLen = 192
+)
+
+// maxQueryLabels returns the number of labels of the longest query name we
+// parse.
+func (ds *DnsServer) maxQueryLabels() int {
+	if ds.cfg.MaxQueryLabels > 0 {
+		return ds.cfg.MaxQueryLabels
+	}
+
+	return defaultMaxQueryLabels
+}
+
+// maxQueryNameLen returns the length of the longest query name we parse.
+func (ds *DnsServer) maxQueryNameLen() int {
+	if ds.cfg.MaxQueryNameLen > 0 {
+		return ds.cfg.MaxQueryNameLen
+	}
+
+	return defaultMaxQueryNameLen
+}
+
+// queryNameTooLong returns true if the name has more labels, or is longer,
+// than any name we serve could be, in which case it isn't worth parsing.
+func (ds *DnsServer) queryNameTooLong(name string) bool {
+	return len(name) > ds.maxQueryNameLen() ||
+		dns.CountLabel(name) > ds.maxQueryLabels()
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// ParseNAT64Prefix parses a NAT64 prefix, such as the well-known
+// 64:ff9b::/96. Only /96 prefixes are supported, for which the IPv4 address
+// is simply appended to the prefix (RFC 6052).
+func ParseNAT64Prefix(prefix string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if ip.To4() != nil || bits != 128 || ones != 96 {
+		return nil, fmt.Errorf("%v isn't an IPv6 /96 prefix", prefix)
+	}
+
+	return ipNet, nil
+}
+
+// addNAT64Response adds AAAA records synthesized from the IPv4 addresses of
+// the node using the NAT64 prefix, allowing IPv6-only clients to reach
+// IPv4-only nodes.
+func addNAT64Response(n Node, name string, ttl uint32, prefix *net.IPNet,
+	responses *[]dns.RR) {
+
+	header := dns.RR_Header{
+		Rrtype: dns.TypeAAAA,
+		Class:  dns.ClassINET,
+		Ttl:    ttl,
+		Name:   name,
+	}
+	for _, a := range n.Addresses {
+		ip4 := a.IP.To4()
+		if ip4 == nil {
+			continue
+		}
+
+		ip6 := make(net.IP, net.IPv6len)
+		copy(ip6, prefix.IP.To16()[:12])
+		copy(ip6[12:], ip4)
+
+		rr := &dns.AAAA{
+			Hdr:  header,
+			AAAA: ip6,
+		}
+		log.Debugf("Adding NAT64 AAAA response record: %s", name)
+		*responses = append(*responses, rr)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultNegativeTTL is how long resolvers cache our NXDOMAIN
+	// answers by default, in seconds.
+	defaultNegativeTTL = 60
+
+	// MaxNegativeTTL is the longest negative caching TTL we accept, a
+	// day, as suggested by RFC 2308.
+	MaxNegativeTTL = 86400
+)
+
+// negativeTTL returns how long resolvers may cache our NXDOMAIN answers.
+func (ds *DnsServer) negativeTTL() uint32 {
+	if ds.cfg.NegativeTTL != 0 {
+		return ds.cfg.NegativeTTL
+	}
+
+	return defaultNegativeTTL
+}
+
+// soaRecord returns the SOA record of the root domain. We don't serve a zone
+// in the usual sense, so its only purpose is to carry the negative caching
+// TTL in the minimum field, see RFC 2308. The name server is the name of the
+// dummy record.
+func (ds *DnsServer) soaRecord() *dns.SOA {
+	root := dns.Fqdn(ds.rootDomain)
+
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   root,
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ds.negativeTTL(),
+		},
+		Ns:      fmt.Sprintf("%s.%s", ds.dummyRecordName(), root),
+		Mbox:    "hostmaster." + root,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ds.negativeTTL(),
+	}
+}
+
+// addNegativeSOA adds the SOA record to the authority section of an NXDOMAIN
+// response, so resolvers cache it for the negative caching TTL rather than
+// whatever they default to.
+func (ds *DnsServer) addNegativeSOA(m *dns.Msg) {
+	if m.Rcode != dns.RcodeNameError {
+		return
+	}
+
+	m.Ns = append(m.Ns, ds.soaRecord())
+}
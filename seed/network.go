@@ -5,14 +5,21 @@
 package seed
 
 import (
+	crand "crypto/rand"
+	"encoding/binary"
 	"fmt"
+	"math/rand"
 	"net"
-	"strconv"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/btcsuite/btcutil"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
 )
 
 const (
@@ -29,18 +36,59 @@ const (
 var privateIPBlocks []*net.IPNet
 
 // A bitfield in which bit 0 indicates whether it is an IPv6 if set,
-// and bit 1 indicates whether it uses the default port if set.
+// bit 1 indicates whether it uses the default port if set, bit 2
+// indicates whether it is an IPv4 if set, bit 3 whether it has a Tor
+// onion address if set, and bit 4 whether it has a DNS hostname if set.
 type NodeType uint8
 
+const (
+	// NodeTypeIPv6 is set if the node advertises an IPv6 address.
+	NodeTypeIPv6 NodeType = 1 << 0
+
+	// NodeTypeDefaultPort is set if the node listens on the default port.
+	NodeTypeDefaultPort NodeType = 1 << 1
+
+	// NodeTypeIPv4 is set if the node advertises an IPv4 address.
+	NodeTypeIPv4 NodeType = 1 << 2
+
+	// NodeTypeTor is set if the node advertises a Tor onion address.
+	NodeTypeTor NodeType = 1 << 3
+
+	// NodeTypeHostname is set if the node advertises a DNS hostname.
+	NodeTypeHostname NodeType = 1 << 4
+)
+
 // Local model of a node,
 type Node struct {
 	Id string
 
+	// LastSeen is the time of the latest poll the node was seen in, as
+	// observed by us.
 	LastSeen time.Time
 
+	// LastUpdate is the time of the latest node announcement in the
+	// graph.
+	LastUpdate time.Time
+
+	// UpdateInterval is a moving average of the observed time between
+	// node announcements, or zero if there weren't two announcements yet.
+	UpdateInterval time.Duration
+
 	Type NodeType
 
 	Addresses []net.TCPAddr
+
+	// OnionAddresses are the Tor onion service addresses of the node, in
+	// their canonical lowercase host:port form.
+	OnionAddresses []string
+
+	// Hostnames are the DNS hostname addresses of the node, in their
+	// canonical lowercase host:port form. They aren't resolved.
+	Hostnames []string
+
+	// Capacity is the total capacity of the channels of the node in
+	// satoshis, as of the last poll.
+	Capacity int64
 }
 
 // ChainView couples a network view for a particulr chain, and the node that
@@ -49,10 +97,58 @@ type ChainView struct {
 	NetView *NetworkView
 
 	Node lnrpc.LightningClient
+
+	// Breaker guards the backing node against repeated polls while it's
+	// persistently failing.
+	Breaker *CircuitBreaker
+
+	// PollLatency tracks the latency of the recent polls of the backing
+	// node.
+	PollLatency *LatencyTracker
+
+	// FallbackSeeds are the fully qualified domains of other seeds of the
+	// chain, to which queries are referred while the view has fewer than
+	// FallbackMinNodes reachable nodes.
+	FallbackSeeds []string
+
+	// BootstrapNodes are the IDs of the curated nodes served under the
+	// BootstrapName, as far as they're reachable.
+	BootstrapNodes []string
+
+	// AuthoritativeIP, if set, is the address of the authoritative name
+	// server of the chain, served as its dummy record instead of the one
+	// of the DnsServer, e.g. when chains are served by different hosts.
+	AuthoritativeIP net.IP
+
+	// NodeIDHRP, if set, is the human readable part of the bech32 encoded
+	// node IDs in the names of the chain's nodes, instead of
+	// DefaultNodeIDHRP, so they can't be mistaken for another chain's.
+	NodeIDHRP string
+
+	// Realm is the BOLT #10 realm byte of the chain, if HasRealm is set.
+	// It's reported along with the chain's name if ChainTXT is set, and
+	// the queries asking for another realm aren't answered with the
+	// chain's nodes. Realm 0 is bitcoin's.
+	Realm    uint8
+	HasRealm bool
+}
+
+// freshNode is a node handed over to the reachability pruner, along with the
+// batch of nodes it was polled in, if any.
+type freshNode struct {
+	Node
+
+	batch *sync.WaitGroup
 }
 
 // The local view of the network
 type NetworkView struct {
+	// oversizedNodes counts the nodes exceeding the per-node sanity
+	// limits, see oversizedNode. It's updated atomically, as nodes are
+	// parsed without holding the lock, so it comes first to be 64-bit
+	// aligned on 32-bit platforms.
+	oversizedNodes uint64
+
 	sync.Mutex
 
 	chain string
@@ -61,7 +157,107 @@ type NetworkView struct {
 
 	reachableNodes map[string]Node
 
-	freshNodes chan Node
+	freshNodes chan freshNode
+
+	// static is set if the view isn't populated by a backend.
+	static bool
+
+	// lastPoll is the time of the last successful poll of the backend.
+	lastPoll time.Time
+
+	// asnDB, if set, is used to cap the number of sampled nodes sharing an
+	// autonomous system to maxPerASN.
+	asnDB     *ASNDB
+	maxPerASN int
+
+	// pollHooks are called after each successful poll of the backend.
+	pollHooks []func()
+
+	// capacities holds the capacity of each node, by ID. The nodes below
+	// minCapacity aren't selected.
+	capacities  map[string]int64
+	minCapacity btcutil.Amount
+
+	// channelUpdates holds the IDs of the nodes which sent at least one
+	// channel update. If requireChannelUpdates is set, the other nodes
+	// aren't selected.
+	channelUpdates        map[string]struct{}
+	requireChannelUpdates bool
+
+	// channelStats holds the stats of the channels of each node, by ID.
+	channelStats map[string]ChannelStats
+
+	// features holds the features advertised by the nodes, by ID. The
+	// nodes lacking any of requiredFeatures aren't selected.
+	features         map[string]*lnwire.RawFeatureVector
+	requiredFeatures []lnwire.FeatureBit
+
+	// selector picks the nodes of each sample, uniformly at random if
+	// it isn't set.
+	selector Selector
+
+	// confirmations counts the consecutive polls each node appeared in,
+	// by ID.
+	confirmations map[string]int
+
+	// quarantine is the number of polls a newly seen node must appear in
+	// again before it's selected.
+	quarantine int
+
+	// rng is the source of randomness of the selector, a securely
+	// seeded one unless set otherwise.
+	rng *rand.Rand
+
+	// defaultAddressTypes are the BOLT #10 address types of the queries
+	// which don't specify any, see DefaultAddressTypes.
+	defaultAddressTypes int
+
+	// skewedNodes counts the nodes added with their last update too far
+	// in the future. pollNodes and pollSkewed count the nodes added, and
+	// the skewed ones, since the last CheckClockSkew.
+	skewedNodes uint64
+	pollNodes   int
+	pollSkewed  int
+
+	// newestUpdate is the latest last update of the nodes added, and
+	// pollNewest the latest one since the last CheckGraphProgress.
+	// stalledPolls counts the polls which didn't advance newestUpdate.
+	newestUpdate time.Time
+	pollNewest   time.Time
+	stalledPolls int
+
+	// emptyPolls counts the polls ignored since they held no node, unless
+	// allowEmptyPolls is set.
+	emptyPolls      uint64
+	allowEmptyPolls bool
+
+	// allowedFamilies are the address families of the nodes which are
+	// served, all of them if zero.
+	allowedFamilies NodeType
+
+	// addressChanges counts the times a node advertised other IP
+	// addresses than in the previous poll, and nodeAddressChanges does
+	// so by node ID. retiredAddrs holds the addresses reachable nodes
+	// stopped advertising, served until the end of addressGrace.
+	addressChanges     uint64
+	nodeAddressChanges map[string]int
+	retiredAddrs       map[string]retiredAddrs
+	addressGrace       time.Duration
+
+	// stability, if set, is the window within which the samples for a
+	// given query stay the same, see SetAnswerStability. They're drawn
+	// from a source seeded with stabilityKey and the window.
+	stability    time.Duration
+	stabilityKey []byte
+
+	// now is used to fetch the current time, it can be overridden in
+	// tests.
+	now func() time.Time
+
+	// dial is used to connect to the nodes when checking their
+	// reachability, it can be overridden in tests.
+	dial func(network, address string, timeout time.Duration) (net.Conn,
+		error)
 }
 
 // NewNetworkView creates a new instance of a NetworkView.
@@ -70,13 +266,247 @@ func NewNetworkView(chain string) *NetworkView {
 		chain:          chain,
 		allNodes:       make(map[string]Node),
 		reachableNodes: make(map[string]Node),
-		freshNodes:     make(chan Node, 100),
+		freshNodes:     make(chan freshNode, 100),
 	}
 
 	go n.reachabilityPruner()
 	return n
 }
 
+// Chain returns the name of the chain this view tracks.
+func (nv *NetworkView) Chain() string {
+	return nv.chain
+}
+
+// NumReachable returns the number of nodes currently known to be reachable.
+func (nv *NetworkView) NumReachable() int {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return len(nv.reachableNodes)
+}
+
+// NumReachableByType returns the number of reachable nodes advertising an
+// address of each of the types in types, e.g. NodeTypeIPv4.
+func (nv *NetworkView) NumReachableByType(types ...NodeType) []int {
+	nv.Lock()
+	defer nv.Unlock()
+
+	counts := make([]int, len(types))
+	for _, n := range nv.reachableNodes {
+		for i, t := range types {
+			if n.Type&t != 0 {
+				counts[i]++
+			}
+		}
+	}
+
+	return counts
+}
+
+// Lookup returns the reachable node with the given ID, with the addresses of
+// the allowed families only, see SetAllowedFamilies.
+func (nv *NetworkView) Lookup(id string) (Node, bool) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	n, ok := nv.reachableNodes[id]
+	if !ok {
+		return n, false
+	}
+	n.Capacity = nv.capacities[id]
+
+	return nv.restrictFamilies(n)
+}
+
+// SetCapacities records the capacity of the nodes, by ID, replacing the
+// previously known ones.
+func (nv *NetworkView) SetCapacities(capacities map[string]int64) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.capacities = capacities
+}
+
+// SetMinCapacity excludes the nodes whose channels total less than min from
+// the samples, so only well funded nodes are handed out. Zero doesn't exclude
+// any node. Static views aren't affected, as their capacities are unknown.
+func (nv *NetworkView) SetMinCapacity(min btcutil.Amount) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.minCapacity = min
+}
+
+// SetChannelUpdates records the IDs of the nodes which sent at least one
+// channel update, replacing the previously known ones.
+func (nv *NetworkView) SetChannelUpdates(ids map[string]struct{}) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.channelUpdates = ids
+}
+
+// RequireChannelUpdates excludes the nodes which never sent a channel update,
+// i.e. the ones merely announcing themselves without any channel, from the
+// samples. Static views aren't affected.
+func (nv *NetworkView) RequireChannelUpdates(require bool) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.requireChannelUpdates = require
+}
+
+// SetRand sets the source of randomness used to select the nodes of each
+// sample, e.g. to a fixed seed for reproducible samples.
+func (nv *NetworkView) SetRand(rng *rand.Rand) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.rng = rng
+}
+
+// Shuffle shuffles n elements using the source of randomness of the view, see
+// rand.Shuffle.
+func (nv *NetworkView) Shuffle(n int, swap func(i, j int)) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	if nv.rng == nil {
+		nv.rng = newRand()
+	}
+	nv.rng.Shuffle(n, swap)
+}
+
+// Intn returns a random number in [0, n) drawn from the source of randomness
+// of the view, see rand.Intn.
+func (nv *NetworkView) Intn(n int) int {
+	nv.Lock()
+	defer nv.Unlock()
+
+	if nv.rng == nil {
+		nv.rng = newRand()
+	}
+	return nv.rng.Intn(n)
+}
+
+// newRand returns a math/rand source seeded from crypto/rand, so the samples
+// can't be predicted.
+func newRand() *rand.Rand {
+	var seed [8]byte
+	if _, err := crand.Read(seed[:]); err != nil {
+		panic(fmt.Sprintf("unable to seed the random source: %v", err))
+	}
+
+	return rand.New(rand.NewSource(
+		int64(binary.LittleEndian.Uint64(seed[:])),
+	))
+}
+
+// SetQuarantine holds newly seen nodes back from the samples until they
+// appeared in polls more times after the one they were first seen in, so
+// floods of fresh nodes can't take over the samples. The nodes of the first
+// poll are trusted right away, so a restart doesn't empty the samples. Zero
+// disables it.
+func (nv *NetworkView) SetQuarantine(polls int) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.quarantine = polls
+}
+
+// quarantined returns true if the node wasn't seen in enough polls yet to be
+// selected. Static views don't quarantine their nodes. The caller must hold
+// the lock.
+func (nv *NetworkView) quarantined(id string) bool {
+	if nv.static || nv.quarantine == 0 {
+		return false
+	}
+
+	return nv.confirmations[id] <= nv.quarantine
+}
+
+// trackConfirmations counts one more poll for each of the nodes of the poll
+// just applied, and forgets the count of the nodes missing from it, so a node
+// dropping out of the graph serves its quarantine again once it's back. The
+// nodes of the first poll since we started aren't quarantined, as they're
+// only new to us rather than to the network. The caller must hold the lock.
+func (nv *NetworkView) trackConfirmations(nodes []Node, first bool) {
+	confirmations := make(map[string]int, len(nodes))
+	for _, n := range nodes {
+		count := nv.confirmations[n.Id] + 1
+		if first {
+			count = nv.quarantine + 1
+		}
+		confirmations[n.Id] = count
+	}
+
+	nv.confirmations = confirmations
+}
+
+// SetSelector sets the selector picking the nodes of each sample.
+func (nv *NetworkView) SetSelector(selector Selector) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.selector = selector
+}
+
+// SetASNDiversity caps the number of nodes sharing an autonomous system, as
+// determined by db, returned in a single sample to maxPerASN.
+func (nv *NetworkView) SetASNDiversity(db *ASNDB, maxPerASN int) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.asnDB = db
+	nv.maxPerASN = maxPerASN
+}
+
+// OnPoll registers hook to be called after each successful poll of the
+// backend, once the reachability of the polled nodes was checked. It's called
+// from another goroutine than the poll.
+func (nv *NetworkView) OnPoll(hook func()) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.pollHooks = append(nv.pollHooks, hook)
+}
+
+// LastPoll returns the time of the last successful poll of the backend, or
+// the zero time if there wasn't any yet.
+func (nv *NetworkView) LastPoll() time.Time {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return nv.lastPoll
+}
+
+// Fresh returns true if the backend populating the view was successfully
+// polled within maxAge. Static views are always fresh.
+func (nv *NetworkView) Fresh(maxAge time.Duration) bool {
+	nv.Lock()
+	defer nv.Unlock()
+
+	if nv.static {
+		return true
+	}
+
+	return !nv.lastPoll.IsZero() && time.Since(nv.lastPoll) <= maxAge
+}
+
+// PollAge returns how long ago the backend populating the view was last
+// successfully polled, and false if it never was, or the view is static.
+func (nv *NetworkView) PollAge() (time.Duration, bool) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	if nv.static || nv.lastPoll.IsZero() {
+		return 0, false
+	}
+
+	return time.Since(nv.lastPoll), true
+}
+
 func isPrivateIP(ip net.IP) bool {
 	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
 		ip.IsUnspecified() {
@@ -91,25 +521,169 @@ func isPrivateIP(ip net.IP) bool {
 	return false
 }
 
+// IsDualStack returns true if the node advertises both an IPv4 and an IPv6
+// address.
+func (n Node) IsDualStack() bool {
+	both := NodeTypeIPv4 | NodeTypeIPv6
+	return n.Type&both == both
+}
+
+// ExcludeNodes returns a filter rejecting the nodes with the given IDs, on top
+// of those rejected by filter, which may be nil.
+func ExcludeNodes(filter func(Node) bool, ids ...string) func(Node) bool {
+	excluded := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		excluded[strings.ToLower(id)] = struct{}{}
+	}
+
+	return func(n Node) bool {
+		if _, ok := excluded[n.Id]; ok {
+			return false
+		}
+
+		return filter == nil || filter(n)
+	}
+}
+
+// AddressesOnPort returns the addresses of n of the given families, out of
+// IPv4 and IPv6, which are on port.
+func AddressesOnPort(n Node, port int, families NodeType) []net.TCPAddr {
+	var addrs []net.TCPAddr
+	for _, addr := range n.Addresses {
+		family := NodeTypeIPv6
+		if addr.IP.To4() != nil {
+			family = NodeTypeIPv4
+		}
+
+		if families&family != 0 && addr.Port == port {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	return addrs
+}
+
+// PortFilter returns a filter rejecting the nodes without any address of the
+// given families on port, see AddressesOnPort, on top of those rejected by
+// filter, which may be nil.
+func PortFilter(filter func(Node) bool, port int,
+	families NodeType) func(Node) bool {
+
+	return func(n Node) bool {
+		if len(AddressesOnPort(n, port, families)) == 0 {
+			return false
+		}
+
+		return filter == nil || filter(n)
+	}
+}
+
 // Return a random sample matching the NodeType, or just any node if
-// query is set to `0xFF`. Relies on random map-iteration ordering
-// internally.
+// query is set to `0xFF`. The nodes are picked by the selector of the view.
 func (nv *NetworkView) RandomSample(query NodeType, count int) []Node {
+	return nv.RandomSampleFunc(query, count, nil)
+}
+
+// eligible returns true if the reachable node n may be handed out in answer
+// to a query for the given node type, passing filter if it's set. The caller
+// must hold the lock.
+func (nv *NetworkView) eligible(n Node, query NodeType,
+	filter func(Node) bool) bool {
+
+	if n.Type&query == 0 && query != 255 {
+		return false
+	}
+	if filter != nil && !filter(n) {
+		return false
+	}
+	if nv.quarantined(n.Id) {
+		return false
+	}
+	if !nv.hasFeatures(n.Id) {
+		return false
+	}
+	if nv.minCapacity > 0 && !nv.static &&
+		btcutil.Amount(nv.capacities[n.Id]) < nv.minCapacity {
+
+		return false
+	}
+	if nv.requireChannelUpdates && !nv.static {
+		if _, ok := nv.channelUpdates[n.Id]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// RandomSampleFunc works like RandomSample, but additionally only returns
+// nodes for which filter returns true. A nil filter accepts every node. Only
+// the candidates are gathered while holding the lock, so the polls and the
+// reachability checks aren't held up while they're sorted and selected.
+func (nv *NetworkView) RandomSampleFunc(query NodeType, count int,
+	filter func(Node) bool) []Node {
+
 	nv.Lock()
-	defer nv.Unlock()
+	candidates := make([]Node, 0, len(nv.reachableNodes))
+	for _, n := range nv.reachableNodes {
+		n, ok := nv.restrictFamilies(n)
+		if !ok || !nv.eligible(n, query, filter) {
+			continue
+		}
+
+		n.Capacity = nv.capacities[n.Id]
+		candidates = append(candidates, n)
+	}
+
+	selector := nv.selector
+	if selector == nil {
+		selector = UniformSelector{}
+	}
+	rng := nv.sampleRand(query, count)
+	asnDB, maxPerASN := nv.asnDB, nv.maxPerASN
+	numReachable := len(nv.reachableNodes)
+	nv.Unlock()
+
+	// Map iteration order is random, so we'll sort the candidates for a
+	// given source of randomness to always yield the same sample.
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Id < candidates[j].Id
+	})
 
 	var result []Node
-	for _, n := range nv.reachableNodes {
-		if n.Type&query != 0 || query == 255 {
+	if asnDB == nil || maxPerASN == 0 {
+		result = selector.Select(candidates, SelectQuery{
+			Count: count,
+			Rand:  rng,
+		})
+	} else {
+		// Spread the sample across networks, rather than handing out
+		// many nodes of a single hosting provider. We'll have all the
+		// candidates ranked, and skip those of the networks which
+		// already reached their cap.
+		perASN := make(map[uint32]int)
+		ranked := selector.Select(
+			candidates, SelectQuery{
+				Count: len(candidates),
+				Rand:  rng,
+			},
+		)
+		for _, n := range ranked {
+			asn := asnDB.nodeASN(n)
+			if asn != 0 && perASN[asn] >= maxPerASN {
+				continue
+			}
+			perASN[asn]++
+
 			result = append(result, n)
-		}
-		if len(result) == count {
-			break
+			if len(result) == count {
+				break
+			}
 		}
 	}
 
 	// fmt.Println("Num reachable nodes: %v", len(nv.reachableNodes))
-	log.Infof("Num reachable nodes: %v", len(nv.reachableNodes))
+	log.Infof("Num reachable nodes: %v", numReachable)
 
 	return result
 }
@@ -117,51 +691,201 @@ func (nv *NetworkView) RandomSample(query NodeType, count int) []Node {
 // Insert nodes into the map of known nodes. Existing nodes with the
 // same Id are overwritten.
 func (nv *NetworkView) AddNode(node *lnrpc.LightningNode) (*Node, error) {
-	n := &Node{
-		Id:       node.PubKey,
-		LastSeen: time.Now(),
+	n, err := nv.parseNode(node)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, netAddr := range node.Addresses {
-		// If the address doesn't already have a port, we'll assume the
-		// current default port.
-		var addr string
-		_, _, err := net.SplitHostPort(netAddr.Addr)
-		if err != nil {
-			addr = net.JoinHostPort(netAddr.Addr, strconv.Itoa(defaultPort))
-		} else {
-			addr = netAddr.Addr
-		}
+	nv.Lock()
+	nv.ingestNode(n, time.Now())
+	nv.Unlock()
+
+	go func() {
+		nv.freshNodes <- freshNode{Node: *n}
+	}()
+
+	return n, nil
+}
 
-		parsedAddr, err := net.ResolveTCPAddr(netAddr.Network, addr)
+// parseNodes parses a batch of nodes from the channel graph, skipping and
+// counting the ones which can't be parsed.
+func (nv *NetworkView) parseNodes(nodes []*lnrpc.LightningNode) ([]Node, int) {
+	parsed := make([]Node, 0, len(nodes))
+	var failed int
+	for _, node := range nodes {
+		n, err := nv.parseNode(node)
 		if err != nil {
-			return nil, err
+			log.Debugf("Unable to add node %v: %v", node.PubKey, err)
+			failed++
+			continue
 		}
 
-		if parsedAddr.IP.To4() == nil {
-			n.Type |= 1
-		} else {
-			n.Type |= 1 << 2
-		}
+		parsed = append(parsed, *n)
+	}
+
+	return parsed, failed
+}
+
+// checkReachability hands the freshly added nodes over to the reachability
+// pruner, and calls done once it checked all of them.
+func (nv *NetworkView) checkReachability(nodes []Node, done func()) {
+	batch := new(sync.WaitGroup)
+	batch.Add(len(nodes))
 
-		if parsedAddr.Port == defaultPort {
-			n.Type |= 1 << 1
+	fresh := make([]Node, len(nodes))
+	copy(fresh, nodes)
+	go func() {
+		for _, n := range fresh {
+			nv.freshNodes <- freshNode{Node: n, batch: batch}
 		}
 
-		n.Addresses = append(n.Addresses, *parsedAddr)
+		batch.Wait()
+		done()
+	}()
+}
+
+// dialNode connects to the address of a node, see net.DialTimeout. Hostnames
+// are only resolved here, so the addresses they resolve to are refused if
+// they're private, as the IP addresses announced by the nodes are.
+func (nv *NetworkView) dialNode(network, address string) (net.Conn, error) {
+	if nv.dial != nil {
+		return nv.dial(network, address, dialTimeoutDuration)
 	}
 
-	if len(n.Addresses) == 0 {
-		return nil, fmt.Errorf("node had no addresses")
+	dialer := &net.Dialer{
+		Timeout: dialTimeoutDuration,
+		Control: func(network, address string,
+			_ syscall.RawConn) error {
+
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || isPrivateIP(ip) {
+				return fmt.Errorf("refusing to connect to %v",
+					host)
+			}
+
+			return nil
+		},
 	}
 
-	nv.Lock()
+	return dialer.Dial(network, address)
+}
+
+// ingestNode inserts a freshly parsed node into the map of known nodes,
+// tracking its update interval. The view must be locked.
+func (nv *NetworkView) ingestNode(n *Node, now time.Time) {
+	nv.pollNodes++
+	if clampFutureUpdate(n, nv.allNodes[n.Id], now) {
+		log.Debugf("Clamped the last update of %v, too far in the "+
+			"future", n.Id)
+
+		nv.skewedNodes++
+		nv.pollSkewed++
+	}
+	if n.LastUpdate.After(nv.pollNewest) {
+		nv.pollNewest = n.LastUpdate
+	}
+	n.UpdateInterval = trackUpdateInterval(nv.allNodes[n.Id], *n)
+	nv.trackAddressChange(n, now)
 	nv.allNodes[n.Id] = *n
-	nv.Unlock()
 
-	go func() {
-		nv.freshNodes <- *n
-	}()
+	// Keep the cadence of the reachable copy of the node current as well,
+	// as it's only refreshed once the node is found reachable again.
+	if r, ok := nv.reachableNodes[n.Id]; ok {
+		r.LastSeen = n.LastSeen
+		r.LastUpdate = n.LastUpdate
+		r.UpdateInterval = n.UpdateInterval
+		nv.reachableNodes[n.Id] = r
+	}
+}
+
+// trackUpdateInterval returns the moving average of the update interval of
+// a node, given its previous and current state.
+func trackUpdateInterval(prev, cur Node) time.Duration {
+	if prev.LastUpdate.IsZero() || !cur.LastUpdate.After(prev.LastUpdate) {
+		return prev.UpdateInterval
+	}
+
+	sample := cur.LastUpdate.Sub(prev.LastUpdate)
+	if prev.UpdateInterval == 0 {
+		return sample
+	}
+
+	return (3*prev.UpdateInterval + sample) / 4
+}
+
+// parseNode converts a node from the channel graph into our local model.
+// Nodes with an alias longer than BOLT #7 allows are rejected, and only the
+// first maxNodeAddresses addresses are parsed, so a single malformed entry
+// can't bloat the view or the responses. The private addresses are dropped.
+func parseNode(node *lnrpc.LightningNode) (*Node, error) {
+	if len(node.Alias) > maxNodeAliasLen {
+		return nil, fmt.Errorf("alias of %d bytes, more than %d",
+			len(node.Alias), maxNodeAliasLen)
+	}
+
+	n := &Node{
+		Id:       node.PubKey,
+		LastSeen: time.Now(),
+	}
+	if node.LastUpdate != 0 {
+		n.LastUpdate = time.Unix(int64(node.LastUpdate), 0)
+	}
+
+	addrs := node.Addresses
+	if len(addrs) > maxNodeAddresses {
+		log.Debugf("Truncating the %d addresses of %v to %d",
+			len(addrs), node.PubKey, maxNodeAddresses)
+		addrs = addrs[:maxNodeAddresses]
+	}
+
+	for _, netAddr := range addrs {
+		addr, err := ParseNodeAddress(netAddr)
+
+		// Invalid onion and hostname addresses are merely skipped,
+		// while an invalid IP address invalidates the whole node.
+		named := addr.Family&(NodeTypeTor|NodeTypeHostname) != 0
+		switch {
+		case err != nil && named:
+			log.Debugf("Skipping address of %v: %v", node.PubKey,
+				err)
+			continue
+
+		case err != nil:
+			return nil, err
+
+		// Addresses within private or reserved ranges are never
+		// served, so they don't even enter the view.
+		case addr.Private:
+			log.Debugf("Skipping private address %v of %v", addr,
+				node.PubKey)
+			continue
+		}
+
+		n.Type |= addr.Family
+		switch addr.Family {
+		case NodeTypeTor:
+			n.OnionAddresses = append(n.OnionAddresses, addr.String())
+
+		case NodeTypeHostname:
+			n.Hostnames = append(n.Hostnames, addr.String())
+
+		default:
+			if addr.Port == defaultPort {
+				n.Type |= NodeTypeDefaultPort
+			}
+			n.Addresses = append(n.Addresses, addr.TCPAddr())
+		}
+	}
+
+	if len(n.Addresses) == 0 && len(n.OnionAddresses) == 0 &&
+		len(n.Hostnames) == 0 {
+
+		return nil, fmt.Errorf("node had no addresses")
+	}
 
 	return n, nil
 }
@@ -198,9 +922,7 @@ func (nv *NetworkView) reachabilityPruner() {
 			log.Infof("Checking Node(%v) (%v) for reachability @ %v",
 				n.Id, nv.chain, addr.String())
 
-			tcpConn, err := net.DialTimeout(
-				"tcp", addr.String(), dialTimeoutDuration,
-			)
+			tcpConn, err := nv.dialNode("tcp", addr.String())
 			if err != nil {
 				log.Infof("Unable to reach %v via %v: %v", n.Id,
 					addr, err)
@@ -217,6 +939,29 @@ func (nv *NetworkView) reachabilityPruner() {
 		return addrs
 	}
 
+	// reachableHostnames works like reachableAddrs for the hostnames
+	// advertised by a node, which are resolved as they're dialed.
+	reachableHostnames := func(n Node) []string {
+		var hostnames []string
+
+		for _, hostname := range n.Hostnames {
+			log.Infof("Checking Node(%v) (%v) for reachability "+
+				"@ %v", n.Id, nv.chain, hostname)
+
+			conn, err := nv.dialNode("tcp", hostname)
+			if err != nil {
+				log.Infof("Unable to reach %v via %v: %v", n.Id,
+					hostname, err)
+				continue
+			}
+			conn.Close()
+
+			hostnames = append(hostnames, hostname)
+		}
+
+		return hostnames
+	}
+
 	seenNodes := make(map[string]struct{})
 
 	// extractReachableAddrs attempts to move the target node to the
@@ -234,8 +979,14 @@ func (nv *NetworkView) reachabilityPruner() {
 		seenNodes[newNode.Id] = struct{}{}
 		nv.Unlock()
 
+		// Onion addresses can't be dialed without Tor, so they're
+		// trusted as announced, keeping the node reachable through
+		// them even if none of its other addresses is.
 		validAddrs := reachableAddrs(newNode)
-		if len(validAddrs) == 0 {
+		validHostnames := reachableHostnames(newNode)
+		if len(validAddrs) == 0 && len(validHostnames) == 0 &&
+			len(newNode.OnionAddresses) == 0 {
+
 			log.Infof("Node(%v) (%v) has no reachable addresses, "+
 				"prune=%v", newNode.Id, nv.chain, prune)
 
@@ -251,10 +1002,14 @@ func (nv *NetworkView) reachabilityPruner() {
 			return
 		}
 
-		newNode.Addresses = validAddrs
+		setAddresses(&newNode, validAddrs)
+		newNode.Hostnames = validHostnames
+		if len(validHostnames) == 0 {
+			newNode.Type &^= NodeTypeHostname
+		}
 
 		nv.Lock()
-		nv.reachableNodes[newNode.Id] = newNode
+		nv.storeReachable(newNode, time.Now())
 		log.Infof("Node(%v) (%v) is reachable number of reachable "+
 			"nodes: %v", newNode.Id, nv.chain, len(nv.reachableNodes))
 		nv.Unlock()
@@ -280,7 +1035,10 @@ func (nv *NetworkView) reachabilityPruner() {
 					// log.Infof("sema returned")
 				}()
 
-				extractReachableAddrs(newNode, false)
+				extractReachableAddrs(newNode.Node, false)
+				if newNode.batch != nil {
+					newNode.batch.Done()
+				}
 			}()
 
 		// The prune timer has ticked, so we'll do two things: try to
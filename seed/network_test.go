@@ -0,0 +1,1226 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcutil"
+	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lnwire"
+)
+
+// testNode creates a node with the given ID advertising the given host:port
+// addresses.
+func testNode(id string, addrs ...string) Node {
+	n := Node{Id: id}
+	for _, addr := range addrs {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			panic(err)
+		}
+
+		if tcpAddr.IP.To4() == nil {
+			n.Type |= NodeTypeIPv6
+		} else {
+			n.Type |= NodeTypeIPv4
+		}
+		if tcpAddr.Port == defaultPort {
+			n.Type |= NodeTypeDefaultPort
+		}
+
+		n.Addresses = append(n.Addresses, *tcpAddr)
+	}
+
+	return n
+}
+
+// newTestView creates a network view in which all the given nodes are
+// reachable, without starting the reachability pruner.
+func newTestView(nodes ...Node) *NetworkView {
+	nv := &NetworkView{
+		chain:          "bitcoin",
+		allNodes:       make(map[string]Node),
+		reachableNodes: make(map[string]Node),
+		freshNodes:     make(chan freshNode, 100),
+	}
+	for _, n := range nodes {
+		nv.allNodes[n.Id] = n
+		nv.reachableNodes[n.Id] = n
+	}
+
+	return nv
+}
+
+// startPruner starts the reachability pruner of the view, to which only the
+// addresses for which reachable returns true accept connections.
+func startPruner(nv *NetworkView, reachable func(address string) bool) {
+	nv.dial = func(network, address string,
+		timeout time.Duration) (net.Conn, error) {
+
+		if !reachable(address) {
+			return nil, fmt.Errorf("unable to connect to %v",
+				address)
+		}
+
+		conn, peer := net.Pipe()
+		peer.Close()
+		return conn, nil
+	}
+
+	go nv.reachabilityPruner()
+}
+
+// markPolled records a successful poll of the view, without changing its
+// nodes.
+func markPolled(nv *NetworkView) {
+	nv.SetAllowEmptyPolls(true)
+	nv.ApplyPoll(&PollResult{})
+}
+
+func TestRandomSampleDualStack(t *testing.T) {
+	nv := newTestView(
+		testNode("v4", "1.1.1.1:9735"),
+		testNode("v6", "[2001:db8::1]:9735"),
+		testNode("dual1", "1.1.1.2:9735", "[2001:db8::2]:9735"),
+		testNode("dual2", "1.1.1.3:9736", "[2001:db8::3]:9735"),
+	)
+
+	nodes := nv.RandomSampleFunc(255, 25, Node.IsDualStack)
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 dual-stack nodes, got %d", len(nodes))
+	}
+	for _, n := range nodes {
+		if n.Id != "dual1" && n.Id != "dual2" {
+			t.Fatalf("node %v isn't dual-stack", n.Id)
+		}
+	}
+
+	// Without any dual-stack nodes the sample must be empty.
+	nv = newTestView(
+		testNode("v4", "1.1.1.1:9735"),
+		testNode("v6", "[2001:db8::1]:9735"),
+	)
+	if nodes := nv.RandomSampleFunc(255, 25, Node.IsDualStack); len(nodes) != 0 {
+		t.Fatalf("expected no nodes, got %v", nodes)
+	}
+}
+
+func TestUpdateIntervalTracking(t *testing.T) {
+	nv := newTestView()
+
+	announce := func(lastUpdate uint32) *Node {
+		n, err := nv.AddNode(&lnrpc.LightningNode{
+			PubKey:     "02aaaa",
+			LastUpdate: lastUpdate,
+			Addresses: []*lnrpc.NodeAddress{
+				{Network: "tcp", Addr: "1.1.1.1:9735"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+		return n
+	}
+
+	if n := announce(1000); n.UpdateInterval != 0 {
+		t.Fatalf("expected no interval yet, got %v", n.UpdateInterval)
+	}
+
+	// Seeing the same announcement again doesn't count as an update.
+	if n := announce(1000); n.UpdateInterval != 0 {
+		t.Fatalf("expected no interval yet, got %v", n.UpdateInterval)
+	}
+
+	if n := announce(1400); n.UpdateInterval != 400*time.Second {
+		t.Fatalf("expected 400s interval, got %v", n.UpdateInterval)
+	}
+
+	// Further samples are averaged in.
+	if n := announce(1600); n.UpdateInterval != 350*time.Second {
+		t.Fatalf("expected 350s interval, got %v", n.UpdateInterval)
+	}
+}
+
+func TestExcludeNodes(t *testing.T) {
+	nv := newTestView(
+		testNode("a", "1.1.1.1:9735"),
+		testNode("b", "1.1.1.2:9735"),
+		testNode("c", "1.1.1.3:9735", "[2001:db8::3]:9735"),
+		testNode("d", "1.1.1.4:9735", "[2001:db8::4]:9735"),
+	)
+
+	filter := ExcludeNodes(nil, "A", "c")
+	for i := 0; i < 100; i++ {
+		for _, n := range nv.RandomSampleFunc(255, 25, filter) {
+			if n.Id == "a" || n.Id == "c" {
+				t.Fatalf("excluded node %v returned", n.Id)
+			}
+		}
+	}
+	if sample := nv.RandomSampleFunc(255, 25, filter); len(sample) != 2 {
+		t.Fatalf("expected the 2 other nodes, got %v", sample)
+	}
+
+	// The exclusion applies on top of other filters.
+	filter = ExcludeNodes(Node.IsDualStack, "c")
+	sample := nv.RandomSampleFunc(255, 25, filter)
+	if len(sample) != 1 || sample[0].Id != "d" {
+		t.Fatalf("expected only node d, got %v", sample)
+	}
+}
+
+func TestNumReachableByType(t *testing.T) {
+	nv := newTestView(
+		testNode("v4", "1.1.1.1:9735"),
+		testNode("dual", "1.1.1.2:9735", "[2001:db8::2]:9735"),
+		testNode("v4b", "1.1.1.3:9736"),
+	)
+
+	counts := nv.NumReachableByType(NodeTypeIPv4, NodeTypeIPv6, NodeTypeTor)
+	if counts[0] != 3 || counts[1] != 1 || counts[2] != 0 {
+		t.Fatalf("unexpected counts %v", counts)
+	}
+}
+
+func TestRandomSampleSeeded(t *testing.T) {
+	var nodes []Node
+	for i := 0; i < 50; i++ {
+		nodes = append(nodes, testNode(
+			fmt.Sprintf("node%d", i), fmt.Sprintf("1.1.1.%d:9735", i),
+		))
+	}
+
+	// Views sharing the same seed return the same samples.
+	sample := func() []Node {
+		nv := newTestView(nodes...)
+		nv.SetRand(rand.New(rand.NewSource(42)))
+		return nv.RandomSample(255, 10)
+	}
+	first, second := sample(), sample()
+	for i := range first {
+		if first[i].Id != second[i].Id {
+			t.Fatalf("expected identical samples, got %v and %v",
+				first, second)
+		}
+	}
+}
+
+func TestAddNodeHostname(t *testing.T) {
+	nv := newTestView()
+
+	n, err := nv.AddNode(&lnrpc.LightningNode{
+		PubKey: "02aaaa",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "dns", Addr: "Node.Example.com:9736"},
+			{Network: "tcp", Addr: "seed.example.org"},
+			{Network: "tcp", Addr: "1.1.1.1:9735"},
+			{Network: "dns", Addr: "not a hostname"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to add node: %v", err)
+	}
+
+	expected := []string{"node.example.com:9736", "seed.example.org:9735"}
+	if !reflect.DeepEqual(n.Hostnames, expected) {
+		t.Fatalf("expected hostnames %v, got %v", expected, n.Hostnames)
+	}
+	if len(n.Addresses) != 1 {
+		t.Fatalf("expected the IP address only, got %v", n.Addresses)
+	}
+	if n.Type&NodeTypeHostname == 0 || n.Type&NodeTypeIPv4 == 0 {
+		t.Fatalf("unexpected node type %b", n.Type)
+	}
+
+	// A node advertising only hostnames is still known.
+	n, err = nv.AddNode(&lnrpc.LightningNode{
+		PubKey: "02bbbb",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "dns", Addr: "node.example.com"},
+		},
+	})
+	if err != nil || n.Type != NodeTypeHostname {
+		t.Fatalf("expected a hostname only node, got %v, %v", n, err)
+	}
+}
+
+func TestHostnameReachability(t *testing.T) {
+	nv := newTestView()
+	startPruner(nv, func(address string) bool {
+		return address == "node.example.com:9735" ||
+			address == "1.1.1.1:9735"
+	})
+	checked := make(chan struct{}, 1)
+	nv.OnPoll(func() { checked <- struct{}{} })
+
+	node := func(id string, addrs ...string) *lnrpc.LightningNode {
+		n := &lnrpc.LightningNode{PubKey: id}
+		for _, addr := range addrs {
+			n.Addresses = append(n.Addresses, &lnrpc.NodeAddress{
+				Network: "tcp", Addr: addr,
+			})
+		}
+		return n
+	}
+	nv.ApplyPoll(&PollResult{Nodes: []*lnrpc.LightningNode{
+		node("02aaaa", "node.example.com", "down.example.com"),
+		node("02bbbb", "down.example.com"),
+		node("02cccc", "down.example.com", "1.1.1.1:9735"),
+	}})
+	<-checked
+
+	// Hostnames are dialed like the IP addresses, and only the ones
+	// accepting connections are kept.
+	if n := nv.NumReachable(); n != 2 {
+		t.Fatalf("expected 2 reachable nodes, got %d", n)
+	}
+	nodes := nv.RandomSample(NodeTypeHostname, 25)
+	if len(nodes) != 1 || !reflect.DeepEqual(nodes[0].Hostnames,
+		[]string{"node.example.com:9735"}) {
+
+		t.Fatalf("expected the reachable hostname only, got %v",
+			nodes)
+	}
+
+	// Nor do hostnames get us to connect to private addresses.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	defer listener.Close()
+
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	_, err = newTestView().dialNode("tcp", "localhost:"+port)
+	if err == nil {
+		t.Fatalf("expected the private address to be refused")
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	nv := newTestView()
+	nv.SetQuarantine(2)
+
+	node := func(id, addr string) *lnrpc.LightningNode {
+		return &lnrpc.LightningNode{
+			PubKey: id,
+			Addresses: []*lnrpc.NodeAddress{
+				{Network: "tcp", Addr: addr},
+			},
+		}
+	}
+	old := node("old", "1.1.1.1:9735")
+	fresh := node("fresh", "1.1.1.2:9735")
+
+	// poll applies a poll of the given nodes. The pruner isn't running, so
+	// we'll mark them reachable ourselves.
+	poll := func(nodes ...*lnrpc.LightningNode) {
+		added, _ := nv.ApplyPoll(&PollResult{Nodes: nodes})
+
+		nv.Lock()
+		for _, n := range added {
+			nv.reachableNodes[n.Id] = n
+		}
+		nv.Unlock()
+	}
+	selectable := func(id string) bool {
+		for _, n := range nv.RandomSample(255, 25) {
+			if n.Id == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The nodes of the first poll aren't quarantined, so a restart doesn't
+	// empty the samples.
+	poll(old)
+	if !selectable("old") {
+		t.Fatalf("expected the nodes of the first poll to be selected")
+	}
+
+	// A new node needs to show up in two more polls to be selected.
+	for i := 0; i < 3; i++ {
+		poll(old, fresh)
+		if selectable("fresh") != (i == 2) {
+			t.Fatalf("unexpected selection after %d polls", i+1)
+		}
+	}
+
+	// Once it drops out of the graph, it's quarantined again on its
+	// return.
+	poll(old)
+	poll(old, fresh)
+	if selectable("fresh") {
+		t.Fatalf("expected the returning node to be quarantined")
+	}
+}
+
+func TestRequireChannelUpdates(t *testing.T) {
+	nv := newTestView(
+		testNode("channels", "1.1.1.1:9735"),
+		testNode("no-channels", "1.1.1.2:9735"),
+	)
+	nv.SetChannelUpdates(map[string]struct{}{"channels": {}})
+
+	// By default, nodes without channel updates are returned as well.
+	if sample := nv.RandomSample(255, 25); len(sample) != 2 {
+		t.Fatalf("expected both nodes, got %v", sample)
+	}
+
+	nv.RequireChannelUpdates(true)
+	for i := 0; i < 10; i++ {
+		sample := nv.RandomSample(255, 25)
+		if len(sample) != 1 || sample[0].Id != "channels" {
+			t.Fatalf("expected only the node with channels, got %v",
+				sample)
+		}
+	}
+}
+
+func TestMinCapacity(t *testing.T) {
+	nv := newTestView(
+		testNode("large", "1.1.1.1:9735"),
+		testNode("small", "1.1.1.2:9735"),
+		testNode("unknown", "1.1.1.3:9735"),
+	)
+	nv.SetCapacities(map[string]int64{
+		"large": 5000000,
+		"small": 20000,
+	})
+
+	// By default, nodes of any capacity are returned.
+	if sample := nv.RandomSample(255, 25); len(sample) != 3 {
+		t.Fatalf("expected all the nodes, got %v", sample)
+	}
+
+	nv.SetMinCapacity(btcutil.Amount(1000000))
+	for i := 0; i < 10; i++ {
+		sample := nv.RandomSample(255, 25)
+		if len(sample) != 1 || sample[0].Id != "large" {
+			t.Fatalf("expected only the large node, got %v", sample)
+		}
+	}
+
+	// The threshold itself is enough.
+	nv.SetMinCapacity(btcutil.Amount(20000))
+	if sample := nv.RandomSample(255, 25); len(sample) != 2 {
+		t.Fatalf("expected the large and small nodes, got %v", sample)
+	}
+}
+
+func TestNodeChannelStats(t *testing.T) {
+	nv := newTestView(testNode("a", "1.1.1.1:9735"))
+	nv.ApplyPoll(&PollResult{
+		Nodes: []*lnrpc.LightningNode{{
+			PubKey: "a",
+			Addresses: []*lnrpc.NodeAddress{{
+				Network: "tcp", Addr: "1.1.1.1:9735",
+			}},
+		}},
+		ChannelStats: NodeChannelStats([]*lnrpc.ChannelEdge{
+			{Node1Pub: "a", Node2Pub: "b", Capacity: 100000},
+			{Node1Pub: "c", Node2Pub: "a", Capacity: 20000},
+			{Node1Pub: "a", Node2Pub: "c", Capacity: 500000},
+		}),
+	})
+
+	stats, ok := nv.ChannelStats("a")
+	want := ChannelStats{
+		Channels:   3,
+		Capacity:   620000,
+		MinChannel: 20000,
+		MaxChannel: 500000,
+	}
+	if !ok || stats != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+
+	stats, ok = nv.ChannelStats("b")
+	if !ok || stats.Channels != 1 || stats.MinChannel != 100000 {
+		t.Fatalf("unexpected stats of b: %+v", stats)
+	}
+
+	if _, ok := nv.ChannelStats("unknown"); ok {
+		t.Fatalf("expected no stats for a node without channels")
+	}
+}
+
+func TestRequiredFeatures(t *testing.T) {
+	nv := newTestView(
+		testNode("modern", "1.1.1.1:9735"),
+		testNode("old", "1.1.1.2:9735"),
+		testNode("unknown", "1.1.1.3:9735"),
+	)
+
+	modern := lnwire.NewRawFeatureVector(
+		lnwire.DataLossProtectOptional, lnwire.GossipQueriesRequired,
+	)
+	old := lnwire.NewRawFeatureVector(lnwire.DataLossProtectOptional)
+	nv.SetNodeFeatures("modern", modern)
+	nv.SetNodeFeatures("old", old)
+	nv.SetRequiredFeatures(ModernFeatures...)
+
+	// Nodes whose features are unknown aren't filtered.
+	sample := nv.RandomSample(255, 25)
+	if len(sample) != 2 {
+		t.Fatalf("expected 2 nodes, got %v", sample)
+	}
+	for _, n := range sample {
+		if n.Id == "old" {
+			t.Fatalf("old node returned")
+		}
+	}
+}
+
+func TestFeatureFilter(t *testing.T) {
+	nv := newTestView(
+		testNode("modern", "1.1.1.1:9735"),
+		testNode("old", "1.1.1.2:9735"),
+		testNode("unknown", "1.1.1.3:9735"),
+	)
+	nv.SetNodeFeatures("modern", lnwire.NewRawFeatureVector(
+		lnwire.GossipQueriesRequired,
+	))
+	nv.SetNodeFeatures("old", lnwire.NewRawFeatureVector(
+		lnwire.DataLossProtectOptional,
+	))
+
+	filter := nv.FeatureFilter(nil, lnwire.GossipQueriesOptional)
+	sample := nv.RandomSampleFunc(255, 25, filter)
+	if len(sample) != 2 {
+		t.Fatalf("expected 2 nodes, got %v", sample)
+	}
+	for _, n := range sample {
+		if n.Id == "old" {
+			t.Fatalf("node lacking the feature returned")
+		}
+	}
+
+	// It's combined with the given filter.
+	filter = nv.FeatureFilter(
+		ExcludeNodes(nil, "unknown"), lnwire.GossipQueriesOptional,
+	)
+	sample = nv.RandomSampleFunc(255, 25, filter)
+	if len(sample) != 1 || sample[0].Id != "modern" {
+		t.Fatalf("expected the modern node only, got %v", sample)
+	}
+}
+
+func TestPortFilter(t *testing.T) {
+	nv := newTestView(
+		testNode("default", "1.1.1.1:9735"),
+		testNode("custom", "1.1.1.2:9736"),
+		testNode("mixed", "1.1.1.3:9736", "[2001:db8::3]:9735"),
+	)
+
+	filter := PortFilter(nil, 9735, AllFamilies)
+	sample := nv.RandomSampleFunc(255, 25, filter)
+	if len(sample) != 2 {
+		t.Fatalf("expected 2 nodes, got %v", sample)
+	}
+	for _, n := range sample {
+		if n.Id == "custom" {
+			t.Fatalf("node without the port returned")
+		}
+	}
+
+	// The port must be on an address of the given families.
+	filter = PortFilter(nil, 9735, NodeTypeIPv4)
+	sample = nv.RandomSampleFunc(255, 25, filter)
+	if len(sample) != 1 || sample[0].Id != "default" {
+		t.Fatalf("expected the default node only, got %v", sample)
+	}
+
+	addrs := AddressesOnPort(sample[0], 9735, NodeTypeIPv4)
+	if len(addrs) != 1 || addrs[0].String() != "1.1.1.1:9735" {
+		t.Fatalf("unexpected addresses on the port: %v", addrs)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	nv := newTestView()
+
+	addNode := func(id string, lastUpdate time.Time) *Node {
+		n, err := nv.AddNode(&lnrpc.LightningNode{
+			PubKey:     id,
+			LastUpdate: uint32(lastUpdate.Unix()),
+			Addresses: []*lnrpc.NodeAddress{
+				{Network: "tcp", Addr: "1.1.1.1:9735"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unable to add node: %v", err)
+		}
+		return n
+	}
+
+	// A node slightly ahead of us is left alone.
+	now := time.Now()
+	ahead := now.Add(10 * time.Minute).Truncate(time.Second)
+	if n := addNode("02aaaa", ahead); !n.LastUpdate.Equal(ahead) {
+		t.Fatalf("expected %v, got %v", ahead, n.LastUpdate)
+	}
+	if nv.CheckClockSkew() {
+		t.Fatalf("unexpected clock skew")
+	}
+
+	// Nodes far in the future are clamped to now.
+	future := now.Add(48 * time.Hour)
+	for i := 0; i < 5; i++ {
+		n := addNode(fmt.Sprintf("02bb%02d", i), future)
+		if n.LastUpdate.After(time.Now()) {
+			t.Fatalf("expected the last update to be clamped, "+
+				"got %v", n.LastUpdate)
+		}
+	}
+	addNode("02cccc", now)
+	if !nv.CheckClockSkew() {
+		t.Fatalf("expected clock skew to be detected")
+	}
+	if nv.SkewedNodes() != 5 {
+		t.Fatalf("expected 5 skewed nodes, got %d", nv.SkewedNodes())
+	}
+
+	// A skewed node keeps its clamped last update, rather than being
+	// seen updating on every poll.
+	first := nv.allNodes["02bb00"]
+	n := addNode("02bb00", future)
+	if !n.LastUpdate.Equal(first.LastUpdate) || n.UpdateInterval != 0 {
+		t.Fatalf("expected the last update to stay at %v, got %v "+
+			"with interval %v", first.LastUpdate, n.LastUpdate,
+			n.UpdateInterval)
+	}
+
+	nv.CheckClockSkew()
+
+	// The counts are reset by each check.
+	addNode("02dddd", now)
+	if nv.CheckClockSkew() {
+		t.Fatalf("unexpected clock skew")
+	}
+}
+
+func TestApplyPollNodes(t *testing.T) {
+	nv := newTestView()
+
+	nodes := []*lnrpc.LightningNode{{
+		PubKey:     "02aaaa",
+		LastUpdate: 1000,
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "1.1.1.1:9735"},
+		},
+	}, {
+		PubKey: "02bbbb",
+	}, {
+		PubKey:     "02cccc",
+		LastUpdate: 1000,
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "192.168.1.1:9735"},
+			{Network: "tcp", Addr: "[2001:db8::1]:9735"},
+		},
+	}, {
+		PubKey: "02dddd",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "10.0.0.1:9735"},
+		},
+	}}
+
+	// The private addresses are dropped, so a node with only private
+	// addresses fails like one without any.
+	added, failed := nv.ApplyPoll(&PollResult{Nodes: nodes})
+	if len(added) != 2 || failed != 2 {
+		t.Fatalf("expected 2 nodes added and 2 failures, got %d and %d",
+			len(added), failed)
+	}
+	if len(nv.allNodes) != 2 {
+		t.Fatalf("unexpected view after the batch: %v", nv.allNodes)
+	}
+	if addrs := nv.allNodes["02cccc"].Addresses; len(addrs) != 1 ||
+		addrs[0].String() != "[2001:db8::1]:9735" {
+
+		t.Fatalf("expected the public address only, got %v", addrs)
+	}
+
+	// A further batch tracks the update interval like AddNode does.
+	nodes[0].LastUpdate = 1400
+	added, _ = nv.ApplyPoll(&PollResult{Nodes: nodes})
+	if added[0].UpdateInterval != 400*time.Second {
+		t.Fatalf("expected 400s interval, got %v",
+			added[0].UpdateInterval)
+	}
+}
+
+// benchmarkIngestion measures the latency of sampling nodes while a poll of
+// 5000 nodes is repeatedly ingested with ingest.
+func benchmarkIngestion(b *testing.B,
+	ingest func(*NetworkView, []*lnrpc.LightningNode)) {
+
+	nodes := make([]*lnrpc.LightningNode, 5000)
+	for i := range nodes {
+		nodes[i] = &lnrpc.LightningNode{
+			PubKey: fmt.Sprintf("02%064x", i),
+			Addresses: []*lnrpc.NodeAddress{{
+				Network: "tcp",
+				Addr: fmt.Sprintf("1.%d.%d.1:9735", i/256,
+					i%256),
+			}},
+		}
+	}
+
+	nv := newTestView()
+	for i := 0; i < 100; i++ {
+		n := testNode(
+			fmt.Sprintf("03%064x", i), fmt.Sprintf("2.2.2.%d:9735", i),
+		)
+		nv.reachableNodes[n.Id] = n
+	}
+
+	// Nobody checks the reachability of the fresh nodes here.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-nv.freshNodes:
+			case <-done:
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				ingest(nv, nodes)
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		nv.RandomSample(255, 25)
+	}
+}
+
+func BenchmarkIngestionAddNode(b *testing.B) {
+	benchmarkIngestion(b, func(nv *NetworkView,
+		nodes []*lnrpc.LightningNode) {
+
+		for _, node := range nodes {
+			nv.AddNode(node)
+		}
+	})
+}
+
+func BenchmarkIngestionApplyPoll(b *testing.B) {
+	benchmarkIngestion(b, func(nv *NetworkView,
+		nodes []*lnrpc.LightningNode) {
+
+		nv.ApplyPoll(&PollResult{Nodes: nodes})
+	})
+}
+
+// BenchmarkRandomSample measures concurrent samples of a graph of realistic
+// size, whose candidates are sorted and selected outside the lock.
+func BenchmarkRandomSample(b *testing.B) {
+	nv := newTestView()
+	for i := 0; i < 10000; i++ {
+		n := testNode(
+			fmt.Sprintf("02%064x", i),
+			fmt.Sprintf("1.%d.%d.1:9735", i/256, i%256),
+		)
+		nv.allNodes[n.Id] = n
+		nv.reachableNodes[n.Id] = n
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			nv.RandomSample(255, 25)
+		}
+	})
+}
+
+func TestGraphProgress(t *testing.T) {
+	nv := newTestView()
+
+	poll := func(lastUpdate uint32) bool {
+		_, failed := nv.ApplyPoll(&PollResult{
+			Nodes: []*lnrpc.LightningNode{{
+				PubKey:     "02aaaa",
+				LastUpdate: lastUpdate,
+				Addresses: []*lnrpc.NodeAddress{
+					{Network: "tcp", Addr: "1.1.1.1:9735"},
+				},
+			}},
+		})
+		if failed != 0 {
+			t.Fatalf("unable to add node")
+		}
+
+		return nv.CheckGraphProgress(2)
+	}
+
+	if poll(1000) {
+		t.Fatalf("unexpected stall on the first poll")
+	}
+	if !nv.NewestUpdate().Equal(time.Unix(1000, 0)) {
+		t.Fatalf("unexpected newest update %v", nv.NewestUpdate())
+	}
+
+	// The graph doesn't change for a poll, which may happen.
+	if poll(1000) {
+		t.Fatalf("unexpected stall after a single poll")
+	}
+
+	// Nor for a second one, which is one too many.
+	if !poll(1000) {
+		t.Fatalf("expected a stall after two polls")
+	}
+
+	// Once the graph advances again, all is well.
+	if poll(2000) {
+		t.Fatalf("unexpected stall")
+	}
+	if !nv.NewestUpdate().Equal(time.Unix(2000, 0)) {
+		t.Fatalf("unexpected newest update %v", nv.NewestUpdate())
+	}
+}
+
+func TestApplyPollAtomic(t *testing.T) {
+	const numNodes = 50
+
+	nv := newTestView()
+	for i := 0; i < numNodes; i++ {
+		n := testNode(
+			fmt.Sprintf("02%064x", i), fmt.Sprintf("1.1.1.%d:9735", i),
+		)
+		nv.reachableNodes[n.Id] = n
+	}
+
+	// Each poll bumps the last update of all the nodes, and their
+	// capacity to match, so a query seeing part of a poll only would
+	// return nodes disagreeing on either.
+	poll := func(gen int) *PollResult {
+		result := &PollResult{
+			Capacities:     make(map[string]int64),
+			ChannelUpdates: make(map[string]struct{}),
+		}
+		for i := 0; i < numNodes; i++ {
+			id := fmt.Sprintf("02%064x", i)
+			result.Nodes = append(result.Nodes, &lnrpc.LightningNode{
+				PubKey:     id,
+				LastUpdate: uint32(gen),
+				Addresses: []*lnrpc.NodeAddress{{
+					Network: "tcp",
+					Addr:    fmt.Sprintf("1.1.1.%d:9735", i),
+				}},
+			})
+			result.Capacities[id] = int64(gen)
+			result.ChannelUpdates[id] = struct{}{}
+		}
+		return result
+	}
+	nv.ApplyPoll(poll(1))
+	nv.RequireChannelUpdates(true)
+
+	// Nobody checks the reachability of the fresh nodes here.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-nv.freshNodes:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	polled := make(chan struct{})
+	go func() {
+		defer close(polled)
+		for gen := 2; gen < 200; gen++ {
+			nv.ApplyPoll(poll(gen))
+		}
+	}()
+
+	for {
+		select {
+		case <-polled:
+			return
+		default:
+		}
+
+		nodes := nv.RandomSample(255, numNodes)
+		if len(nodes) != numNodes {
+			t.Fatalf("expected %d nodes, got %d", numNodes,
+				len(nodes))
+		}
+		for _, n := range nodes {
+			if n.LastUpdate.Unix() != nodes[0].LastUpdate.Unix() ||
+				n.Capacity != n.LastUpdate.Unix() {
+
+				t.Fatalf("partial poll: node %v updated at %v "+
+					"with capacity %v, node %v at %v", n.Id,
+					n.LastUpdate.Unix(), n.Capacity,
+					nodes[0].Id, nodes[0].LastUpdate.Unix())
+			}
+		}
+	}
+}
+
+func TestOversizedNodes(t *testing.T) {
+	nv := newTestView()
+
+	var addrs []*lnrpc.NodeAddress
+	for i := 0; i < 1000; i++ {
+		addrs = append(addrs, &lnrpc.NodeAddress{
+			Network: "tcp",
+			Addr:    fmt.Sprintf("11.0.%d.%d:9735", i/256, i%256),
+		})
+	}
+
+	// The addresses of a node advertising too many are truncated.
+	n, err := nv.AddNode(&lnrpc.LightningNode{
+		PubKey:    "02aaaa",
+		Addresses: addrs,
+	})
+	if err != nil {
+		t.Fatalf("unable to add node: %v", err)
+	}
+	if len(n.Addresses) != maxNodeAddresses ||
+		len(nv.allNodes["02aaaa"].Addresses) != maxNodeAddresses {
+
+		t.Fatalf("expected %d addresses, got %d", maxNodeAddresses,
+			len(n.Addresses))
+	}
+	if nv.OversizedNodes() != 1 {
+		t.Fatalf("expected 1 oversized node, got %d",
+			nv.OversizedNodes())
+	}
+
+	// A node with an absurd alias is rejected, while the others of the
+	// batch are added.
+	added, failed := nv.ApplyPoll(&PollResult{
+		Nodes: []*lnrpc.LightningNode{{
+			PubKey: "02bbbb",
+			Alias:  strings.Repeat("x", 1<<20),
+			Addresses: []*lnrpc.NodeAddress{
+				{Network: "tcp", Addr: "1.1.1.1:9735"},
+			},
+		}, {
+			PubKey: "02cccc",
+			Alias:  strings.Repeat("x", maxNodeAliasLen),
+			Addresses: []*lnrpc.NodeAddress{
+				{Network: "tcp", Addr: "2.2.2.2:9735"},
+			},
+		}},
+	})
+	if len(added) != 1 || added[0].Id != "02cccc" || failed != 1 {
+		t.Fatalf("expected the node with the long alias to be "+
+			"rejected, got %v and %d failures", added, failed)
+	}
+	if _, ok := nv.allNodes["02bbbb"]; ok {
+		t.Fatalf("the node with the long alias was added")
+	}
+	if nv.OversizedNodes() != 2 {
+		t.Fatalf("expected 2 oversized nodes, got %d",
+			nv.OversizedNodes())
+	}
+}
+
+func TestEmptyPoll(t *testing.T) {
+	nv := newTestView()
+	nv.RequireChannelUpdates(true)
+
+	populated := &PollResult{
+		Nodes: []*lnrpc.LightningNode{{
+			PubKey: "02aaaa",
+			Addresses: []*lnrpc.NodeAddress{
+				{Network: "tcp", Addr: "1.1.1.1:9735"},
+			},
+		}},
+		Capacities:     map[string]int64{"02aaaa": 1000},
+		ChannelUpdates: map[string]struct{}{"02aaaa": {}},
+	}
+	nv.ApplyPoll(populated)
+	nv.reachableNodes["02aaaa"] = nv.allNodes["02aaaa"]
+	lastPoll := nv.lastPoll
+
+	// An empty graph following a populated one is ignored, the nodes
+	// keep being served along with their channels.
+	nv.ApplyPoll(&PollResult{
+		Capacities:     map[string]int64{},
+		ChannelUpdates: map[string]struct{}{},
+	})
+	if nv.EmptyPolls() != 1 {
+		t.Fatalf("expected 1 empty poll, got %d", nv.EmptyPolls())
+	}
+	sample := nv.RandomSample(255, 25)
+	if len(sample) != 1 || sample[0].Capacity != 1000 {
+		t.Fatalf("expected the known node, got %v", sample)
+	}
+	if !nv.lastPoll.Equal(lastPoll) {
+		t.Fatalf("the empty poll counted as a successful one")
+	}
+
+	// Unless allowed, in which case it's applied like any other.
+	nv.SetAllowEmptyPolls(true)
+	nv.ApplyPoll(&PollResult{
+		Capacities:     map[string]int64{},
+		ChannelUpdates: map[string]struct{}{},
+	})
+	if nv.EmptyPolls() != 1 {
+		t.Fatalf("expected 1 empty poll, got %d", nv.EmptyPolls())
+	}
+	if sample := nv.RandomSample(255, 25); len(sample) != 0 {
+		t.Fatalf("expected the empty poll to be applied, got %v",
+			sample)
+	}
+}
+
+func TestAllowedFamilies(t *testing.T) {
+	const onion = "vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd.onion:9735"
+
+	mixed := testNode("mixed", "1.1.1.1:9735")
+	mixed.Type |= NodeTypeTor
+	mixed.OnionAddresses = []string{onion}
+	torOnly := Node{
+		Id:             "tor",
+		Type:           NodeTypeTor,
+		OnionAddresses: []string{onion},
+	}
+	nv := newTestView(mixed, torOnly)
+
+	families, err := ParseFamilies("ipv4,ipv6,hostname")
+	if err != nil {
+		t.Fatalf("unable to parse families: %v", err)
+	}
+	nv.SetAllowedFamilies(families)
+
+	// The chain never hands out onion data, whichever way it's asked.
+	for _, query := range []NodeType{255, NodeTypeTor} {
+		for _, n := range nv.RandomSampleFunc(query, 25, nil) {
+			if n.Id != "mixed" || len(n.OnionAddresses) != 0 ||
+				n.Type&NodeTypeTor != 0 {
+
+				t.Fatalf("onion data served for %v: %v", query, n)
+			}
+		}
+	}
+	if sample := nv.RandomSampleFunc(NodeTypeTor, 25, nil); len(sample) != 0 {
+		t.Fatalf("expected no Tor node, got %v", sample)
+	}
+	if _, ok := nv.Lookup("tor"); ok {
+		t.Fatalf("Tor-only node looked up")
+	}
+	if n, ok := nv.Lookup("mixed"); !ok || len(n.OnionAddresses) != 0 {
+		t.Fatalf("expected the node without its onion address, got %v",
+			n)
+	}
+
+	// The view itself is left alone.
+	if len(nv.reachableNodes["mixed"].OnionAddresses) != 1 {
+		t.Fatalf("the onion address was removed from the view")
+	}
+
+	// All the families are allowed by default.
+	nv.SetAllowedFamilies(AllFamilies)
+	if sample := nv.RandomSampleFunc(NodeTypeTor, 25, nil); len(sample) != 2 {
+		t.Fatalf("expected both Tor nodes, got %v", sample)
+	}
+}
+
+func TestViewDigest(t *testing.T) {
+	a := newTestView(
+		testNode("02aaaa", "1.1.1.1:9735"),
+		testNode("02bbbb", "2.2.2.2:9735"),
+	)
+	b := newTestView(
+		testNode("02bbbb", "2.2.2.2:9736"),
+		testNode("02aaaa", "1.1.1.2:9735"),
+	)
+
+	// Views agreeing on the reachable nodes have the same digest,
+	// whatever their addresses.
+	da, db := a.Digest(false), b.Digest(true)
+	if da.Hash != db.Hash || da.Nodes != 2 || da.IDs != nil {
+		t.Fatalf("expected matching digests, got %v and %v", da, db)
+	}
+	if !reflect.DeepEqual(db.IDs, []string{"02aaaa", "02bbbb"}) {
+		t.Fatalf("unexpected IDs: %v", db.IDs)
+	}
+
+	b.reachableNodes["02cccc"] = testNode("02cccc", "3.3.3.3:9735")
+	db = b.Digest(true)
+	if da.Hash == db.Hash {
+		t.Fatalf("expected the digests to differ")
+	}
+
+	tests := []struct {
+		a, b    []string
+		overlap float64
+	}{
+		{nil, nil, 1},
+		{[]string{"x"}, nil, 0},
+		{[]string{"x", "y"}, []string{"y", "x"}, 1},
+		{a.Digest(true).IDs, db.IDs, 2.0 / 3},
+		{[]string{"x", "y"}, []string{"y", "z"}, 1.0 / 3},
+	}
+	for _, test := range tests {
+		if overlap := Overlap(test.a, test.b); overlap != test.overlap {
+			t.Fatalf("expected an overlap of %v between %v and %v, "+
+				"got %v", test.overlap, test.a, test.b, overlap)
+		}
+	}
+}
+
+func TestAddressGrace(t *testing.T) {
+	nv := newTestView(testNode("02aaaa", "1.1.1.1:9735"))
+	nv.SetAddressGrace(time.Minute)
+
+	lookup := func() []string {
+		n, ok := nv.Lookup("02aaaa")
+		if !ok {
+			t.Fatalf("node not found")
+		}
+		var addrs []string
+		for _, addr := range n.Addresses {
+			addrs = append(addrs, addr.String())
+		}
+		return addrs
+	}
+
+	// Seeing the same addresses again isn't a change.
+	now := time.Now()
+	n := testNode("02aaaa", "1.1.1.1:9735")
+	nv.ingestNode(&n, now)
+	if changes := nv.AddressChanges(); changes != 0 {
+		t.Fatalf("expected no address change, got %d", changes)
+	}
+
+	// The node rotates its IP, which isn't served before it's found
+	// reachable.
+	n = testNode("02aaaa", "[2001:db8::1]:9735")
+	nv.ingestNode(&n, now)
+	want := []string{"1.1.1.1:9735"}
+	if addrs := lookup(); !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("expected %v, got %v", want, addrs)
+	}
+	if nv.NodeAddressChanges("02aaaa") != 1 || nv.AddressChanges() != 1 {
+		t.Fatalf("expected one address change")
+	}
+
+	// Once it is, both addresses are served during the grace period, the
+	// new one first.
+	nv.storeReachable(n, now)
+	want = []string{"[2001:db8::1]:9735", "1.1.1.1:9735"}
+	if addrs := lookup(); !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("expected %v, got %v", want, addrs)
+	}
+	if sample := nv.RandomSample(NodeTypeIPv4, 25); len(sample) != 1 {
+		t.Fatalf("expected the node to still be served over IPv4")
+	}
+
+	// Once the grace period is over, the old address is dropped.
+	nv.storeReachable(n, now.Add(time.Minute))
+	want = []string{"[2001:db8::1]:9735"}
+	if addrs := lookup(); !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("expected %v, got %v", want, addrs)
+	}
+	if sample := nv.RandomSample(NodeTypeIPv4, 25); len(sample) != 0 {
+		t.Fatalf("expected the node to be IPv6 only, got %v", sample)
+	}
+
+	// Without a grace period, the old address is replaced right away.
+	nv.SetAddressGrace(0)
+	n = testNode("02aaaa", "2.2.2.2:9735")
+	nv.ingestNode(&n, now.Add(2*time.Minute))
+	nv.storeReachable(n, now.Add(2*time.Minute))
+	want = []string{"2.2.2.2:9735"}
+	if addrs := lookup(); !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("expected %v, got %v", want, addrs)
+	}
+	if changes := nv.NodeAddressChanges("02aaaa"); changes != 2 {
+		t.Fatalf("expected two address changes, got %d", changes)
+	}
+}
+
+func TestAnswerStability(t *testing.T) {
+	var nodes []Node
+	for i := 0; i < 50; i++ {
+		nodes = append(nodes, testNode(
+			fmt.Sprintf("02%04x", i), fmt.Sprintf("1.1.1.%d:9735", i),
+		))
+	}
+	nv := newTestView(nodes...)
+	now := time.Unix(1000*60, 0)
+	nv.now = func() time.Time { return now }
+
+	ids := func(sample []Node) []string {
+		var ids []string
+		for _, n := range sample {
+			ids = append(ids, n.Id)
+		}
+		return ids
+	}
+
+	// By default, each query gets a fresh sample.
+	a, b := ids(nv.RandomSample(255, 5)), ids(nv.RandomSample(255, 5))
+	if reflect.DeepEqual(a, b) {
+		t.Fatalf("expected different samples, got %v twice", a)
+	}
+
+	// Within a window, the same query gets the same sample.
+	nv.SetAnswerStability(time.Minute)
+	a = ids(nv.RandomSample(255, 5))
+	for i := 0; i < 10; i++ {
+		now = now.Add(5 * time.Second)
+		if b := ids(nv.RandomSample(255, 5)); !reflect.DeepEqual(a, b) {
+			t.Fatalf("expected the same sample within the window, "+
+				"got %v and %v", a, b)
+		}
+	}
+
+	// Another query doesn't.
+	if b := ids(nv.RandomSample(NodeTypeIPv4, 5)); reflect.DeepEqual(a, b) {
+		t.Fatalf("expected another sample for another query")
+	}
+
+	// Once the window is over, the sample changes.
+	now = now.Add(10 * time.Second)
+	b = ids(nv.RandomSample(255, 5))
+	if reflect.DeepEqual(a, b) {
+		t.Fatalf("expected a new sample in the next window, got %v", b)
+	}
+	if c := ids(nv.RandomSample(255, 5)); !reflect.DeepEqual(b, c) {
+		t.Fatalf("expected the same sample within the window, got %v "+
+			"and %v", b, c)
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	nv := newTestView(testNode("02aaaa", "1.1.1.1:9735"))
+
+	// The reachable copy of a node is seen along with each poll.
+	n := testNode("02aaaa", "1.1.1.1:9735")
+	n.LastSeen = time.Unix(1000, 0)
+	n.LastUpdate = time.Unix(500, 0)
+	nv.ingestNode(&n, time.Unix(1000, 0))
+
+	r, ok := nv.Lookup("02aaaa")
+	if !ok || !r.LastSeen.Equal(n.LastSeen) ||
+		!r.LastUpdate.Equal(n.LastUpdate) {
+
+		t.Fatalf("expected the node last seen at %v, updated at %v, "+
+			"got %v", n.LastSeen, n.LastUpdate, r)
+	}
+}
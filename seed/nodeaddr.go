@@ -0,0 +1,114 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// ParsedAddr is an address advertised by a node, in our local model.
+type ParsedAddr struct {
+	// Family is the family of the address, one of NodeTypeIPv4,
+	// NodeTypeIPv6, NodeTypeTor or NodeTypeHostname.
+	Family NodeType
+
+	// IP is the address of the IPv4 and IPv6 addresses.
+	IP net.IP
+
+	// Host is the canonical lowercase host of the onion and hostname
+	// addresses.
+	Host string
+
+	// Port is the port of the address, the default one unless given.
+	Port int
+
+	// Private is set for the IP addresses within a private or reserved
+	// range, which are never served.
+	Private bool
+}
+
+// TCPAddr returns the IPv4 or IPv6 address as a TCP address.
+func (a ParsedAddr) TCPAddr() net.TCPAddr {
+	return net.TCPAddr{IP: a.IP, Port: a.Port}
+}
+
+// String returns the address in its canonical host:port form.
+func (a ParsedAddr) String() string {
+	if a.IP != nil {
+		return net.JoinHostPort(a.IP.String(), strconv.Itoa(a.Port))
+	}
+
+	return net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+}
+
+// ParseNodeAddress parses an address advertised by a node in the channel
+// graph. Onion addresses, with or without a scheme, are brought into their
+// canonical form, and only v3 ones are accepted. Hostnames are kept as is,
+// rather than resolved to whatever they point at right now. IP addresses
+// without a port get the default one. The Family of the returned address is
+// set even if it's invalid, so callers can tell which kind of address they
+// failed to parse.
+func ParseNodeAddress(addr *lnrpc.NodeAddress) (ParsedAddr, error) {
+	switch {
+	case isOnionAddr(addr.Addr):
+		parsed := ParsedAddr{Family: NodeTypeTor}
+		onionAddr, err := normalizeOnionAddr(addr.Addr)
+		if err != nil {
+			return parsed, err
+		}
+
+		return parsed, splitParsedHost(&parsed, onionAddr)
+
+	case isHostnameAddr(addr):
+		parsed := ParsedAddr{Family: NodeTypeHostname}
+		hostname, err := normalizeHostnameAddr(addr.Addr)
+		if err != nil {
+			return parsed, err
+		}
+
+		return parsed, splitParsedHost(&parsed, hostname)
+	}
+
+	// If the address doesn't already have a port, we'll assume the
+	// current default port. Anything but a hostname is an IP literal.
+	host, _, err := net.SplitHostPort(addr.Addr)
+	hostPort := addr.Addr
+	if err != nil {
+		host = addr.Addr
+		hostPort = net.JoinHostPort(host, strconv.Itoa(defaultPort))
+	}
+
+	parsed := ParsedAddr{Family: NodeTypeIPv6}
+	if net.ParseIP(host).To4() != nil {
+		parsed.Family = NodeTypeIPv4
+	}
+
+	tcpAddr, err := net.ResolveTCPAddr(addr.Network, hostPort)
+	if err != nil {
+		return parsed, err
+	}
+
+	parsed.IP = tcpAddr.IP
+	parsed.Port = tcpAddr.Port
+	parsed.Private = isPrivateIP(tcpAddr.IP)
+
+	return parsed, nil
+}
+
+// splitParsedHost sets the host and port of a parsed address from its
+// canonical host:port form.
+func splitParsedHost(parsed *ParsedAddr, hostPort string) error {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return err
+	}
+
+	parsed.Host = host
+	parsed.Port, err = strconv.Atoi(port)
+	return err
+}
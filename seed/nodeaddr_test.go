@@ -0,0 +1,89 @@
+package seed
+
+import (
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+func TestParseNodeAddress(t *testing.T) {
+	tests := []struct {
+		network string
+		addr    string
+
+		family  NodeType
+		str     string
+		port    int
+		private bool
+		ok      bool
+	}{
+		{"tcp", "1.1.1.1:9735", NodeTypeIPv4, "1.1.1.1:9735", 9735,
+			false, true},
+
+		// The default port is assumed.
+		{"tcp", "1.1.1.1", NodeTypeIPv4, "1.1.1.1:9735", 9735, false,
+			true},
+		{"tcp", "[2001:db8::1]:9736", NodeTypeIPv6,
+			"[2001:db8::1]:9736", 9736, false, true},
+		{"tcp", "2001:db8::1", NodeTypeIPv6, "[2001:db8::1]:9735",
+			9735, false, true},
+
+		// Private and reserved ranges are flagged.
+		{"tcp", "192.168.1.1:9735", NodeTypeIPv4, "192.168.1.1:9735",
+			9735, true, true},
+		{"tcp", "[::1]:9735", NodeTypeIPv6, "[::1]:9735", 9735, true,
+			true},
+		{"tcp", "1.1.1.1:99999", NodeTypeIPv4, "", 0, false, false},
+
+		// Onion addresses are canonicalized.
+		{"tcp", "TOR://" + testOnion, NodeTypeTor, testOnion + ":9735",
+			9735, false, true},
+		{"tcp", "expyuzz4wqqyqhjn.onion:9735", NodeTypeTor, "", 0,
+			false, false},
+
+		// So are hostnames, whether flagged as such or not.
+		{"dns", "Node.Example.com:9736", NodeTypeHostname,
+			"node.example.com:9736", 9736, false, true},
+		{"tcp", "node.example.com", NodeTypeHostname,
+			"node.example.com:9735", 9735, false, true},
+		{"dns", "localhost:9735", NodeTypeHostname, "", 0, false,
+			false},
+	}
+
+	for _, test := range tests {
+		addr, err := ParseNodeAddress(&lnrpc.NodeAddress{
+			Network: test.network,
+			Addr:    test.addr,
+		})
+
+		// The family is known even for invalid addresses.
+		if addr.Family != test.family {
+			t.Fatalf("expected family %v for %v, got %v",
+				test.family, test.addr, addr.Family)
+		}
+
+		switch {
+		case test.ok && err != nil:
+			t.Fatalf("unable to parse %v: %v", test.addr, err)
+		case !test.ok && err == nil:
+			t.Fatalf("expected %v to be invalid, got %v", test.addr,
+				addr)
+		case !test.ok:
+			continue
+		}
+
+		if addr.String() != test.str || addr.Port != test.port ||
+			addr.Private != test.private {
+
+			t.Fatalf("expected %v (port %d, private %v) for %v, "+
+				"got %v (port %d, private %v)", test.str,
+				test.port, test.private, test.addr, addr,
+				addr.Port, addr.Private)
+		}
+		if (addr.IP != nil) != (test.family&(NodeTypeIPv4|
+			NodeTypeIPv6) != 0) {
+
+			t.Fatalf("unexpected IP of %v: %v", test.addr, addr.IP)
+		}
+	}
+}
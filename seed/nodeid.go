@@ -0,0 +1,125 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcutil/bech32"
+)
+
+const (
+	// DefaultNodeIDHRP is the human readable part of the bech32 encoded
+	// node IDs in the node names, unless a chain has its own, see
+	// ChainView.NodeIDHRP.
+	DefaultNodeIDHRP = "ln"
+
+	// maxNodeIDHRPLen is the longest human readable part of the node IDs
+	// which keeps them within the 63 characters of a DNS label: the
+	// separator, the 53 characters of the key and the 6 of the checksum
+	// take up 60 of them.
+	maxNodeIDHRPLen = 3
+)
+
+// EncodeNodeID encodes the hex encoded ID of a node in bech32 with the given
+// human readable part, as used in the node names.
+func EncodeNodeID(id, hrp string) (string, error) {
+	rawID, err := hex.DecodeString(id)
+	if err != nil {
+		return "", fmt.Errorf("malformed node id %v: %v", id, err)
+	}
+
+	convertedID, err := bech32.ConvertBits(rawID, 8, 5, true)
+	if err != nil {
+		return "", fmt.Errorf("unable to convert key=%x, %v", rawID, err)
+	}
+
+	encodedID, err := bech32.Encode(hrp, convertedID)
+	if err != nil {
+		return "", fmt.Errorf("unable to encode key=%x, %v",
+			convertedID, err)
+	}
+
+	return encodedID, nil
+}
+
+// DecodeNodeID decodes a bech32 encoded node ID, returning its human readable
+// part and the hex encoded ID of the node, which must be a valid public key.
+func DecodeNodeID(label string) (string, string, error) {
+	hrp, bin5, err := bech32.Decode(label)
+	if err != nil {
+		return "", "", fmt.Errorf("malformed bech32 pubkey")
+	}
+	bin, err := bech32.ConvertBits(bin5, 5, 8, false)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to convert bits: %x", bin5)
+	}
+
+	p, err := btcec.ParsePubKey(bin, btcec.S256())
+	if err != nil {
+		return "", "", fmt.Errorf("not a valid pubkey: %x", bin)
+	}
+
+	return hrp, fmt.Sprintf("%x", p.SerializeCompressed()), nil
+}
+
+// ValidateNodeIDHRP checks that hrp can be used as the human readable part of
+// the node IDs of a chain: up to 3 lowercase letters, so that the node IDs fit
+// in a DNS label, and can't be mistaken for any of the other labels of a
+// query.
+func ValidateNodeIDHRP(hrp string) error {
+	if hrp == "" || len(hrp) > maxNodeIDHRPLen {
+		return fmt.Errorf("%q must be 1 to %d characters long", hrp,
+			maxNodeIDHRPLen)
+	}
+	if strings.Trim(hrp, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return fmt.Errorf("%q must only hold lowercase letters", hrp)
+	}
+
+	return nil
+}
+
+// nodeIDHRP returns the human readable part of the node IDs of the chain
+// targeted by the request.
+func (ds *DnsServer) nodeIDHRP(req *DnsRequest) string {
+	chainView := ds.chainView(req)
+	if chainView != nil && chainView.NodeIDHRP != "" {
+		return chainView.NodeIDHRP
+	}
+
+	return DefaultNodeIDHRP
+}
+
+// isNodeIDLabel returns whether the label is a bech32 encoded node ID with the
+// human readable part of one of our chains.
+func (ds *DnsServer) isNodeIDLabel(label string) bool {
+	i := strings.LastIndexByte(label, '1')
+	if i < 1 {
+		return false
+	}
+
+	_, ok := ds.nodeIDChain(label[:i])
+	return ok
+}
+
+// nodeIDChain returns the prefix of the chain whose node IDs are encoded with
+// the given human readable part, which must be one of its own rather than the
+// default one, which any chain accepts.
+func (ds *DnsServer) nodeIDChain(hrp string) (string, bool) {
+	if hrp == "" || hrp == DefaultNodeIDHRP {
+		return "", false
+	}
+
+	for prefix, chainView := range ds.chainViews {
+		if chainView.NodeIDHRP == hrp {
+			return prefix, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sync/atomic"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+const (
+	// maxNodeAddresses is the number of addresses of a node we parse, the
+	// ones beyond are dropped. Genuine nodes advertise a handful at most,
+	// while a single malformed entry could carry thousands.
+	maxNodeAddresses = 16
+
+	// maxNodeAliasLen is the length of the longest alias a node can
+	// announce, per BOLT #7. Nodes with a longer one are malformed, and
+	// rejected.
+	maxNodeAliasLen = 32
+)
+
+// oversizedNode returns true if the node exceeds any of the per-node sanity
+// limits, and is either truncated or rejected by parseNode.
+func oversizedNode(node *lnrpc.LightningNode) bool {
+	return len(node.Addresses) > maxNodeAddresses ||
+		len(node.Alias) > maxNodeAliasLen
+}
+
+// parseNode parses a node like the package level parseNode, counting it if
+// it's oversized.
+func (nv *NetworkView) parseNode(node *lnrpc.LightningNode) (*Node, error) {
+	if oversizedNode(node) {
+		atomic.AddUint64(&nv.oversizedNodes, 1)
+	}
+
+	return parseNode(node)
+}
+
+// OversizedNodes returns the number of nodes added to the view which exceeded
+// the per-node sanity limits, and had their addresses truncated or were
+// rejected.
+func (nv *NetworkView) OversizedNodes() uint64 {
+	return atomic.LoadUint64(&nv.oversizedNodes)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultPingName is the label under which the health of the server
+	// is served by default.
+	defaultPingName = "ping"
+
+	// pingTTL is the TTL of the ping answers, which aren't cached so each
+	// probe reflects the current health of the server.
+	pingTTL = 0
+)
+
+// pingIP is the address served for A queries at the ping name.
+var pingIP = net.IPv4(127, 0, 0, 1)
+
+// pingName returns the label under which the health of the server is served.
+func (ds *DnsServer) pingName() string {
+	if ds.cfg.PingName != "" {
+		return strings.ToLower(ds.cfg.PingName)
+	}
+
+	return defaultPingName
+}
+
+// healthy returns whether the server is able to serve fresh data for at least
+// one chain, the same condition as readiness.
+func (ds *DnsServer) healthy() bool {
+	if ds.cfg.StaleAfter == 0 {
+		return true
+	}
+
+	for _, chainView := range ds.chainViews {
+		if chainView.NetView.Fresh(ds.cfg.StaleAfter) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handlePingQuery answers a query at the ping name with a fixed A or TXT
+// record while the server is healthy, and SERVFAIL otherwise, so monitors
+// limited to DNS can track the health of the process independently of the
+// nodes of any chain.
+func (ds *DnsServer) handlePingQuery(request *dns.Msg, response *dns.Msg,
+	req *DnsRequest) {
+
+	log.Debugf("Handling ping query")
+
+	if !ds.healthy() {
+		response.SetRcode(request, dns.RcodeServerFailure)
+		return
+	}
+
+	header := dns.RR_Header{
+		Name:  request.Question[0].Name,
+		Class: dns.ClassINET,
+		Ttl:   pingTTL,
+	}
+
+	switch req.qtype {
+	case dns.TypeA:
+		header.Rrtype = dns.TypeA
+		response.Answer = append(response.Answer, &dns.A{
+			Hdr: header,
+			A:   pingIP,
+		})
+
+	case dns.TypeTXT:
+		header.Rrtype = dns.TypeTXT
+		response.Answer = append(response.Answer, &dns.TXT{
+			Hdr: header,
+			Txt: []string{"ok"},
+		})
+	}
+}
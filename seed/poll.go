@@ -0,0 +1,102 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+// PollResult is the state of the graph obtained by a poll of the backend.
+type PollResult struct {
+	// Nodes are the nodes of the graph with at least one address.
+	Nodes []*lnrpc.LightningNode
+
+	// Capacities holds the capacity of the nodes, by ID.
+	Capacities map[string]int64
+
+	// ChannelUpdates holds the IDs of the nodes which sent at least one
+	// channel update.
+	ChannelUpdates map[string]struct{}
+
+	// ChannelStats holds the stats of the channels of the nodes, by ID.
+	ChannelStats map[string]ChannelStats
+}
+
+// ApplyPoll updates the view with the result of a successful poll of the
+// backend. The nodes are parsed before taking the lock, and then added, and
+// the capacities, channel updates and channel stats replaced, all within a
+// single hold of the lock, so queries observe either the view before the poll
+// or after it, never e.g. the new nodes with the old capacities, and aren't
+// held up by thousands of lock handoffs. The poll hooks are called once the
+// reachability pruner checked the added nodes, see OnPoll. It returns the
+// added nodes, and the number of nodes which couldn't be parsed.
+//
+// A poll without any node while the view has some is ignored altogether,
+// unless allowed with SetAllowEmptyPolls, as it's more likely to come from a
+// backend which is resyncing than from the network vanishing. The view then
+// isn't considered polled, so it eventually goes stale if the backend keeps
+// returning an empty graph.
+func (nv *NetworkView) ApplyPoll(poll *PollResult) ([]Node, int) {
+	added, failed := nv.parseNodes(poll.Nodes)
+
+	now := time.Now()
+	nv.Lock()
+	if nv.suspectEmptyPoll(poll) {
+		nv.emptyPolls++
+		known := len(nv.allNodes)
+		nv.Unlock()
+
+		log.Warnf("The %v backend returned an empty graph, keeping "+
+			"the %d known nodes, is it still syncing?", nv.chain,
+			known)
+
+		return nil, 0
+	}
+	for i := range added {
+		nv.ingestNode(&added[i], now)
+	}
+	nv.trackConfirmations(added, nv.lastPoll.IsZero())
+	nv.capacities = poll.Capacities
+	nv.channelUpdates = poll.ChannelUpdates
+	nv.channelStats = poll.ChannelStats
+	nv.lastPoll = now
+	hooks := nv.pollHooks
+	nv.Unlock()
+
+	nv.checkReachability(added, func() {
+		for _, hook := range hooks {
+			hook()
+		}
+	})
+
+	return added, failed
+}
+
+// suspectEmptyPoll returns true if the poll should be ignored, as it holds no
+// node while we know some. The caller must hold the lock.
+func (nv *NetworkView) suspectEmptyPoll(poll *PollResult) bool {
+	return len(poll.Nodes) == 0 && len(nv.allNodes) > 0 &&
+		!nv.allowEmptyPolls
+}
+
+// SetAllowEmptyPolls sets whether polls without any node are applied like any
+// other, rather than ignored while the view has nodes.
+func (nv *NetworkView) SetAllowEmptyPolls(allow bool) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.allowEmptyPolls = allow
+}
+
+// EmptyPolls returns the number of polls ignored since they held no node.
+func (nv *NetworkView) EmptyPolls() uint64 {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return nv.emptyPolls
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// PollLimiter caps the number of backend polls running at once across the
+// chains, so the chains polling at the same time queue rather than stampede
+// their backends. Waiting polls get a slot in the order they asked for one,
+// and a poll holding its slot for longer than maxHold gives it up, so a hung
+// backend can't starve the other chains.
+type PollLimiter struct {
+	sync.Mutex
+
+	slots   int
+	maxHold time.Duration
+
+	running int
+	waiting []chan struct{}
+}
+
+// NewPollLimiter creates a PollLimiter letting slots polls run at once, each
+// holding its slot for at most maxHold, or until done if zero.
+func NewPollLimiter(slots int, maxHold time.Duration) *PollLimiter {
+	return &PollLimiter{
+		slots:   slots,
+		maxHold: maxHold,
+	}
+}
+
+// Acquire waits for a slot for the poll of the given chain, and returns the
+// function releasing it once the poll is done. A nil PollLimiter doesn't cap
+// the polls.
+func (pl *PollLimiter) Acquire(chain string) func() {
+	if pl == nil {
+		return func() {}
+	}
+
+	pl.Lock()
+	if pl.running < pl.slots {
+		pl.running++
+		pl.Unlock()
+	} else {
+		ready := make(chan struct{})
+		pl.waiting = append(pl.waiting, ready)
+		pl.Unlock()
+
+		log.Debugf("Waiting for a free slot to poll %v", chain)
+		<-ready
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(pl.release)
+	}
+	if pl.maxHold == 0 {
+		return release
+	}
+
+	timer := time.AfterFunc(pl.maxHold, func() {
+		log.Warnf("The %v poll is taking longer than %v, letting "+
+			"the other polls through", chain, pl.maxHold)
+		release()
+	})
+
+	return func() {
+		timer.Stop()
+		release()
+	}
+}
+
+// release hands a slot over to the poll waiting the longest, or frees it.
+func (pl *PollLimiter) release() {
+	pl.Lock()
+	defer pl.Unlock()
+
+	if len(pl.waiting) == 0 {
+		pl.running--
+		return
+	}
+
+	ready := pl.waiting[0]
+	pl.waiting = pl.waiting[1:]
+	close(ready)
+}
+
+// Waiting returns the number of polls waiting for a slot.
+func (pl *PollLimiter) Waiting() int {
+	pl.Lock()
+	defer pl.Unlock()
+
+	return len(pl.waiting)
+}
@@ -0,0 +1,76 @@
+package seed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollLimiter(t *testing.T) {
+	pl := NewPollLimiter(1, 0)
+	release := pl.Acquire("bitcoin")
+
+	// waitFor waits until n polls wait for a slot.
+	waitFor := func(n int) {
+		t.Helper()
+
+		deadline := time.Now().Add(time.Second)
+		for pl.Waiting() != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d waiting polls, got %d", n,
+					pl.Waiting())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The polls queued behind the running one get the slot in turn.
+	order := make(chan string, 2)
+	for _, chain := range []string{"litecoin", "testnet"} {
+		chain := chain
+		waiting := pl.Waiting()
+		go func() {
+			release := pl.Acquire(chain)
+			order <- chain
+			release()
+		}()
+		waitFor(waiting + 1)
+	}
+
+	select {
+	case chain := <-order:
+		t.Fatalf("%v polled while the slot was taken", chain)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	for _, expected := range []string{"litecoin", "testnet"} {
+		if chain := <-order; chain != expected {
+			t.Fatalf("expected %v to poll, got %v", expected, chain)
+		}
+	}
+
+	// Releasing twice doesn't free up a second slot.
+	release()
+	release = pl.Acquire("bitcoin")
+	go func() {
+		pl.Acquire("litecoin")
+		order <- "litecoin"
+	}()
+	waitFor(1)
+	release()
+	<-order
+
+	// A poll holding its slot for too long gives it up.
+	pl = NewPollLimiter(1, 50*time.Millisecond)
+	pl.Acquire("bitcoin")
+	acquired := make(chan struct{})
+	go func() {
+		pl.Acquire("litecoin")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("a hung poll starved the others")
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !linux
+// +build !linux
+
+package seed
+
+import "fmt"
+
+// dropPrivileges is only supported on Linux.
+func dropPrivileges(userName, groupName string) error {
+	return fmt.Errorf("dropping privileges is only supported on Linux")
+}
@@ -0,0 +1,50 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// NewestUpdate returns the latest last update of the nodes added to the view,
+// or the zero time if there's none yet. It stops advancing if the backend
+// stops syncing the graph, even though polling it still succeeds.
+func (nv *NetworkView) NewestUpdate() time.Time {
+	nv.Lock()
+	defer nv.Unlock()
+
+	return nv.newestUpdate
+}
+
+// CheckGraphProgress is called once the nodes of a poll were added, and warns
+// if the newest last update of the nodes hasn't advanced in maxPolls polls,
+// which hints at the backend no longer syncing the graph. It returns true if
+// so. A maxPolls of 0 disables the check.
+func (nv *NetworkView) CheckGraphProgress(maxPolls int) bool {
+	nv.Lock()
+	newest := nv.pollNewest
+	nv.pollNewest = time.Time{}
+
+	if newest.After(nv.newestUpdate) {
+		nv.newestUpdate = newest
+		nv.stalledPolls = 0
+	} else {
+		nv.stalledPolls++
+	}
+	stalled := nv.stalledPolls
+	nv.Unlock()
+
+	if maxPolls == 0 || stalled < maxPolls {
+		return false
+	}
+
+	log.Warnf("The newest %v node update is still from %v after %d "+
+		"polls, is the backend still syncing the graph?", nv.chain,
+		nv.NewestUpdate(), stalled)
+
+	return true
+}
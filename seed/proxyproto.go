@@ -0,0 +1,211 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// proxyV1MaxLen is the maximum length of a PROXY protocol v1 header,
+	// including the trailing CRLF.
+	proxyV1MaxLen = 107
+
+	// proxyV2HeaderLen is the length of the fixed part of a PROXY protocol
+	// v2 header, followed by the addresses.
+	proxyV2HeaderLen = 16
+)
+
+// proxyV2Signature starts every PROXY protocol v2 header.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyListener is a net.Listener whose connections start with a PROXY
+// protocol v1 or v2 header, sent by a load balancer in front of us, holding
+// the address of the actual client.
+type proxyListener struct {
+	net.Listener
+}
+
+// Accept waits for and returns the next connection. Its header is only read
+// as the connection is first read from, so a slow client can't hold up the
+// others.
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// proxyConn is a connection starting with a PROXY protocol header, whose
+// remote address is the one of the header once read.
+type proxyConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+
+	headerOnce sync.Once
+	headerErr  error
+
+	mtx    sync.Mutex
+	remote net.Addr
+}
+
+// Read reads the data following the PROXY protocol header, failing if the
+// connection doesn't start with a valid one.
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.headerOnce.Do(func() {
+		remote, err := readProxyHeader(c.reader)
+		if err != nil {
+			c.headerErr = fmt.Errorf("invalid PROXY protocol "+
+				"header from %v: %v", c.Conn.RemoteAddr(), err)
+			return
+		}
+
+		c.mtx.Lock()
+		c.remote = remote
+		c.mtx.Unlock()
+	})
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the address of the client given by the PROXY protocol
+// header, or the one of the load balancer until the header is read, or if it
+// doesn't hold any.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header, and returns the
+// source address it holds, or nil if it doesn't hold any, e.g. for the
+// health checks of the load balancer itself.
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2Header(r)
+	}
+
+	return readProxyV1Header(r)
+}
+
+// readProxyV1Header reads a human readable PROXY protocol v1 header, e.g.
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 53\r\n".
+func readProxyV1Header(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) == proxyV1MaxLen {
+			return nil, fmt.Errorf("v1 header longer than %d bytes",
+				proxyV1MaxLen)
+		}
+
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, c)
+	}
+
+	fields := strings.Split(strings.TrimSuffix(string(line), "\r\n"), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, fmt.Errorf("not a v1 header")
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil, nil
+
+	case "TCP4", "TCP6":
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("expected 6 fields, got %d",
+				len(fields))
+		}
+
+		ip := net.ParseIP(fields[2])
+		if ip == nil || (ip.To4() != nil) != (fields[1] == "TCP4") {
+			return nil, fmt.Errorf("invalid source address %q",
+				fields[2])
+		}
+		port, err := strconv.ParseUint(fields[4], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid source port %q",
+				fields[4])
+		}
+
+		return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown protocol %q", fields[1])
+	}
+}
+
+// readProxyV2Header reads a binary PROXY protocol v2 header.
+func readProxyV2Header(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, proxyV2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("unknown version %d", header[12]>>4)
+	}
+
+	addrs := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return nil, err
+	}
+
+	// The LOCAL command is sent by the load balancer connecting on its
+	// own behalf, rather than proxying a client.
+	cmd := header[12] & 0xf
+	if cmd == 0 {
+		return nil, nil
+	}
+	if cmd != 1 {
+		return nil, fmt.Errorf("unknown command %d", cmd)
+	}
+
+	// The addresses are the source and destination IPs, followed by the
+	// source and destination ports. Unknown families carry no address we
+	// could use.
+	var ipLen int
+	switch header[13] >> 4 {
+	case 1:
+		ipLen = net.IPv4len
+	case 2:
+		ipLen = net.IPv6len
+	default:
+		return nil, nil
+	}
+	if len(addrs) < 2*ipLen+4 {
+		return nil, fmt.Errorf("addresses of %d bytes, expected %d",
+			len(addrs), 2*ipLen+4)
+	}
+
+	return &net.TCPAddr{
+		IP:   net.IP(addrs[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(addrs[2*ipLen:])),
+	}, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// dnsHeaderLen is the length of the header of a DNS message.
+const dnsHeaderLen = 12
+
+// isQueryPacket returns true if the raw message is a standard query with a
+// single question, judging from its header only: the QR bit is clear, the
+// opcode is QUERY and QDCOUNT is 1.
+func isQueryPacket(m []byte) bool {
+	if len(m) < dnsHeaderLen {
+		return false
+	}
+
+	// The QR bit and the opcode make up the upper 5 bits of the third
+	// byte.
+	if m[2]&0xf8 != 0 {
+		return false
+	}
+
+	return binary.BigEndian.Uint16(m[4:6]) == 1
+}
+
+// isQuery returns true if the message is a standard query with a single
+// question.
+func isQuery(r *dns.Msg) bool {
+	return !r.Response && r.Opcode == dns.OpcodeQuery &&
+		len(r.Question) == 1
+}
+
+// queryFilterReader is a dns.Reader dropping any UDP packet that isn't a
+// well-formed standard query before it reaches the server, so junk and
+// reflected responses never get an answer, not even a FORMERR, which would
+// make us an amplifier. This also ensures the server calls the handler for
+// every packet it's handed.
+type queryFilterReader struct {
+	dns.Reader
+}
+
+// ReadUDP reads the next UDP packet which is a standard query.
+func (r queryFilterReader) ReadUDP(conn *net.UDPConn,
+	timeout time.Duration) ([]byte, *dns.SessionUDP, error) {
+
+	for {
+		m, s, err := r.Reader.ReadUDP(conn, timeout)
+		if err != nil {
+			return m, s, err
+		}
+		if isQueryPacket(m) && new(dns.Msg).Unpack(m) == nil {
+			return m, s, nil
+		}
+
+		log.Debugf("Dropping malformed query from %v", s.RemoteAddr())
+	}
+}
+
+// newUDPServer creates the server answering the queries received on conn
+// with handler, once the malformed ones are dropped. If the number of UDP
+// workers is bounded, the queries are processed by a udpPool.
+func (ds *DnsServer) newUDPServer(conn net.PacketConn,
+	handler dns.Handler) *dns.Server {
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Net:        "udp",
+		Handler:    handler,
+		DecorateReader: func(r dns.Reader) dns.Reader {
+			return queryFilterReader{r}
+		},
+		TsigSecret: ds.tsigSecrets(),
+	}
+	if ds.udpWorkers == nil {
+		return server
+	}
+
+	pool := newUDPPool(
+		nil, ds.udpWorkers, ds.cfg.UDPQueueDepth, &ds.shedQueries,
+	)
+	server.Handler = pool.handler(handler)
+	server.DecorateReader = func(r dns.Reader) dns.Reader {
+		pool.Reader = queryFilterReader{r}
+		return pool
+	}
+
+	return server
+}
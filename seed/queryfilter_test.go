@@ -0,0 +1,142 @@
+package seed
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestDropMalformedQueries(t *testing.T) {
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{"": {NetView: newTestView(
+			testNode("02e89ca9e8da72b33d896bae51d20e7e6675aa971f7557500b6591b15429e717f1",
+				"1.1.1.1:9735"),
+		)}},
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := ds.newUDPServer(
+		conn, dns.HandlerFunc(ds.handleLightningDns),
+	)
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	// exchange sends the raw message, and returns the response if any.
+	exchange := func(m []byte) *dns.Msg {
+		client, err := net.Dial("udp", conn.LocalAddr().String())
+		if err != nil {
+			t.Fatalf("unable to dial: %v", err)
+		}
+		defer client.Close()
+
+		if _, err := client.Write(m); err != nil {
+			t.Fatalf("unable to send query: %v", err)
+		}
+
+		b := make([]byte, dns.MaxMsgSize)
+		client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := client.Read(b)
+		if err != nil {
+			return nil
+		}
+
+		resp := new(dns.Msg)
+		if err := resp.Unpack(b[:n]); err != nil {
+			t.Fatalf("unable to unpack response: %v", err)
+		}
+		return resp
+	}
+
+	pack := func(m *dns.Msg) []byte {
+		b, err := m.Pack()
+		if err != nil {
+			t.Fatalf("unable to pack query: %v", err)
+		}
+		return b
+	}
+
+	query := new(dns.Msg)
+	query.SetQuestion("root.", dns.TypeA)
+	if resp := exchange(pack(query)); resp == nil || len(resp.Answer) != 1 {
+		t.Fatalf("expected an answer to a valid query, got %v", resp)
+	}
+
+	response := query.Copy()
+	response.Response = true
+
+	twoQuestions := query.Copy()
+	twoQuestions.Question = append(twoQuestions.Question,
+		dns.Question{Name: "root.", Qtype: dns.TypeAAAA,
+			Qclass: dns.ClassINET})
+
+	update := query.Copy()
+	update.Opcode = dns.OpcodeUpdate
+
+	malformed := map[string][]byte{
+		"response":      pack(response),
+		"two questions": pack(twoQuestions),
+		"update":        pack(update),
+		"junk":          []byte("not a dns message at all"),
+		"short":         {0x00},
+	}
+	for name, m := range malformed {
+		if resp := exchange(m); resp != nil {
+			t.Fatalf("expected the %v to be dropped, got %v", name,
+				resp)
+		}
+	}
+}
+
+func TestMalformedQueryTransport(t *testing.T) {
+	ds := &DnsServer{rootDomain: "root"}
+
+	req := new(dns.Msg)
+	req.SetQuestion("root.", dns.TypeA)
+	req.Question = append(req.Question, req.Question[0])
+
+	// Over UDP malformed queries are dropped, over TCP they're refused.
+	if resp := ds.answer(req, &net.UDPAddr{}); resp != nil {
+		t.Fatalf("expected no answer over UDP, got %v", resp)
+	}
+	resp := ds.answer(req, &net.TCPAddr{})
+	if resp == nil || resp.Rcode != dns.RcodeFormatError {
+		t.Fatalf("expected FORMERR over TCP, got %v", resp)
+	}
+}
+
+func TestQueryNameTooLong(t *testing.T) {
+	ds := &DnsServer{rootDomain: "root"}
+
+	// Names with too many labels, or too long, aren't parsed.
+	for _, name := range []string{
+		strings.Repeat("a.", 100) + "root.",
+		strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." +
+			strings.Repeat("c", 63) + ".root.",
+	} {
+		resp := exchange(t, ds, name, dns.TypeA)
+		if resp.Rcode != dns.RcodeFormatError {
+			t.Fatalf("expected FORMERR for %v, got %v", name, resp)
+		}
+	}
+
+	// The limits are configurable.
+	ds.cfg.MaxQueryLabels = 2
+	resp := exchange(t, ds, "r0.root.", dns.TypeA)
+	if resp.Rcode == dns.RcodeFormatError {
+		t.Fatalf("expected r0.root. to be parsed, got %v", resp)
+	}
+	resp = exchange(t, ds, "a2.r0.root.", dns.TypeA)
+	if resp.Rcode != dns.RcodeFormatError {
+		t.Fatalf("expected FORMERR for a2.r0.root., got %v", resp)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// queryStatsFlushInterval is how often the query stats are written to disk.
+// Batching the writes avoids any disk I/O on the query path.
+const queryStatsFlushInterval = time.Minute
+
+// QueryStatsBucket holds the number of queries received within an hour,
+// keyed by chain and query type, e.g. "bitcoin/SRV".
+type QueryStatsBucket struct {
+	Hour   time.Time         `json:"hour"`
+	Counts map[string]uint64 `json:"counts"`
+}
+
+// QueryStats aggregates query counts by chain, type and hour, and persists
+// them to a JSON file so history survives restarts. Only the buckets of the
+// last retention hours are kept.
+type QueryStats struct {
+	sync.Mutex
+
+	path      string
+	retention int
+
+	buckets []*QueryStatsBucket
+	dirty   bool
+}
+
+// NewQueryStats creates a QueryStats persisted at path, loading any history
+// already stored there.
+func NewQueryStats(path string, retention int) (*QueryStats, error) {
+	qs := &QueryStats{
+		path:      path,
+		retention: retention,
+	}
+
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &qs.buckets); err != nil {
+			return nil, err
+		}
+	}
+
+	// Make sure we'll be able to write the stats later on.
+	if err := qs.Flush(); err != nil {
+		return nil, err
+	}
+
+	return qs, nil
+}
+
+// Record counts a query of type qtype for the given chain.
+func (qs *QueryStats) Record(chain, qtype string) {
+	qs.Lock()
+	defer qs.Unlock()
+
+	hour := time.Now().UTC().Truncate(time.Hour)
+
+	var bucket *QueryStatsBucket
+	if n := len(qs.buckets); n > 0 && qs.buckets[n-1].Hour.Equal(hour) {
+		bucket = qs.buckets[n-1]
+	} else {
+		bucket = &QueryStatsBucket{
+			Hour:   hour,
+			Counts: make(map[string]uint64),
+		}
+		qs.buckets = append(qs.buckets, bucket)
+	}
+
+	bucket.Counts[chain+"/"+qtype]++
+	qs.dirty = true
+}
+
+// Buckets returns a copy of the retained buckets, oldest first.
+func (qs *QueryStats) Buckets() []QueryStatsBucket {
+	qs.Lock()
+	defer qs.Unlock()
+
+	buckets := make([]QueryStatsBucket, 0, len(qs.buckets))
+	for _, b := range qs.buckets {
+		counts := make(map[string]uint64, len(b.Counts))
+		for k, v := range b.Counts {
+			counts[k] = v
+		}
+		buckets = append(buckets, QueryStatsBucket{
+			Hour:   b.Hour,
+			Counts: counts,
+		})
+	}
+
+	return buckets
+}
+
+// Flush drops the buckets past retention, and atomically writes the
+// remaining ones to disk.
+func (qs *QueryStats) Flush() error {
+	qs.Lock()
+	cutoff := time.Now().UTC().Truncate(time.Hour).Add(
+		-time.Duration(qs.retention-1) * time.Hour,
+	)
+	sort.Slice(qs.buckets, func(i, j int) bool {
+		return qs.buckets[i].Hour.Before(qs.buckets[j].Hour)
+	})
+	for len(qs.buckets) > 0 && qs.buckets[0].Hour.Before(cutoff) {
+		qs.buckets = qs.buckets[1:]
+	}
+
+	b, err := json.Marshal(qs.buckets)
+	qs.dirty = false
+	qs.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := qs.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, qs.path)
+}
+
+// Run periodically flushes the stats to disk, it never returns.
+func (qs *QueryStats) Run() {
+	ticker := time.NewTicker(queryStatsFlushInterval)
+	for range ticker.C {
+		qs.Lock()
+		dirty := qs.dirty
+		qs.Unlock()
+		if !dirty {
+			continue
+		}
+
+		if err := qs.Flush(); err != nil {
+			log.Errorf("Unable to write query stats: %v", err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package seed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueryStatsPersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lseed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stats.json")
+	qs, err := NewQueryStats(path, 2)
+	if err != nil {
+		t.Fatalf("unable to create stats: %v", err)
+	}
+
+	qs.Record("bitcoin", "A")
+	qs.Record("bitcoin", "A")
+	qs.Record("testnet", "SRV")
+
+	// Add a bucket which is past retention.
+	qs.buckets = append([]*QueryStatsBucket{{
+		Hour:   time.Now().UTC().Add(-3 * time.Hour),
+		Counts: map[string]uint64{"bitcoin/A": 1},
+	}}, qs.buckets...)
+
+	if err := qs.Flush(); err != nil {
+		t.Fatalf("unable to flush: %v", err)
+	}
+
+	// The history must survive a restart, minus the expired bucket.
+	qs, err = NewQueryStats(path, 2)
+	if err != nil {
+		t.Fatalf("unable to reopen stats: %v", err)
+	}
+	buckets := qs.Buckets()
+	if len(buckets) != 1 {
+		t.Fatalf("expected a single bucket, got %v", buckets)
+	}
+	counts := buckets[0].Counts
+	if counts["bitcoin/A"] != 2 || counts["testnet/SRV"] != 1 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// referralTTL is the TTL of the referrals to fallback seeds, short so that
+// clients come back to us once we know enough nodes again.
+const referralTTL = 60
+
+// ParseSeedList parses a comma separated list of seed domains, e.g.
+// "lseed.bitcoinstats.com,lseed.darosior.ninja".
+func ParseSeedList(s string) ([]string, error) {
+	var seeds []string
+	for _, seed := range strings.Split(s, ",") {
+		seed = strings.ToLower(strings.TrimSpace(seed))
+		if seed == "" {
+			continue
+		}
+
+		if _, ok := dns.IsDomainName(seed); !ok {
+			return nil, fmt.Errorf("invalid seed domain %q", seed)
+		}
+		seeds = append(seeds, dns.Fqdn(seed))
+	}
+
+	return seeds, nil
+}
+
+// bolt10Conditions returns the labels of the sub-domain which are standard
+// BOLT #10 conditions, or SRV service labels, e.g. "a2._nodes._tcp.", so
+// they can be carried over to another seed. The labels selecting the chain,
+// or specific to lseed, are left out, as other seeds may not know them.
+func bolt10Conditions(subdomain string) string {
+	var conditions []string
+	for _, label := range strings.Split(subdomain, ".") {
+		if len(label) == 0 {
+			continue
+		}
+		if label[0] == '_' {
+			conditions = append(conditions, label)
+			continue
+		}
+
+		switch label[0] {
+		case 'r', 'a', 'n':
+			if _, err := strconv.Atoi(label[1:]); err == nil {
+				conditions = append(conditions, label)
+			}
+		}
+	}
+
+	if len(conditions) == 0 {
+		return ""
+	}
+
+	return strings.Join(conditions, ".") + "."
+}
+
+// isChainApex returns true if the sub-domain is the bare name of a chain,
+// e.g. "test." or the root domain itself, which may hold other records than
+// the nodes, e.g. the SOA and NS records of the zone.
+func (ds *DnsServer) isChainApex(subdomain string) bool {
+	if subdomain == "" {
+		return true
+	}
+
+	labels := strings.Split(strings.TrimSuffix(subdomain, "."), ".")
+	if len(labels) != 1 {
+		return false
+	}
+	_, ok := ds.chainLabel(labels[0])
+
+	return ok
+}
+
+// referToFallbackSeed answers a wildcard query with a CNAME record pointing
+// at the same query under one of the fallback seeds of the chain, picked at
+// random, if the chain has fewer than FallbackMinNodes reachable nodes. This
+// way clients can still bootstrap while our view is too small, e.g. during
+// a cold start. As a CNAME may not coexist with other records, the bare names
+// of the chains are never referred, only the names below them. It returns
+// true if the query was referred.
+func (ds *DnsServer) referToFallbackSeed(r, m *dns.Msg, req *DnsRequest) bool {
+	if ds.isChainApex(req.subdomain) {
+		return false
+	}
+
+	chainView := ds.chainView(req)
+	if chainView == nil || len(chainView.FallbackSeeds) == 0 ||
+		chainView.NetView.NumReachable() >= ds.cfg.FallbackMinNodes {
+
+		return false
+	}
+
+	seeds := chainView.FallbackSeeds
+	seed := seeds[chainView.NetView.Intn(len(seeds))]
+	target := bolt10Conditions(req.subdomain) + seed
+
+	log.Debugf("Referring %v to %v", r.Question[0].Name, target)
+
+	m.Answer = append(m.Answer, &dns.CNAME{
+		Hdr: dns.RR_Header{
+			Name:   r.Question[0].Name,
+			Rrtype: dns.TypeCNAME,
+			Class:  dns.ClassINET,
+			Ttl:    referralTTL,
+		},
+		Target: target,
+	})
+
+	return true
+}
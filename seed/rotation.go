@@ -0,0 +1,101 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ChainRotation spreads the queries which don't name their chain across
+// several chains in a weighted round-robin, rather than serving them all from
+// the default chain, e.g. to share the bootstrap traffic of chains sharing an
+// address space.
+type ChainRotation struct {
+	sync.Mutex
+
+	// prefixes are the sub-domain prefixes of the chains, each repeated
+	// as many times as its weight.
+	prefixes []string
+	next     int
+}
+
+// NewChainRotation creates a ChainRotation across the chains with the given
+// sub-domain prefixes, picking each one as many times in a row as its weight.
+// Equal weights amount to a plain round-robin.
+func NewChainRotation(prefixes []string, weights []int) (*ChainRotation,
+	error) {
+
+	if len(prefixes) == 0 || len(prefixes) != len(weights) {
+		return nil, fmt.Errorf("expected a weight for each of at " +
+			"least one chain")
+	}
+
+	cr := &ChainRotation{}
+	for i, prefix := range prefixes {
+		if weights[i] < 1 {
+			return nil, fmt.Errorf("the weight of a chain must be "+
+				"positive, got %d", weights[i])
+		}
+
+		for j := 0; j < weights[i]; j++ {
+			cr.prefixes = append(cr.prefixes, prefix)
+		}
+	}
+
+	return cr, nil
+}
+
+// includes returns true if the chain with the given sub-domain prefix is
+// picked by the rotation. The prefixes never change once created.
+func (cr *ChainRotation) includes(prefix string) bool {
+	for _, p := range cr.prefixes {
+		if p == prefix {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Next returns the sub-domain prefix of the chain serving the next query.
+func (cr *ChainRotation) Next() string {
+	cr.Lock()
+	defer cr.Unlock()
+
+	prefix := cr.prefixes[cr.next]
+	cr.next = (cr.next + 1) % len(cr.prefixes)
+
+	return prefix
+}
+
+// rotates returns true if the chain of the request is picked by the
+// ChainRotation, as it's a wildcard query not naming its chain.
+func (ds *DnsServer) rotates(req *DnsRequest) bool {
+	return ds.cfg.ChainRotation != nil && !req.explicitChain &&
+		req.node_id == "" && !req.count && req.unknownLabel == ""
+}
+
+// rotateChain picks the chain of the request from the ChainRotation, if it's
+// one of the queries spread across chains. It's only called once the request
+// is to be answered, so merely parsing requests, e.g. to describe them,
+// doesn't advance the rotation. The pick is recorded as the request's chain,
+// so the whole answer comes from the same chain, and the node names in it are
+// prefixed with that chain.
+func (ds *DnsServer) rotateChain(req *DnsRequest) {
+	if !ds.rotates(req) {
+		return
+	}
+
+	ds.pickChain(req, ds.cfg.ChainRotation.Next())
+}
+
+// pickChain records the chain with the given prefix as the one serving the
+// request, as picked by the ChainRotation.
+func (ds *DnsServer) pickChain(req *DnsRequest, prefix string) {
+	req.chain = prefix
+	req.explicitChain = true
+	ds.setDefaultAddressTypes(req)
+}
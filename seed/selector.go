@@ -0,0 +1,109 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// SelectQuery describes the sample of nodes a query asks for.
+type SelectQuery struct {
+	// Count is the maximum number of nodes to select.
+	Count int
+
+	// Rand is the source of randomness of the selection.
+	Rand *rand.Rand
+}
+
+// Selector picks the nodes returned to a query among the candidates matching
+// it.
+type Selector interface {
+	// Select returns at most query.Count of the candidates, most
+	// preferred first. It may reorder the candidates slice.
+	Select(candidates []Node, query SelectQuery) []Node
+}
+
+// selectors are the available selectors, by name.
+var selectors = map[string]Selector{
+	"uniform":  UniformSelector{},
+	"capacity": CapacitySelector{},
+}
+
+// SelectorByName returns the selector with the given name, i.e. uniform or
+// capacity.
+func SelectorByName(name string) (Selector, error) {
+	selector, ok := selectors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown selector %v", name)
+	}
+
+	return selector, nil
+}
+
+// UniformSelector selects nodes uniformly at random.
+type UniformSelector struct{}
+
+// Select returns a uniformly random sample of the candidates.
+func (UniformSelector) Select(candidates []Node, query SelectQuery) []Node {
+	count := query.Count
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+
+	// A partial Fisher-Yates shuffle is all we need for the first count
+	// nodes.
+	for i := 0; i < count; i++ {
+		j := i + query.Rand.Intn(len(candidates)-i)
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+
+	return candidates[:count]
+}
+
+// CapacitySelector selects nodes at random, with a probability proportional
+// to their capacity, favouring the well connected nodes. Nodes of unknown
+// capacity are still selected, albeit rarely.
+type CapacitySelector struct{}
+
+// Select returns a sample of the candidates, weighted by capacity.
+func (CapacitySelector) Select(candidates []Node, query SelectQuery) []Node {
+	count := query.Count
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+
+	// Weighted sampling without replacement: each node draws the key
+	// u^(1/weight), and the nodes with the largest keys are selected
+	// (Efraimidis and Spirakis). We compare the logarithm of the keys
+	// instead, which doesn't lose precision for large weights.
+	keys := make([]float64, len(candidates))
+	for i, n := range candidates {
+		weight := float64(n.Capacity)
+		if weight < 1 {
+			weight = 1
+		}
+		keys[i] = math.Log(query.Rand.Float64()) / weight
+	}
+
+	sort.Sort(byKey{candidates, keys})
+
+	return candidates[:count]
+}
+
+// byKey sorts nodes by descending key.
+type byKey struct {
+	nodes []Node
+	keys  []float64
+}
+
+func (b byKey) Len() int           { return len(b.nodes) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] > b.keys[j] }
+func (b byKey) Swap(i, j int) {
+	b.nodes[i], b.nodes[j] = b.nodes[j], b.nodes[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
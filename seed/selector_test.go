@@ -0,0 +1,174 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testRand is the fixed seed source of randomness of the selector tests.
+var testRand = rand.New(rand.NewSource(1))
+
+// testQuery returns a query for count nodes using testRand.
+func testQuery(count int) SelectQuery {
+	return SelectQuery{
+		Count: count,
+		Rand:  testRand,
+	}
+}
+
+func selectorNodes(capacities ...int64) []Node {
+	var nodes []Node
+	for i, capacity := range capacities {
+		nodes = append(nodes, Node{
+			Id:       fmt.Sprintf("node%d", i),
+			Capacity: capacity,
+		})
+	}
+
+	return nodes
+}
+
+func TestUniformSelector(t *testing.T) {
+	selected := UniformSelector{}.Select(
+		selectorNodes(0, 0, 0, 0, 0), testQuery(3),
+	)
+	if len(selected) != 3 {
+		t.Fatalf("expected 3 nodes, got %d", len(selected))
+	}
+	seen := make(map[string]bool)
+	for _, n := range selected {
+		if seen[n.Id] {
+			t.Fatalf("node %v selected twice", n.Id)
+		}
+		seen[n.Id] = true
+	}
+
+	selected = UniformSelector{}.Select(
+		selectorNodes(0, 0), testQuery(3),
+	)
+	if len(selected) != 2 {
+		t.Fatalf("expected all 2 nodes, got %d", len(selected))
+	}
+
+	// Every node should get its turn.
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		selected := UniformSelector{}.Select(
+			selectorNodes(0, 0, 0, 0), testQuery(1),
+		)
+		counts[selected[0].Id]++
+	}
+	for id, count := range counts {
+		if count < 150 {
+			t.Fatalf("node %v only selected %d times", id, count)
+		}
+	}
+	if len(counts) != 4 {
+		t.Fatalf("expected all nodes to be selected, got %v", counts)
+	}
+}
+
+func TestCapacitySelector(t *testing.T) {
+	selected := CapacitySelector{}.Select(
+		selectorNodes(1, 2, 3), testQuery(5),
+	)
+	if len(selected) != 3 {
+		t.Fatalf("expected all 3 nodes, got %d", len(selected))
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		selected := CapacitySelector{}.Select(
+			selectorNodes(1e9, 1e6, 0), testQuery(1),
+		)
+		counts[selected[0].Id]++
+	}
+	if counts["node0"] < 950 {
+		t.Fatalf("expected the large node to be favoured, got %v",
+			counts)
+	}
+
+	// Nodes of unknown capacity are still selected when there's room.
+	selected = CapacitySelector{}.Select(
+		selectorNodes(1e9, 0), testQuery(2),
+	)
+	if len(selected) != 2 || selected[0].Id != "node0" {
+		t.Fatalf("unexpected selection %v", selected)
+	}
+}
+
+func TestSelectorByName(t *testing.T) {
+	for _, name := range []string{"uniform", "capacity"} {
+		if _, err := SelectorByName(name); err != nil {
+			t.Fatalf("unable to get selector %v: %v", name, err)
+		}
+	}
+
+	if _, err := SelectorByName("fastest"); err == nil {
+		t.Fatalf("expected an unknown selector to be refused")
+	}
+}
+
+// fixedSelector only ever selects the node with the given ID.
+type fixedSelector string
+
+func (s fixedSelector) Select(candidates []Node, query SelectQuery) []Node {
+	for _, n := range candidates {
+		if n.Id == string(s) {
+			return []Node{n}
+		}
+	}
+
+	return nil
+}
+
+func TestChainSelectors(t *testing.T) {
+	nodes := []Node{
+		testNode("02aaaa", "1.1.1.1:9735"),
+		testNode("02bbbb", "1.1.1.2:9735"),
+	}
+	bitcoin, testnet := newTestView(nodes...), newTestView(nodes...)
+	testnet.chain = "testnet"
+	ds := &DnsServer{
+		rootDomain: "root",
+		chainViews: map[string]*ChainView{
+			"":      {NetView: bitcoin},
+			"test.": {NetView: testnet},
+		},
+	}
+
+	// addrs returns the addresses answered to a query for name.
+	addrs := func(name string) []string {
+		var addrs []string
+		for _, rr := range exchange(t, ds, name, dns.TypeA).Answer {
+			addrs = append(addrs, rr.(*dns.A).A.String())
+		}
+		return addrs
+	}
+
+	// Each chain picks its nodes with its own selector.
+	bitcoin.SetSelector(fixedSelector("02aaaa"))
+	testnet.SetSelector(fixedSelector("02bbbb"))
+	for i := 0; i < 10; i++ {
+		if a := addrs("root."); len(a) != 1 || a[0] != "1.1.1.1" {
+			t.Fatalf("expected the bitcoin selector's node, got %v",
+				a)
+		}
+		if a := addrs("test.root."); len(a) != 1 || a[0] != "1.1.1.2" {
+			t.Fatalf("expected the testnet selector's node, got %v",
+				a)
+		}
+	}
+
+	// Changing the selector of a chain leaves the other one alone.
+	testnet.SetSelector(UniformSelector{})
+	if a := addrs("test.root."); len(a) != 2 {
+		t.Fatalf("expected all the testnet nodes, got %v", a)
+	}
+	if a := addrs("root."); len(a) != 1 || a[0] != "1.1.1.1" {
+		t.Fatalf("expected the bitcoin selector's node, got %v", a)
+	}
+}
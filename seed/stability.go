@@ -0,0 +1,97 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// SetAnswerStability makes the samples of the view change at most once per
+// window of the given duration: within a window, the same query is answered
+// with the same nodes, as long as the candidates don't change, e.g. with a
+// poll. This trades some of the spreading of the load across the nodes for
+// the hit rate of the caches in front of the seed. Zero picks the nodes anew
+// for every query.
+func (nv *NetworkView) SetAnswerStability(window time.Duration) {
+	nv.Lock()
+	defer nv.Unlock()
+
+	nv.stability = window
+}
+
+// sampleRand returns the source of randomness of a sample for the given node
+// type and count, owned by the caller so it can be used once the lock is
+// released. It's derived from the source of randomness of the view, or with
+// answer stability, from the current window and the query, keyed with a
+// secret of the view so the samples of the next windows can't be predicted.
+// The caller must hold the lock.
+func (nv *NetworkView) sampleRand(query NodeType, count int) *rand.Rand {
+	if nv.rng == nil {
+		nv.rng = newRand()
+	}
+	if nv.stability == 0 {
+		src := splitMix64(nv.rng.Uint64())
+		return rand.New(&src)
+	}
+
+	if nv.stabilityKey == nil {
+		nv.stabilityKey = make([]byte, 32)
+		if _, err := crand.Read(nv.stabilityKey); err != nil {
+			panic(fmt.Sprintf("unable to create the answer "+
+				"stability key: %v", err))
+		}
+	}
+
+	now := time.Now()
+	if nv.now != nil {
+		now = nv.now()
+	}
+
+	var seed [17]byte
+	binary.LittleEndian.PutUint64(
+		seed[:8], uint64(now.UnixNano()/int64(nv.stability)),
+	)
+	binary.LittleEndian.PutUint64(seed[8:16], uint64(count))
+	seed[16] = byte(query)
+
+	h := sha256.New()
+	h.Write(nv.stabilityKey)
+	h.Write(seed[:])
+	sum := h.Sum(nil)
+
+	src := splitMix64(binary.LittleEndian.Uint64(sum[:8]))
+	return rand.New(&src)
+}
+
+// splitMix64 is the SplitMix64 generator, a source of randomness whose state
+// is a single word. Unlike the default source, with its 607 words of state to
+// allocate and seed, it can be created for every sample at no cost.
+type splitMix64 uint64
+
+// Uint64 returns the next pseudo-random 64 bit value.
+func (s *splitMix64) Uint64() uint64 {
+	*s += 0x9e3779b97f4a7c15
+
+	z := uint64(*s)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+	return z ^ (z >> 31)
+}
+
+// Int63 returns the next pseudo-random non-negative 63 bit value.
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Seed resets the state of the generator.
+func (s *splitMix64) Seed(seed int64) {
+	*s = splitMix64(seed)
+}
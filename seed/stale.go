@@ -0,0 +1,125 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// staleTTL is the TTL of the records served from a stale view, so clients
+// come back for fresh data soon after the backend recovered.
+const staleTTL = 10
+
+// isStale returns true if the view of the chain targeted by the request
+// wasn't successfully polled within StaleAfter. The first query noticing a
+// change of staleness logs it.
+func (ds *DnsServer) isStale(req *DnsRequest) bool {
+	chainView := ds.chainView(req)
+	if ds.cfg.StaleAfter == 0 || chainView == nil {
+		return false
+	}
+
+	stale := !chainView.NetView.Fresh(ds.cfg.StaleAfter)
+	chain := chainView.NetView.Chain()
+
+	ds.staleMtx.Lock()
+	defer ds.staleMtx.Unlock()
+
+	if ds.staleChains == nil {
+		ds.staleChains = make(map[string]bool)
+	}
+	if ds.staleChains[chain] == stale {
+		return stale
+	}
+	ds.staleChains[chain] = stale
+
+	switch {
+	case !stale:
+		log.Infof("The %v view is fresh again", chain)
+	case ds.cfg.ServeStale:
+		log.Warnf("The %v view is stale, serving the last known "+
+			"nodes", chain)
+	default:
+		log.Warnf("The %v view is stale, failing queries", chain)
+	}
+
+	return stale
+}
+
+// shortenTTLs caps the TTL of the records of a response served from a stale
+// view to staleTTL, and counts it.
+func (ds *DnsServer) shortenTTLs(m *dns.Msg) {
+	atomic.AddUint64(&ds.staleResponses, 1)
+
+	for _, section := range [][]dns.RR{m.Answer, m.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype != dns.TypeOPT && hdr.Ttl > staleTTL {
+				hdr.Ttl = staleTTL
+			}
+		}
+	}
+}
+
+// agingTTLStart is the fraction of StaleAfter past which the TTLs of the
+// records of a chain are reduced with AgingTTL. With a StaleAfter of 3 poll
+// intervals, that's once a poll was missed.
+const agingTTLStart = 1.0 / 3
+
+// ageTTLs reduces the TTL of the records of a response as the view of the
+// chain targeted by the request ages, if AgingTTL is set. Past agingTTLStart,
+// the TTLs are scaled down linearly, reaching staleTTL as the view goes
+// stale, so clients refresh sooner instead of the TTLs dropping all at once.
+func (ds *DnsServer) ageTTLs(m *dns.Msg, req *DnsRequest) {
+	chainView := ds.chainView(req)
+	if !ds.cfg.AgingTTL || ds.cfg.StaleAfter == 0 || chainView == nil {
+		return
+	}
+
+	age, ok := chainView.NetView.PollAge()
+	if !ok {
+		return
+	}
+
+	factor := agingTTLFactor(age, ds.cfg.StaleAfter)
+	if factor == 1 {
+		return
+	}
+
+	for _, section := range [][]dns.RR{m.Answer, m.Extra} {
+		for _, rr := range section {
+			hdr := rr.Header()
+			if hdr.Rrtype == dns.TypeOPT || hdr.Ttl <= staleTTL {
+				continue
+			}
+
+			hdr.Ttl = staleTTL + uint32(float64(hdr.Ttl-staleTTL)*factor)
+		}
+	}
+}
+
+// agingTTLFactor returns the factor by which the TTLs above staleTTL are
+// scaled for a view last polled age ago, from 1 until agingTTLStart of
+// staleAfter, down to 0 at staleAfter.
+func agingTTLFactor(age, staleAfter time.Duration) float64 {
+	start := time.Duration(agingTTLStart * float64(staleAfter))
+	switch {
+	case age <= start:
+		return 1
+	case age >= staleAfter:
+		return 0
+	default:
+		return float64(staleAfter-age) / float64(staleAfter-start)
+	}
+}
+
+// StaleResponses returns the number of responses served from a stale view.
+func (ds *DnsServer) StaleResponses() uint64 {
+	return atomic.LoadUint64(&ds.staleResponses)
+}
@@ -0,0 +1,127 @@
+package seed
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testNodesFile = `{
+	"nodes": [
+		{
+			"pub_key": "02aaaa",
+			"alias": "first",
+			"addresses": [
+				{"network": "tcp", "addr": "1.1.1.1:9735"}
+			],
+			"features": {
+				"1": {"name": "data-loss-protect", "is_known": true},
+				"7": {"name": "gossip-queries", "is_known": true}
+			}
+		},
+		{
+			"pub_key": "02bbbb",
+			"alias": "second",
+			"addresses": [
+				{"network": "tcp", "addr": "2001:db8::1"}
+			]
+		},
+		{
+			"pub_key": "02cccc",
+			"alias": "no-addresses"
+		},
+		{
+			"pub_key": "02dddd",
+			"alias": "hostname",
+			"addresses": [
+				{"network": "dns", "addr": "node.example.com:9735"}
+			]
+		}
+	]
+}`
+
+func TestStaticNetworkView(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lseed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nodes.json")
+	if err := ioutil.WriteFile(path, []byte(testNodesFile), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	nodes, err := ReadNodesFile(path)
+	if err != nil {
+		t.Fatalf("unable to read nodes: %v", err)
+	}
+	if len(nodes) != 4 || nodes[0].Alias != "first" {
+		t.Fatalf("unexpected nodes: %v", nodes)
+	}
+
+	// The node without addresses can't be served.
+	nv := NewStaticNetworkView("bitcoin", nodes)
+	if nv.NumReachable() != 3 {
+		t.Fatalf("expected 3 reachable nodes, got %d",
+			nv.NumReachable())
+	}
+
+	n := nv.reachableNodes["02bbbb"]
+	if len(n.Addresses) != 1 || n.Addresses[0].Port != defaultPort {
+		t.Fatalf("expected default port to be assumed: %v", n)
+	}
+
+	features, err := ReadNodeFeatures(path)
+	if err != nil {
+		t.Fatalf("unable to read features: %v", err)
+	}
+	if len(features) != 1 || !features["02aaaa"].IsSet(7) ||
+		features["02aaaa"].IsSet(6) {
+
+		t.Fatalf("unexpected features: %v", features)
+	}
+
+	// Hostnames are decoded as such, and not resolved.
+	n = nv.reachableNodes["02dddd"]
+	if len(n.Hostnames) != 1 || n.Hostnames[0] != "node.example.com:9735" ||
+		len(n.Addresses) != 0 {
+
+		t.Fatalf("expected a hostname address: %v", n)
+	}
+}
+
+func TestReadNodeIDs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lseed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const id = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	path := filepath.Join(dir, "bootstrap")
+	contents := "# curated nodes\n\n  " + strings.ToUpper(id) + "  \n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := ReadNodeIDs(path)
+	if err != nil {
+		t.Fatalf("unable to read node ids: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Fatalf("unexpected node ids: %v", ids)
+	}
+
+	// Anything but a public key is refused, rather than silently never
+	// served.
+	contents += "02aaaa\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadNodeIDs(path); err == nil {
+		t.Fatalf("expected an invalid node id to be refused")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// onionSuffix is the suffix of Tor onion service hostnames.
+	onionSuffix = ".onion"
+
+	// onionV3Len is the length of a v3 onion service address, without
+	// the suffix.
+	onionV3Len = 56
+
+	// onionV3Version is the version byte of v3 onion service addresses.
+	onionV3Version = 0x03
+)
+
+// onionEncoding is the base32 encoding used for onion service addresses.
+var onionEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567")
+
+// isOnionAddr returns true if the host:port address, with or without a
+// scheme, refers to a Tor onion service.
+func isOnionAddr(addr string) bool {
+	host := stripScheme(addr)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.HasSuffix(strings.ToLower(host), onionSuffix)
+}
+
+// stripScheme removes a leading scheme, such as tor://, from addr.
+func stripScheme(addr string) string {
+	if i := strings.Index(addr, "://"); i >= 0 {
+		return addr[i+3:]
+	}
+
+	return addr
+}
+
+// normalizeOnionAddr canonicalizes an onion service address, as advertised
+// by different graph sources, into the lowercase host:port form without any
+// scheme. Only valid v3 onion addresses are accepted.
+func normalizeOnionAddr(addr string) (string, error) {
+	addr = strings.ToLower(stripScheme(addr))
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host, port = addr, strconv.Itoa(defaultPort)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", fmt.Errorf("invalid port in %v", addr)
+	}
+
+	if err := validateOnionV3(host); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// validateOnionV3 checks that host is a v3 onion service hostname, with a
+// matching checksum.
+func validateOnionV3(host string) error {
+	service := strings.TrimSuffix(host, onionSuffix)
+	if len(service) != onionV3Len {
+		return fmt.Errorf("%v isn't a v3 onion address", host)
+	}
+
+	// A v3 address is made of the public key of the service, followed by
+	// a two byte checksum and the version byte.
+	raw, err := onionEncoding.DecodeString(service)
+	if err != nil {
+		return fmt.Errorf("invalid onion address %v: %v", host, err)
+	}
+	pubKey, checksum, version := raw[:32], raw[32:34], raw[34]
+	if version != onionV3Version {
+		return fmt.Errorf("invalid onion version %d in %v", version,
+			host)
+	}
+
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pubKey)
+	h.Write([]byte{version})
+	if !bytes.Equal(h.Sum(nil)[:2], checksum) {
+		return fmt.Errorf("invalid onion checksum in %v", host)
+	}
+
+	return nil
+}
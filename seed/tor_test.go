@@ -0,0 +1,119 @@
+package seed
+
+import (
+	"testing"
+
+	"github.com/lightningnetwork/lnd/lnrpc"
+)
+
+const testOnion = "aaaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dyp3kead.onion"
+
+func TestNormalizeOnionAddr(t *testing.T) {
+	tests := []struct {
+		in  string
+		out string
+		ok  bool
+	}{
+		{testOnion + ":9735", testOnion + ":9735", true},
+		{testOnion, testOnion + ":9735", true},
+		{"AAAQEAYEAUDAOCAJBIFQYDIOB4IBCEQTCQKRMFYYDENBWHA5DYP3KEAD.ONION:9736",
+			testOnion + ":9736", true},
+		{"tor://" + testOnion + ":9735", testOnion + ":9735", true},
+		{"TOR://AaaqeayeaudaocajbifqydiOb4ibceqtcqkrmfyydenbwha5dyp3kead.onion",
+			testOnion + ":9735", true},
+
+		// Bad checksum.
+		{"baaqeayeaudaocajbifqydiob4ibceqtcqkrmfyydenbwha5dyp3kead.onion",
+			"", false},
+
+		// v2 onion addresses are no longer valid.
+		{"expyuzz4wqqyqhjn.onion:9735", "", false},
+
+		{testOnion + ":port", "", false},
+	}
+
+	for _, tt := range tests {
+		out, err := normalizeOnionAddr(tt.in)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("unexpected error for %v: %v", tt.in, err)
+		case !tt.ok && err == nil:
+			t.Errorf("expected %v to be rejected, got %v", tt.in, out)
+		case out != tt.out:
+			t.Errorf("expected %v for %v, got %v", tt.out, tt.in, out)
+		}
+	}
+}
+
+func TestParseNodeOnion(t *testing.T) {
+	n, err := parseNode(&lnrpc.LightningNode{
+		PubKey: "02aaaa",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "tor://" + testOnion},
+			{Network: "tcp", Addr: "expyuzz4wqqyqhjn.onion:9735"},
+			{Network: "tcp", Addr: "1.1.1.1:9735"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unable to parse node: %v", err)
+	}
+
+	if len(n.OnionAddresses) != 1 ||
+		n.OnionAddresses[0] != testOnion+":9735" {
+
+		t.Fatalf("unexpected onion addresses: %v", n.OnionAddresses)
+	}
+	if len(n.Addresses) != 1 || n.Type&NodeTypeTor == 0 {
+		t.Fatalf("unexpected node: %v", n)
+	}
+
+	// A node with only invalid onion addresses has no address at all.
+	_, err = parseNode(&lnrpc.LightningNode{
+		PubKey: "02bbbb",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "expyuzz4wqqyqhjn.onion:9735"},
+		},
+	})
+	if err == nil {
+		t.Fatalf("expected node without valid addresses to be rejected")
+	}
+}
+
+func TestOnionOnlyReachable(t *testing.T) {
+	// None of the IP addresses accepts connections.
+	nv := newTestView()
+	startPruner(nv, func(string) bool { return false })
+	checked := make(chan struct{}, 1)
+	nv.OnPoll(func() { checked <- struct{}{} })
+
+	nv.ApplyPoll(&PollResult{Nodes: []*lnrpc.LightningNode{{
+		PubKey: "02aaaa",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: testOnion + ":9735"},
+		},
+	}, {
+		PubKey: "02bbbb",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: testOnion + ":9736"},
+			{Network: "tcp", Addr: "1.1.1.1:9735"},
+		},
+	}, {
+		PubKey: "02cccc",
+		Addresses: []*lnrpc.NodeAddress{
+			{Network: "tcp", Addr: "2.2.2.2:9735"},
+		},
+	}}})
+	<-checked
+
+	// The onion addresses are trusted as announced, so the nodes with
+	// one are reachable, but only through it.
+	if n := nv.NumReachable(); n != 2 {
+		t.Fatalf("expected 2 reachable nodes, got %d", n)
+	}
+	if nodes := nv.RandomSample(NodeTypeTor, 25); len(nodes) != 2 {
+		t.Fatalf("expected both onion nodes, got %v", nodes)
+	}
+	if nodes := nv.RandomSample(NodeTypeIPv4, 25); len(nodes) != 0 {
+		t.Fatalf("expected no IPv4 node, got %v", nodes)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the clock skew between us and the clients, in seconds, within
+// which they accept the time our responses were signed at, as recommended by
+// RFC 8945.
+const tsigFudge = 300
+
+// tsigKeyName returns the name of the TSIG key with which responses are
+// signed, the root domain as a lowercase FQDN, e.g. nodes.lightning.directory.
+func (ds *DnsServer) tsigKeyName() string {
+	return dns.Fqdn(strings.ToLower(ds.rootDomain))
+}
+
+// tsigSecrets returns the TSIG secrets of our servers, by key name, or nil if
+// answer signing is disabled.
+func (ds *DnsServer) tsigSecrets() map[string]string {
+	if len(ds.cfg.AnswerHMACKey) == 0 {
+		return nil
+	}
+
+	return map[string]string{
+		ds.tsigKeyName(): base64.StdEncoding.EncodeToString(
+			ds.cfg.AnswerHMACKey,
+		),
+	}
+}
+
+// signAnswers adds a TSIG record to the response, if answer signing is
+// enabled, which the server fills in with the HMAC-SHA256 of the response as
+// it's written. The MAC covers the whole response, its ID, header and every
+// section, along with the time it was signed, so it can neither be attached
+// to another response nor replayed later on.
+func (ds *DnsServer) signAnswers(m *dns.Msg) {
+	if len(ds.cfg.AnswerHMACKey) == 0 {
+		return
+	}
+
+	m.SetTsig(ds.tsigKeyName(), dns.HmacSHA256, tsigFudge,
+		time.Now().Unix())
+}
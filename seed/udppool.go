@@ -0,0 +1,136 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// udpPacket is a UDP query waiting for a worker.
+type udpPacket struct {
+	m []byte
+	s *dns.SessionUDP
+}
+
+// udpPoolTimeout is returned by ReadUDP when no query could be processed
+// within the read timeout. It's temporary, so the server keeps reading.
+type udpPoolTimeout struct{}
+
+func (udpPoolTimeout) Error() string   { return "no query within timeout" }
+func (udpPoolTimeout) Timeout() bool   { return true }
+func (udpPoolTimeout) Temporary() bool { return true }
+
+// udpPool is a dns.Reader which bounds the number of UDP queries processed at
+// the same time by the workers of a DnsServer. The queries of its socket are
+// read as they come in, and queued until a worker is free. Once the queue is
+// full, further queries are shed rather than piling up.
+//
+// A worker is taken before handing a query over to the server, and freed once
+// the handler returned, see handler. This relies on the server calling the
+// handler for every query it's handed, which queryFilterReader ensures.
+type udpPool struct {
+	dns.Reader
+
+	// workers is shared by the pools of all the sockets of the server.
+	workers chan struct{}
+
+	queue chan udpPacket
+	err   error
+
+	start sync.Once
+	shed  *uint64
+}
+
+// newUDPPool creates a pool reading the queries of a socket with r, queueing
+// up to depth of them, and processing them with the given workers.
+func newUDPPool(r dns.Reader, workers chan struct{}, depth int,
+	shed *uint64) *udpPool {
+
+	return &udpPool{
+		Reader:  r,
+		workers: workers,
+		queue:   make(chan udpPacket, depth),
+		shed:    shed,
+	}
+}
+
+// readLoop reads the queries of the socket into the queue, shedding them if
+// it's full, until reading fails for good.
+func (p *udpPool) readLoop(conn *net.UDPConn, timeout time.Duration) {
+	for {
+		m, s, err := p.Reader.ReadUDP(conn, timeout)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+
+			p.err = err
+			close(p.queue)
+			return
+		}
+
+		select {
+		case p.queue <- udpPacket{m, s}:
+		default:
+			atomic.AddUint64(p.shed, 1)
+		}
+	}
+}
+
+// ReadUDP waits for a free worker, and then returns the next queued query.
+func (p *udpPool) ReadUDP(conn *net.UDPConn,
+	timeout time.Duration) ([]byte, *dns.SessionUDP, error) {
+
+	p.start.Do(func() {
+		go p.readLoop(conn, timeout)
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case p.workers <- struct{}{}:
+	case <-timer.C:
+		return nil, nil, udpPoolTimeout{}
+	}
+
+	select {
+	case pkt, ok := <-p.queue:
+		if !ok {
+			p.release()
+			return nil, nil, p.err
+		}
+		return pkt.m, pkt.s, nil
+
+	case <-timer.C:
+		p.release()
+		return nil, nil, udpPoolTimeout{}
+	}
+}
+
+// release frees up a worker.
+func (p *udpPool) release() {
+	<-p.workers
+}
+
+// handler wraps h so that the worker processing the query is freed once it
+// has been answered.
+func (p *udpPool) handler(h dns.Handler) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		defer p.release()
+		h.ServeDNS(w, r)
+	})
+}
+
+// ShedQueries returns the number of UDP queries dropped because all the
+// workers were busy and the queue was full.
+func (ds *DnsServer) ShedQueries() uint64 {
+	return atomic.LoadUint64(&ds.shedQueries)
+}
@@ -0,0 +1,98 @@
+package seed
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestUDPPoolShedding(t *testing.T) {
+	ds := NewDnsServer(nil, "", "", "root", nil, &DnsServerConfig{
+		UDPWorkers:    1,
+		UDPQueueDepth: 1,
+	})
+
+	// The handler holds on to its worker until released.
+	handling := make(chan struct{}, 10)
+	release := make(chan struct{})
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		handling <- struct{}{}
+		<-release
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		w.WriteMsg(m)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := ds.newUDPServer(conn, handler)
+	server.NotifyStartedFunc = func() { close(started) }
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+	<-started
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("unable to dial: %v", err)
+	}
+	defer client.Close()
+
+	send := func(id uint16) {
+		query := new(dns.Msg)
+		query.SetQuestion("root.", dns.TypeA)
+		query.Id = id
+		b, err := query.Pack()
+		if err != nil {
+			t.Fatalf("unable to pack query: %v", err)
+		}
+		if _, err := client.Write(b); err != nil {
+			t.Fatalf("unable to send query: %v", err)
+		}
+	}
+
+	// The first query occupies the only worker.
+	send(1)
+	select {
+	case <-handling:
+	case <-time.After(time.Second):
+		t.Fatalf("the first query wasn't handled")
+	}
+
+	// The next one waits in the queue, and the others are shed.
+	for id := uint16(2); id <= 5; id++ {
+		send(id)
+	}
+	deadline := time.Now().Add(time.Second)
+	for ds.ShedQueries() != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if shed := ds.ShedQueries(); shed != 3 {
+		t.Fatalf("expected 3 shed queries, got %d", shed)
+	}
+
+	// Once the worker is released, the queued query is answered too.
+	close(release)
+	ids := make(map[uint16]bool)
+	b := make([]byte, dns.MaxMsgSize)
+	for {
+		client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, err := client.Read(b)
+		if err != nil {
+			break
+		}
+		resp := new(dns.Msg)
+		if err := resp.Unpack(b[:n]); err != nil {
+			t.Fatalf("unable to unpack response: %v", err)
+		}
+		ids[resp.Id] = true
+	}
+	if len(ids) != 2 || !ids[1] || !ids[2] {
+		t.Fatalf("expected answers to queries 1 and 2, got %v", ids)
+	}
+}
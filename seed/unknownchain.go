@@ -0,0 +1,94 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	"strings"
+)
+
+const (
+	// maxUnknownChains caps the number of distinct prefixes the queries
+	// for unknown chains are counted by, to bound the cardinality of the
+	// metric. Further prefixes are counted under otherUnknownChain.
+	maxUnknownChains = 32
+
+	// otherUnknownChain is the prefix under which the queries for unknown
+	// chains past the cap, or with odd labels, are counted.
+	otherUnknownChain = "other"
+)
+
+// unknownChain returns the prefix targeted by the request if it's a chain we
+// don't serve. Requests for the dummy record, the discovery name, the version
+// or the ping name aren't routed to a chain.
+func (ds *DnsServer) unknownChain(req *DnsRequest) (string, bool) {
+	if req.dummy || req.discovery || req.version || req.ping {
+		return "", false
+	}
+
+	if req.unknownLabel != "" {
+		return req.unknownLabel, true
+	}
+
+	if ds.chainView(req) == nil {
+		if req.chain == "" {
+			return bitcoinAlias, true
+		}
+		return strings.TrimSuffix(req.chain, "."), true
+	}
+
+	return "", false
+}
+
+// recordUnknownChain counts a query for the unknown chain prefix.
+func (ds *DnsServer) recordUnknownChain(prefix string) {
+	ds.unknownChainMtx.Lock()
+	defer ds.unknownChainMtx.Unlock()
+
+	if ds.unknownChains == nil {
+		ds.unknownChains = make(map[string]uint64)
+	}
+
+	_, known := ds.unknownChains[prefix]
+	if !isHostnameLabel(prefix) ||
+		(!known && len(ds.unknownChains) >= maxUnknownChains) {
+
+		prefix = otherUnknownChain
+	}
+	ds.unknownChains[prefix]++
+}
+
+// UnknownChainQueries returns the number of queries for chains we don't
+// serve, by requested prefix.
+func (ds *DnsServer) UnknownChainQueries() map[string]uint64 {
+	ds.unknownChainMtx.Lock()
+	defer ds.unknownChainMtx.Unlock()
+
+	counts := make(map[string]uint64, len(ds.unknownChains))
+	for prefix, count := range ds.unknownChains {
+		counts[prefix] = count
+	}
+
+	return counts
+}
+
+// isHostnameLabel returns true if label is a plausible hostname label, made
+// of lowercase letters, digits and hyphens.
+func isHostnameLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+
+	for _, c := range label {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9':
+		case c == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Christian Decker. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package seed
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// versionName is the label under which the version of the server is served
+// as a TXT record, if enabled, so operators can check which build answers.
+const versionName = "version"
+
+// handleVersionQuery answers a TXT query at the version name with the
+// version of the server.
+func (ds *DnsServer) handleVersionQuery(request *dns.Msg, response *dns.Msg,
+	req *DnsRequest) {
+
+	log.Debugf("Handling version query")
+
+	if req.qtype != dns.TypeTXT {
+		return
+	}
+
+	rr := &dns.TXT{
+		Hdr: dns.RR_Header{
+			Name:   request.Question[0].Name,
+			Rrtype: dns.TypeTXT,
+			Class:  dns.ClassINET,
+			Ttl:    defaultTTL,
+		},
+		Txt: []string{ds.cfg.Version},
+	}
+	response.Answer = append(response.Answer, rr)
+}
@@ -0,0 +1,332 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: seed.proto
+
+package seedrpc
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type GetNodesRequest struct {
+	/// The chain to sample, i.e. bitcoin, litecoin or testnet. Defaults to the chain serving DNS queries without a chain.
+	Chain string `protobuf:"bytes,1,opt,name=chain,proto3" json:"chain,omitempty"`
+	/// Bitfield of the node types to return: 1 IPv6, 2 default port, 4 IPv4, 8 Tor, 16 hostname. Zero returns any node.
+	Type uint32 `protobuf:"varint,2,opt,name=type,proto3" json:"type,omitempty"`
+	/// Only return nodes advertising both an IPv4 and an IPv6 address.
+	DualStack bool `protobuf:"varint,3,opt,name=dual_stack,json=dualStack,proto3" json:"dual_stack,omitempty"`
+	/// The maximum number of nodes to return, defaults to 25.
+	Count uint32 `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	/// The hex encoded public keys of nodes which must not be returned, e.g. because they turned out to be unreachable.
+	Exclude              []string `protobuf:"bytes,5,rep,name=exclude,proto3" json:"exclude,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetNodesRequest) Reset()         { *m = GetNodesRequest{} }
+func (m *GetNodesRequest) String() string { return proto.CompactTextString(m) }
+func (*GetNodesRequest) ProtoMessage()    {}
+func (*GetNodesRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3e18d207606176b3, []int{0}
+}
+
+func (m *GetNodesRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetNodesRequest.Unmarshal(m, b)
+}
+func (m *GetNodesRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetNodesRequest.Marshal(b, m, deterministic)
+}
+func (m *GetNodesRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetNodesRequest.Merge(m, src)
+}
+func (m *GetNodesRequest) XXX_Size() int {
+	return xxx_messageInfo_GetNodesRequest.Size(m)
+}
+func (m *GetNodesRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetNodesRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetNodesRequest proto.InternalMessageInfo
+
+func (m *GetNodesRequest) GetChain() string {
+	if m != nil {
+		return m.Chain
+	}
+	return ""
+}
+
+func (m *GetNodesRequest) GetType() uint32 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *GetNodesRequest) GetDualStack() bool {
+	if m != nil {
+		return m.DualStack
+	}
+	return false
+}
+
+func (m *GetNodesRequest) GetCount() uint32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *GetNodesRequest) GetExclude() []string {
+	if m != nil {
+		return m.Exclude
+	}
+	return nil
+}
+
+type Node struct {
+	/// The hex encoded public key of the node.
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	/// The node types of the node, see GetNodesRequest.
+	Type uint32 `protobuf:"varint,2,opt,name=type,proto3" json:"type,omitempty"`
+	/// The clearnet addresses of the node, as host:port.
+	Addresses []string `protobuf:"bytes,3,rep,name=addresses,proto3" json:"addresses,omitempty"`
+	/// The Tor onion addresses of the node, as host:port.
+	OnionAddresses []string `protobuf:"bytes,4,rep,name=onion_addresses,json=onionAddresses,proto3" json:"onion_addresses,omitempty"`
+	/// The unix timestamp of the latest announcement of the node.
+	LastUpdate int64 `protobuf:"varint,5,opt,name=last_update,json=lastUpdate,proto3" json:"last_update,omitempty"`
+	/// The DNS hostname addresses of the node, as host:port.
+	Hostnames            []string `protobuf:"bytes,6,rep,name=hostnames,proto3" json:"hostnames,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Node) Reset()         { *m = Node{} }
+func (m *Node) String() string { return proto.CompactTextString(m) }
+func (*Node) ProtoMessage()    {}
+func (*Node) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3e18d207606176b3, []int{1}
+}
+
+func (m *Node) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Node.Unmarshal(m, b)
+}
+func (m *Node) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Node.Marshal(b, m, deterministic)
+}
+func (m *Node) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Node.Merge(m, src)
+}
+func (m *Node) XXX_Size() int {
+	return xxx_messageInfo_Node.Size(m)
+}
+func (m *Node) XXX_DiscardUnknown() {
+	xxx_messageInfo_Node.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Node proto.InternalMessageInfo
+
+func (m *Node) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *Node) GetType() uint32 {
+	if m != nil {
+		return m.Type
+	}
+	return 0
+}
+
+func (m *Node) GetAddresses() []string {
+	if m != nil {
+		return m.Addresses
+	}
+	return nil
+}
+
+func (m *Node) GetOnionAddresses() []string {
+	if m != nil {
+		return m.OnionAddresses
+	}
+	return nil
+}
+
+func (m *Node) GetLastUpdate() int64 {
+	if m != nil {
+		return m.LastUpdate
+	}
+	return 0
+}
+
+func (m *Node) GetHostnames() []string {
+	if m != nil {
+		return m.Hostnames
+	}
+	return nil
+}
+
+type GetNodesResponse struct {
+	Nodes                []*Node  `protobuf:"bytes,1,rep,name=nodes,proto3" json:"nodes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetNodesResponse) Reset()         { *m = GetNodesResponse{} }
+func (m *GetNodesResponse) String() string { return proto.CompactTextString(m) }
+func (*GetNodesResponse) ProtoMessage()    {}
+func (*GetNodesResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_3e18d207606176b3, []int{2}
+}
+
+func (m *GetNodesResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetNodesResponse.Unmarshal(m, b)
+}
+func (m *GetNodesResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetNodesResponse.Marshal(b, m, deterministic)
+}
+func (m *GetNodesResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetNodesResponse.Merge(m, src)
+}
+func (m *GetNodesResponse) XXX_Size() int {
+	return xxx_messageInfo_GetNodesResponse.Size(m)
+}
+func (m *GetNodesResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetNodesResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetNodesResponse proto.InternalMessageInfo
+
+func (m *GetNodesResponse) GetNodes() []*Node {
+	if m != nil {
+		return m.Nodes
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*GetNodesRequest)(nil), "seedrpc.GetNodesRequest")
+	proto.RegisterType((*Node)(nil), "seedrpc.Node")
+	proto.RegisterType((*GetNodesResponse)(nil), "seedrpc.GetNodesResponse")
+}
+
+func init() { proto.RegisterFile("seed.proto", fileDescriptor_3e18d207606176b3) }
+
+var fileDescriptor_3e18d207606176b3 = []byte{
+	// 302 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x91, 0x3f, 0x4f, 0xf3, 0x30,
+	0x10, 0xc6, 0xe5, 0x26, 0xfd, 0x93, 0xab, 0xda, 0xbe, 0xb2, 0xde, 0xc1, 0x20, 0x10, 0x51, 0x19,
+	0xf0, 0xd4, 0xa1, 0x0c, 0x8c, 0x88, 0xa9, 0x1b, 0x83, 0x2b, 0xe6, 0xca, 0xc4, 0x27, 0x35, 0xa2,
+	0xd8, 0x21, 0xe7, 0x48, 0xf0, 0x15, 0xf8, 0x34, 0x7c, 0x44, 0x64, 0xa7, 0x4d, 0x24, 0xd4, 0xcd,
+	0xf7, 0xbb, 0xc7, 0xcf, 0x73, 0xba, 0x03, 0x20, 0x44, 0xb3, 0xaa, 0x6a, 0xe7, 0x1d, 0x1f, 0x87,
+	0x77, 0x5d, 0x15, 0xcb, 0x6f, 0x06, 0x8b, 0x0d, 0xfa, 0x67, 0x67, 0x90, 0x14, 0x7e, 0x34, 0x48,
+	0x9e, 0xff, 0x87, 0x61, 0xb1, 0xd7, 0xa5, 0x15, 0x2c, 0x67, 0x32, 0x53, 0x6d, 0xc1, 0x39, 0xa4,
+	0xfe, 0xab, 0x42, 0x31, 0xc8, 0x99, 0x9c, 0xa9, 0xf8, 0xe6, 0xd7, 0x00, 0xa6, 0xd1, 0x87, 0x1d,
+	0x79, 0x5d, 0xbc, 0x89, 0x24, 0x67, 0x72, 0xa2, 0xb2, 0x40, 0xb6, 0x01, 0x44, 0x23, 0xd7, 0x58,
+	0x2f, 0xd2, 0xf8, 0xa7, 0x2d, 0xb8, 0x80, 0x31, 0x7e, 0x16, 0x87, 0xc6, 0xa0, 0x18, 0xe6, 0x89,
+	0xcc, 0xd4, 0xa9, 0x5c, 0xfe, 0x30, 0x48, 0xc3, 0x24, 0x7c, 0x0e, 0x83, 0xd2, 0x1c, 0xe3, 0x07,
+	0xa5, 0x39, 0x9b, 0x7d, 0x05, 0x99, 0x36, 0xa6, 0x46, 0x22, 0x24, 0x91, 0x44, 0xa3, 0x1e, 0xf0,
+	0x3b, 0x58, 0x38, 0x5b, 0x3a, 0xbb, 0xeb, 0x35, 0x69, 0xd4, 0xcc, 0x23, 0x7e, 0xea, 0x84, 0x37,
+	0x30, 0x3d, 0x68, 0xf2, 0xbb, 0xa6, 0x32, 0xda, 0x87, 0x89, 0x98, 0x4c, 0x14, 0x04, 0xf4, 0x12,
+	0x49, 0xc8, 0xd9, 0x3b, 0xf2, 0x56, 0xbf, 0x23, 0x89, 0x51, 0x9b, 0xd3, 0x81, 0xe5, 0x03, 0xfc,
+	0xeb, 0xd7, 0x47, 0x95, 0xb3, 0x84, 0xfc, 0x16, 0x86, 0x36, 0x00, 0xc1, 0xf2, 0x44, 0x4e, 0xd7,
+	0xb3, 0xd5, 0x71, 0xd9, 0xab, 0x20, 0x53, 0x6d, 0x6f, 0xbd, 0x81, 0x74, 0x8b, 0x68, 0xf8, 0x23,
+	0x4c, 0x4e, 0x06, 0x5c, 0x74, 0xca, 0x3f, 0x27, 0xb9, 0xbc, 0x38, 0xd3, 0x69, 0xd3, 0x5e, 0x47,
+	0xf1, 0xa2, 0xf7, 0xbf, 0x03, 0x00, 0x0a, 0x55, 0x55, 0x20, 0xdf, 0x01, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// SeedClient is the client API for Seed service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type SeedClient interface {
+	//
+	// GetNodes returns a random sample of the reachable nodes of a chain, using
+	// the same selection as the DNS queries.
+	GetNodes(ctx context.Context, in *GetNodesRequest, opts ...grpc.CallOption) (*GetNodesResponse, error)
+}
+
+type seedClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewSeedClient(cc *grpc.ClientConn) SeedClient {
+	return &seedClient{cc}
+}
+
+func (c *seedClient) GetNodes(ctx context.Context, in *GetNodesRequest, opts ...grpc.CallOption) (*GetNodesResponse, error) {
+	out := new(GetNodesResponse)
+	err := c.cc.Invoke(ctx, "/seedrpc.Seed/GetNodes", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SeedServer is the server API for Seed service.
+type SeedServer interface {
+	//
+	// GetNodes returns a random sample of the reachable nodes of a chain, using
+	// the same selection as the DNS queries.
+	GetNodes(context.Context, *GetNodesRequest) (*GetNodesResponse, error)
+}
+
+func RegisterSeedServer(s *grpc.Server, srv SeedServer) {
+	s.RegisterService(&_Seed_serviceDesc, srv)
+}
+
+func _Seed_GetNodes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetNodesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SeedServer).GetNodes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/seedrpc.Seed/GetNodes",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SeedServer).GetNodes(ctx, req.(*GetNodesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Seed_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "seedrpc.Seed",
+	HandlerType: (*SeedServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetNodes",
+			Handler:    _Seed_GetNodes_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "seed.proto",
+}
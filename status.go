@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/roasbeef/lseed/seed"
+)
+
+// chainStatus is the status report of a single chain view.
+type chainStatus struct {
+	Chain               string `json:"chain"`
+	Prefix              string `json:"prefix"`
+	ReachableNodes      int    `json:"reachable_nodes"`
+	Breaker             string `json:"breaker"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	LastPoll            string `json:"last_poll,omitempty"`
+	Ready               bool   `json:"ready"`
+
+	PollLatency *latencyStatus `json:"poll_latency_seconds,omitempty"`
+
+	Families map[string]familyStatus `json:"families"`
+}
+
+// familyStatus is the health of a single address family of a chain.
+type familyStatus struct {
+	ReachableNodes int  `json:"reachable_nodes"`
+	Healthy        bool `json:"healthy"`
+}
+
+// families are the address families whose health is reported.
+var families = []struct {
+	name     string
+	nodeType seed.NodeType
+}{
+	{"ipv4", seed.NodeTypeIPv4},
+	{"ipv6", seed.NodeTypeIPv6},
+}
+
+// familyHealth reports the number of reachable nodes of each address family
+// of the chain view. A family is unhealthy if it has fewer than
+// -family-min-nodes nodes while the chain has enough nodes overall that
+// we'd expect some, which usually is the sign of an ingestion or filtering
+// bug rather than of the actual state of the network.
+func familyHealth(chainView *seed.ChainView) map[string]familyStatus {
+	types := make([]seed.NodeType, len(families))
+	for i, family := range families {
+		types[i] = family.nodeType
+	}
+	counts := chainView.NetView.NumReachableByType(types...)
+	expectNodes := chainView.NetView.NumReachable() >= *familyCheckMinNodes
+
+	health := make(map[string]familyStatus, len(families))
+	for i, family := range families {
+		health[family.name] = familyStatus{
+			ReachableNodes: counts[i],
+			Healthy: !expectNodes ||
+				counts[i] >= *familyMinNodes,
+		}
+	}
+
+	return health
+}
+
+// latencyStatus reports percentiles of the recent poll latencies, in
+// seconds.
+type latencyStatus struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// pollLatency returns the poll latency percentiles of the chain view, or nil
+// if it wasn't polled yet.
+func pollLatency(chainView *seed.ChainView) *latencyStatus {
+	if chainView.PollLatency == nil {
+		return nil
+	}
+
+	ps, ok := chainView.PollLatency.Percentiles(0.5, 0.9, 0.99)
+	if !ok {
+		return nil
+	}
+
+	return &latencyStatus{
+		P50: ps[0].Seconds(),
+		P90: ps[1].Seconds(),
+		P99: ps[2].Seconds(),
+	}
+}
+
+// statusReport is the document served by the status endpoint.
+type statusReport struct {
+	Listeners []seed.ListenerState `json:"listeners"`
+	Chains    []chainStatus        `json:"chains"`
+}
+
+// buildStatus assembles the status report of the DNS listeners and all the
+// chain views.
+func buildStatus(dnsServer *seed.DnsServer,
+	chainViews map[string]*seed.ChainView) *statusReport {
+
+	report := &statusReport{
+		Listeners: dnsServer.Listeners(),
+	}
+	for prefix, chainView := range chainViews {
+		report.Chains = append(
+			report.Chains, buildChainStatus(prefix, chainView),
+		)
+	}
+
+	sort.Slice(report.Chains, func(i, j int) bool {
+		return report.Chains[i].Prefix < report.Chains[j].Prefix
+	})
+
+	return report
+}
+
+// buildChainStatus assembles the status report of a single chain view.
+func buildChainStatus(prefix string, chainView *seed.ChainView) chainStatus {
+	status := chainStatus{
+		Chain:          chainView.NetView.Chain(),
+		Prefix:         prefix,
+		ReachableNodes: chainView.NetView.NumReachable(),
+		Ready:          chainView.NetView.Fresh(readyMaxAge()),
+		PollLatency:    pollLatency(chainView),
+		Families:       familyHealth(chainView),
+	}
+	if lastPoll := chainView.NetView.LastPoll(); !lastPoll.IsZero() {
+		status.LastPoll = lastPoll.Format(time.RFC3339)
+	}
+	if chainView.Breaker != nil {
+		status.Breaker = chainView.Breaker.State().String()
+		status.ConsecutiveFailures = chainView.Breaker.Failures()
+	}
+
+	return status
+}
+
+// statusHandler returns an http handler which reports the state of the DNS
+// listeners and each of the chain views as JSON.
+func statusHandler(dnsServer *seed.DnsServer,
+	chainViews map[string]*seed.ChainView) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := buildStatus(dnsServer, chainViews)
+		err := json.NewEncoder(w).Encode(status)
+		if err != nil {
+			log.Errorf("Unable to write status: %v", err)
+		}
+	}
+}
+
+// chainStatusHandler returns an http handler which reports the state of a
+// single chain view as JSON, under /status/<ticker>, e.g. /status/btc. The
+// chain's name works as well.
+func chainStatusHandler(
+	chainViews map[string]*seed.ChainView) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/status/"))
+
+		for _, chain := range chains {
+			if name != strings.ToLower(chain.ticker) &&
+				name != chain.name {
+
+				continue
+			}
+
+			chainView, ok := chainViews[chain.prefix]
+			if !ok {
+				break
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			status := buildChainStatus(chain.prefix, chainView)
+			err := json.NewEncoder(w).Encode(status)
+			if err != nil {
+				log.Errorf("Unable to write status: %v", err)
+			}
+			return
+		}
+
+		http.NotFound(w, r)
+	}
+}
+
+// readyMaxAge is the maximum age of the last successful poll of a chain for
+// it to be considered ready. We allow for a couple of failed polls before
+// declaring the data stale.
+func readyMaxAge() time.Duration {
+	return 3 * time.Second * time.Duration(*pollInterval)
+}
+
+// livezHandler returns an http handler for the Kubernetes liveness probe,
+// which succeeds as soon as any of the DNS listeners is bound.
+func livezHandler(dnsServer *seed.DnsServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !dnsServer.Listening() {
+			http.Error(w, "listeners not bound", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ok\n"))
+	}
+}
+
+// readyzHandler returns an http handler for the Kubernetes readiness probe,
+// which only succeeds once at least one chain has fresh data, so that a
+// process waiting for its first poll isn't sent any traffic.
+func readyzHandler(chainViews map[string]*seed.ChainView) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for _, chainView := range chainViews {
+			if chainView.NetView.Fresh(readyMaxAge()) {
+				w.Write([]byte("ok\n"))
+				return
+			}
+		}
+
+		http.Error(w, "no chain has fresh data", http.StatusServiceUnavailable)
+	}
+}